@@ -10,6 +10,7 @@ import (
 type ArrayLiteral struct {
 	Token    token.Token
 	Elements []Expression
+	Rbrack   token.Position
 }
 
 func (al *ArrayLiteral) expressionNode() {
@@ -36,3 +37,17 @@ func (al *ArrayLiteral) String() string {
 
 	return out.String()
 }
+
+//Pos start
+func (al *ArrayLiteral) Pos() token.Position {
+	return al.Token.Pos
+}
+
+//End just past the ]
+func (al *ArrayLiteral) End() token.Position {
+	if al.Rbrack.IsValid() {
+		return al.Rbrack
+	}
+
+	return al.Token.End
+}
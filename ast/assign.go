@@ -0,0 +1,85 @@
+package ast
+
+import "monkey/token"
+import "bytes"
+
+//AssignExpression x = 1, or a compound x += 1.  Operator is the
+//assignment operator as written
+type AssignExpression struct {
+	Token    token.Token
+	Name     *Identifier
+	Operator string
+	Value    Expression
+}
+
+func (ae *AssignExpression) expressionNode() {
+
+}
+
+//TokenLiteral get literal
+func (ae *AssignExpression) TokenLiteral() string {
+	return ae.Token.Literal
+}
+
+//String get string
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ae.Name.String())
+	out.WriteString(" " + ae.Operator + " ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+//Pos start of the name
+func (ae *AssignExpression) Pos() token.Position {
+	return ae.Name.Pos()
+}
+
+//End end of the value
+func (ae *AssignExpression) End() token.Position {
+	return endOf(ae.Value, ae.Token.End)
+}
+
+//IndexAssignExpression a[i] = 1, or a compound a[i] += 1
+type IndexAssignExpression struct {
+	Token    token.Token
+	Target   *IndexExpression
+	Operator string
+	Value    Expression
+}
+
+func (ia *IndexAssignExpression) expressionNode() {
+
+}
+
+//TokenLiteral get literal
+func (ia *IndexAssignExpression) TokenLiteral() string {
+	return ia.Token.Literal
+}
+
+//String get string
+func (ia *IndexAssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ia.Target.String())
+	out.WriteString(" " + ia.Operator + " ")
+	out.WriteString(ia.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+//Pos start of the indexed expression
+func (ia *IndexAssignExpression) Pos() token.Position {
+	return ia.Target.Pos()
+}
+
+//End end of the value
+func (ia *IndexAssignExpression) End() token.Position {
+	return endOf(ia.Value, ia.Token.End)
+}
@@ -1,9 +1,15 @@
 package ast
 
+import "monkey/token"
+
 //Node all AST elements must implement
 type Node interface {
 	TokenLiteral() string
 	String() string
+	//Pos position of the first character of the node
+	Pos() token.Position
+	//End position just past the last character of the node
+	End() token.Position
 }
 
 //Statement Doesn't produce a valut
@@ -17,3 +23,13 @@ type Expression interface {
 	Node
 	expressionNode()
 }
+
+//endOf n's end when it was parsed, otherwise the fallback.  Half parsed
+//nodes are common while the parser is dealing with errors
+func endOf(n Node, fallback token.Position) token.Position {
+	if n == nil {
+		return fallback
+	}
+
+	return n.End()
+}
@@ -0,0 +1,73 @@
+package ast
+
+import "monkey/token"
+
+//BadExpression placeholder for an expression that failed to parse.
+//Covers the source from Token up to To
+type BadExpression struct {
+	Token token.Token
+	To    token.Position
+}
+
+func (be *BadExpression) expressionNode() {
+
+}
+
+//TokenLiteral get literal
+func (be *BadExpression) TokenLiteral() string {
+	return be.Token.Literal
+}
+
+//String get string
+func (be *BadExpression) String() string {
+	return "<bad expression>"
+}
+
+//Pos start
+func (be *BadExpression) Pos() token.Position {
+	return be.Token.Pos
+}
+
+//End end
+func (be *BadExpression) End() token.Position {
+	if be.To.IsValid() {
+		return be.To
+	}
+
+	return be.Token.End
+}
+
+//BadStatement placeholder for source the parser skipped while
+//recovering from an error.  Covers the source from Token up to To
+type BadStatement struct {
+	Token token.Token
+	To    token.Position
+}
+
+func (bs *BadStatement) statementNode() {
+
+}
+
+//TokenLiteral get literal
+func (bs *BadStatement) TokenLiteral() string {
+	return bs.Token.Literal
+}
+
+//String get string
+func (bs *BadStatement) String() string {
+	return "<bad statement>"
+}
+
+//Pos start
+func (bs *BadStatement) Pos() token.Position {
+	return bs.Token.Pos
+}
+
+//End end
+func (bs *BadStatement) End() token.Position {
+	if bs.To.IsValid() {
+		return bs.To
+	}
+
+	return bs.Token.End
+}
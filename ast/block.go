@@ -6,6 +6,7 @@ import "bytes"
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
+	Rbrace     token.Position
 }
 
 func (bs *BlockStatement) statementNode() {
@@ -29,3 +30,21 @@ func (bs *BlockStatement) String() string {
 	out.WriteString(" }")
 	return out.String()
 }
+
+//Pos start
+func (bs *BlockStatement) Pos() token.Position {
+	return bs.Token.Pos
+}
+
+//End just past the }
+func (bs *BlockStatement) End() token.Position {
+	if bs.Rbrace.IsValid() {
+		return bs.Rbrace
+	}
+
+	if len(bs.Statements) > 0 {
+		return endOf(bs.Statements[len(bs.Statements)-1], bs.Token.End)
+	}
+
+	return bs.Token.End
+}
@@ -20,3 +20,13 @@ func (b *Boolean) TokenLiteral() string {
 func (b *Boolean) String() string {
 	return b.TokenLiteral()
 }
+
+//Pos start
+func (b *Boolean) Pos() token.Position {
+	return b.Token.Pos
+}
+
+//End end
+func (b *Boolean) End() token.Position {
+	return b.Token.End
+}
@@ -0,0 +1,79 @@
+package ast
+
+import "monkey/token"
+
+//BreakStatement break; or break label; to leave the loop with that
+//label rather than the innermost one
+type BreakStatement struct {
+	Token token.Token
+	Label *Identifier
+}
+
+func (bs *BreakStatement) statementNode() {
+
+}
+
+//TokenLiteral get literal
+func (bs *BreakStatement) TokenLiteral() string {
+	return bs.Token.Literal
+}
+
+func (bs *BreakStatement) String() string {
+	return loopControlString(bs.Token, bs.Label)
+}
+
+//Pos start
+func (bs *BreakStatement) Pos() token.Position {
+	return bs.Token.Pos
+}
+
+//End end of the label, or of break
+func (bs *BreakStatement) End() token.Position {
+	return loopControlEnd(bs.Token, bs.Label)
+}
+
+//ContinueStatement continue; or continue label; to go on with the
+//loop with that label rather than the innermost one
+type ContinueStatement struct {
+	Token token.Token
+	Label *Identifier
+}
+
+func (cs *ContinueStatement) statementNode() {
+
+}
+
+//TokenLiteral get literal
+func (cs *ContinueStatement) TokenLiteral() string {
+	return cs.Token.Literal
+}
+
+func (cs *ContinueStatement) String() string {
+	return loopControlString(cs.Token, cs.Label)
+}
+
+//Pos start
+func (cs *ContinueStatement) Pos() token.Position {
+	return cs.Token.Pos
+}
+
+//End end of the label, or of continue
+func (cs *ContinueStatement) End() token.Position {
+	return loopControlEnd(cs.Token, cs.Label)
+}
+
+func loopControlString(tok token.Token, label *Identifier) string {
+	if label != nil {
+		return tok.Literal + " " + label.String() + ";"
+	}
+
+	return tok.Literal + ";"
+}
+
+func loopControlEnd(tok token.Token, label *Identifier) token.Position {
+	if label != nil {
+		return label.End()
+	}
+
+	return tok.End
+}
@@ -11,6 +11,7 @@ type CallExpression struct {
 	Token     token.Token
 	Function  Expression
 	Arguments []Expression
+	Rparen    token.Position
 }
 
 func (ce *CallExpression) expressionNode() {
@@ -36,3 +37,21 @@ func (ce *CallExpression) String() string {
 
 	return out.String()
 }
+
+//Pos start of the function being called
+func (ce *CallExpression) Pos() token.Position {
+	if ce.Function != nil {
+		return ce.Function.Pos()
+	}
+
+	return ce.Token.Pos
+}
+
+//End just past the )
+func (ce *CallExpression) End() token.Position {
+	if ce.Rparen.IsValid() {
+		return ce.Rparen
+	}
+
+	return ce.Token.End
+}
@@ -25,3 +25,17 @@ func (es *ExpressionStatement) String() string {
 
 	return ""
 }
+
+//Pos start
+func (es *ExpressionStatement) Pos() token.Position {
+	if es.Expression != nil {
+		return es.Expression.Pos()
+	}
+
+	return es.Token.Pos
+}
+
+//End end
+func (es *ExpressionStatement) End() token.Position {
+	return endOf(es.Expression, es.Token.End)
+}
@@ -0,0 +1,33 @@
+package ast
+
+import "monkey/token"
+
+//FloatLiteral 3.14, 1e-9,...
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode() {
+
+}
+
+//TokenLiteral get literal
+func (fl *FloatLiteral) TokenLiteral() string {
+	return fl.Token.Literal
+}
+
+//String to string
+func (fl *FloatLiteral) String() string {
+	return fl.Token.Literal
+}
+
+//Pos start
+func (fl *FloatLiteral) Pos() token.Position {
+	return fl.Token.Pos
+}
+
+//End end
+func (fl *FloatLiteral) End() token.Position {
+	return fl.Token.End
+}
@@ -0,0 +1,65 @@
+package ast
+
+import "monkey/token"
+import "bytes"
+
+//ForExpression for (<value> in <expression>) { <statements> } or
+//for (<key>, <value> in <expression>) { <statements> } runs the body
+//once for each value the expression iterates over, with the names bound
+//afresh each time.  Key is nil with only one name.  Label is the name
+//before a labelled loop, label: for ..., nil otherwise.  Evaluates to
+//null
+type ForExpression struct {
+	Token    token.Token
+	Label    *Identifier
+	Key      *Identifier
+	Value    *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fe *ForExpression) expressionNode() {
+
+}
+
+//TokenLiteral get literal
+func (fe *ForExpression) TokenLiteral() string {
+	return fe.Token.Literal
+}
+
+//String get stringy with it
+func (fe *ForExpression) String() string {
+	var out bytes.Buffer
+	if fe.Label != nil {
+		out.WriteString(fe.Label.String() + ": ")
+	}
+	out.WriteString("for (")
+	if fe.Key != nil {
+		out.WriteString(fe.Key.String() + ", ")
+	}
+	out.WriteString(fe.Value.String())
+	out.WriteString(" in ")
+	out.WriteString(fe.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fe.Body.String())
+
+	return out.String()
+}
+
+//Pos start of the label, or of for
+func (fe *ForExpression) Pos() token.Position {
+	if fe.Label != nil {
+		return fe.Label.Pos()
+	}
+
+	return fe.Token.Pos
+}
+
+//End end of the body
+func (fe *ForExpression) End() token.Position {
+	if fe.Body != nil {
+		return fe.Body.End()
+	}
+
+	return endOf(fe.Iterable, fe.Token.End)
+}
@@ -39,3 +39,17 @@ func (fl *FunctionLiteral) String() string {
 
 	return out.String()
 }
+
+//Pos start
+func (fl *FunctionLiteral) Pos() token.Position {
+	return fl.Token.Pos
+}
+
+//End end of the body
+func (fl *FunctionLiteral) End() token.Position {
+	if fl.Body != nil {
+		return fl.Body.End()
+	}
+
+	return fl.Token.End
+}
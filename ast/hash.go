@@ -8,8 +8,9 @@ import (
 
 //HashLiteral hash
 type HashLiteral struct {
-	Token token.Token
-	Pairs map[Expression]Expression
+	Token  token.Token
+	Pairs  map[Expression]Expression
+	Rbrace token.Position
 }
 
 func (hl *HashLiteral) expressionNode() {
@@ -36,3 +37,17 @@ func (hl *HashLiteral) String() string {
 
 	return out.String()
 }
+
+//Pos start
+func (hl *HashLiteral) Pos() token.Position {
+	return hl.Token.Pos
+}
+
+//End just past the }
+func (hl *HashLiteral) End() token.Position {
+	if hl.Rbrace.IsValid() {
+		return hl.Rbrace
+	}
+
+	return hl.Token.End
+}
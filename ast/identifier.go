@@ -20,3 +20,13 @@ func (i *Identifier) expressionNode() {
 func (i *Identifier) String() string {
 	return i.Value
 }
+
+//Pos start
+func (i *Identifier) Pos() token.Position {
+	return i.Token.Pos
+}
+
+//End end
+func (i *Identifier) End() token.Position {
+	return i.Token.End
+}
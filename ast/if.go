@@ -3,7 +3,8 @@ package ast
 import "monkey/token"
 import "bytes"
 
-//IfExpression if (<condition>) <consequence> else <alternative>
+//IfExpression if (<condition>) <consequence> else <alternative>.  For
+//else if (...) the alternative is a block holding just that if
 type IfExpression struct {
 	Token       token.Token
 	Condition   Expression
@@ -33,3 +34,21 @@ func (ie *IfExpression) String() string {
 
 	return out.String()
 }
+
+//Pos start
+func (ie *IfExpression) Pos() token.Position {
+	return ie.Token.Pos
+}
+
+//End end of whichever block comes last
+func (ie *IfExpression) End() token.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+
+	if ie.Consequence != nil {
+		return ie.Consequence.End()
+	}
+
+	return endOf(ie.Condition, ie.Token.End)
+}
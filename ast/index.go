@@ -5,9 +5,10 @@ import "bytes"
 
 //IndexExpression index
 type IndexExpression struct {
-	Token token.Token
-	Left  Expression
-	Index Expression
+	Token  token.Token
+	Left   Expression
+	Index  Expression
+	Rbrack token.Position
 }
 
 func (ie *IndexExpression) expressionNode() {
@@ -30,3 +31,21 @@ func (ie *IndexExpression) String() string {
 
 	return out.String()
 }
+
+//Pos start of the indexed expression
+func (ie *IndexExpression) Pos() token.Position {
+	if ie.Left != nil {
+		return ie.Left.Pos()
+	}
+
+	return ie.Token.Pos
+}
+
+//End just past the ]
+func (ie *IndexExpression) End() token.Position {
+	if ie.Rbrack.IsValid() {
+		return ie.Rbrack
+	}
+
+	return endOf(ie.Index, ie.Token.End)
+}
@@ -32,3 +32,17 @@ func (oe *InfixExpression) String() string {
 
 	return out.String()
 }
+
+//Pos start of the left operand
+func (oe *InfixExpression) Pos() token.Position {
+	if oe.Left != nil {
+		return oe.Left.Pos()
+	}
+
+	return oe.Token.Pos
+}
+
+//End end of the right operand
+func (oe *InfixExpression) End() token.Position {
+	return endOf(oe.Right, oe.Token.End)
+}
@@ -1,6 +1,9 @@
 package ast
 
-import "monkey/token"
+import (
+	"math/big"
+	"monkey/token"
+)
 
 //IntegerLiteral 1,2,3,4,...
 type IntegerLiteral struct {
@@ -21,3 +24,43 @@ func (il *IntegerLiteral) TokenLiteral() string {
 func (il *IntegerLiteral) String() string {
 	return il.Token.Literal
 }
+
+//Pos start
+func (il *IntegerLiteral) Pos() token.Position {
+	return il.Token.Pos
+}
+
+//End end
+func (il *IntegerLiteral) End() token.Position {
+	return il.Token.End
+}
+
+//BigIntegerLiteral an integer literal too large for an int64
+type BigIntegerLiteral struct {
+	Token token.Token
+	Value *big.Int
+}
+
+func (bl *BigIntegerLiteral) expressionNode() {
+
+}
+
+//TokenLiteral get literal
+func (bl *BigIntegerLiteral) TokenLiteral() string {
+	return bl.Token.Literal
+}
+
+//String to string
+func (bl *BigIntegerLiteral) String() string {
+	return bl.Token.Literal
+}
+
+//Pos start
+func (bl *BigIntegerLiteral) Pos() token.Position {
+	return bl.Token.Pos
+}
+
+//End end
+func (bl *BigIntegerLiteral) End() token.Position {
+	return bl.Token.End
+}
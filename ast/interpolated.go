@@ -0,0 +1,58 @@
+package ast
+
+import (
+	"bytes"
+	"monkey/token"
+)
+
+//InterpolatedString "<text>${<expression>}<text>...".  Parts alternate
+//between the text, as *StringLiteral, and the embedded expressions, so
+//they start and end with text, which may be empty
+type InterpolatedString struct {
+	Token token.Token
+	Parts []Expression
+	Close token.Position
+}
+
+func (is *InterpolatedString) expressionNode() {
+
+}
+
+//TokenLiteral the text before the first ${
+func (is *InterpolatedString) TokenLiteral() string {
+	return is.Token.Literal
+}
+
+//String the string as written, less its escapes
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("\"")
+	for i, part := range is.Parts {
+		if i%2 == 0 {
+			out.WriteString(part.(*StringLiteral).Value)
+			continue
+		}
+
+		out.WriteString("${")
+		out.WriteString(part.String())
+		out.WriteString("}")
+	}
+	out.WriteString("\"")
+
+	return out.String()
+}
+
+//Pos the opening quote
+func (is *InterpolatedString) Pos() token.Position {
+	return is.Token.Pos
+}
+
+//End just past the closing quote
+func (is *InterpolatedString) End() token.Position {
+	if is.Close.IsValid() {
+		return is.Close
+	}
+
+	return is.Token.End
+}
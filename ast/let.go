@@ -6,10 +6,12 @@ import (
 )
 
 //LetStatemment let a = 0;
+//Or let [a, b] = c; where Pattern takes the place of Name
 type LetStatement struct {
-	Token token.Token
-	Name  *Identifier
-	Value Expression
+	Token   token.Token
+	Name    *Identifier
+	Pattern Pattern
+	Value   Expression
 }
 
 //TokenLiteral Pretty print
@@ -25,7 +27,11 @@ func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
+	if ls.Pattern != nil {
+		out.WriteString(ls.Pattern.String())
+	} else {
+		out.WriteString(ls.Name.String())
+	}
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
@@ -36,3 +42,21 @@ func (ls *LetStatement) String() string {
 
 	return out.String()
 }
+
+//Pos start
+func (ls *LetStatement) Pos() token.Position {
+	return ls.Token.Pos
+}
+
+//End end of the value
+func (ls *LetStatement) End() token.Position {
+	if ls.Name != nil {
+		return endOf(ls.Value, ls.Name.End())
+	}
+
+	if ls.Pattern != nil {
+		return endOf(ls.Value, ls.Pattern.End())
+	}
+
+	return endOf(ls.Value, ls.Token.End)
+}
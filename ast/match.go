@@ -0,0 +1,79 @@
+package ast
+
+import (
+	"bytes"
+	"monkey/token"
+	"strings"
+)
+
+//MatchArm <pattern> => <body> or <pattern> if <guard> => <body>.  Guard
+//is nil without an if
+type MatchArm struct {
+	Pattern Pattern
+	Guard   Expression
+	Body    Expression
+}
+
+//String get stringy with it
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+	out.WriteString(ma.Pattern.String())
+	if ma.Guard != nil {
+		out.WriteString(" if " + ma.Guard.String())
+	}
+	out.WriteString(" => ")
+	out.WriteString(ma.Body.String())
+
+	return out.String()
+}
+
+//MatchExpression match (<value>) { <arm>, ... } evaluates to the body
+//of the first arm whose pattern matches the value and whose guard, if
+//it has one, is truthy.  It's an error for no arm to match
+type MatchExpression struct {
+	Token  token.Token
+	Value  Expression
+	Arms   []*MatchArm
+	Rbrace token.Position
+}
+
+func (me *MatchExpression) expressionNode() {
+
+}
+
+//TokenLiteral get literal
+func (me *MatchExpression) TokenLiteral() string {
+	return me.Token.Literal
+}
+
+//String get stringy with it
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+
+	out.WriteString("match (")
+	out.WriteString(me.Value.String())
+	out.WriteString(") { ")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+//Pos start
+func (me *MatchExpression) Pos() token.Position {
+	return me.Token.Pos
+}
+
+//End just past the }
+func (me *MatchExpression) End() token.Position {
+	if me.Rbrace.IsValid() {
+		return me.Rbrace
+	}
+
+	return endOf(me.Value, me.Token.End)
+}
@@ -0,0 +1,272 @@
+package ast
+
+import (
+	"bytes"
+	"monkey/token"
+	"strings"
+)
+
+//Pattern the shape a value is matched against, binding names to the
+//parts of it they stand for
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+//LiteralPattern matches values == Value, a number, string or boolean
+//literal or a negated number
+type LiteralPattern struct {
+	Value Expression
+}
+
+func (lp *LiteralPattern) patternNode() {
+
+}
+
+//TokenLiteral get literal
+func (lp *LiteralPattern) TokenLiteral() string {
+	return lp.Value.TokenLiteral()
+}
+
+func (lp *LiteralPattern) String() string {
+	return lp.Value.String()
+}
+
+//Pos start
+func (lp *LiteralPattern) Pos() token.Position {
+	return lp.Value.Pos()
+}
+
+//End end
+func (lp *LiteralPattern) End() token.Position {
+	return lp.Value.End()
+}
+
+//WildcardPattern _ matches anything without binding it
+type WildcardPattern struct {
+	Token token.Token
+}
+
+func (wp *WildcardPattern) patternNode() {
+
+}
+
+//TokenLiteral get literal
+func (wp *WildcardPattern) TokenLiteral() string {
+	return wp.Token.Literal
+}
+
+func (wp *WildcardPattern) String() string {
+	return wp.Token.Literal
+}
+
+//Pos start
+func (wp *WildcardPattern) Pos() token.Position {
+	return wp.Token.Pos
+}
+
+//End end
+func (wp *WildcardPattern) End() token.Position {
+	return wp.Token.End
+}
+
+//BindingPattern matches anything, binding Name to it
+type BindingPattern struct {
+	Name *Identifier
+}
+
+func (bp *BindingPattern) patternNode() {
+
+}
+
+//TokenLiteral get literal
+func (bp *BindingPattern) TokenLiteral() string {
+	return bp.Name.TokenLiteral()
+}
+
+func (bp *BindingPattern) String() string {
+	return bp.Name.String()
+}
+
+//Pos start
+func (bp *BindingPattern) Pos() token.Position {
+	return bp.Name.Pos()
+}
+
+//End end
+func (bp *BindingPattern) End() token.Position {
+	return bp.Name.End()
+}
+
+//RestPattern ...name, the last element of an array pattern, binds the
+//elements left over after the others as an array.  ..._ drops them
+type RestPattern struct {
+	Token   token.Token
+	Pattern Pattern
+}
+
+func (rp *RestPattern) patternNode() {
+
+}
+
+//TokenLiteral get literal
+func (rp *RestPattern) TokenLiteral() string {
+	return rp.Token.Literal
+}
+
+func (rp *RestPattern) String() string {
+	return rp.Token.Literal + rp.Pattern.String()
+}
+
+//Pos start
+func (rp *RestPattern) Pos() token.Position {
+	return rp.Token.Pos
+}
+
+//End end
+func (rp *RestPattern) End() token.Position {
+	return rp.Pattern.End()
+}
+
+//DefaultPattern <pattern> = <expression>, an array element or hash value
+//that Default stands in for when the array is too short or the hash
+//doesn't have the key
+type DefaultPattern struct {
+	Pattern Pattern
+	Default Expression
+}
+
+func (dp *DefaultPattern) patternNode() {
+
+}
+
+//TokenLiteral get literal
+func (dp *DefaultPattern) TokenLiteral() string {
+	return dp.Pattern.TokenLiteral()
+}
+
+func (dp *DefaultPattern) String() string {
+	return dp.Pattern.String() + " = " + dp.Default.String()
+}
+
+//Pos start
+func (dp *DefaultPattern) Pos() token.Position {
+	return dp.Pattern.Pos()
+}
+
+//End end of the default
+func (dp *DefaultPattern) End() token.Position {
+	return endOf(dp.Default, dp.Pattern.End())
+}
+
+//ArrayPattern [<pattern>, ...] matches arrays of as many elements, each
+//matching the pattern in its place.  Elements with defaults can be left
+//out and a rest element takes any number more
+type ArrayPattern struct {
+	Token    token.Token
+	Elements []Pattern
+	Rbrack   token.Position
+}
+
+func (ap *ArrayPattern) patternNode() {
+
+}
+
+//TokenLiteral get literal
+func (ap *ArrayPattern) TokenLiteral() string {
+	return ap.Token.Literal
+}
+
+func (ap *ArrayPattern) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range ap.Elements {
+		elements = append(elements, el.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+//SplitRest the elements before the rest element, and the rest element
+//if there is one
+func (ap *ArrayPattern) SplitRest() ([]Pattern, *RestPattern) {
+	if n := len(ap.Elements); n > 0 {
+		if rest, ok := ap.Elements[n-1].(*RestPattern); ok {
+			return ap.Elements[:n-1], rest
+		}
+	}
+
+	return ap.Elements, nil
+}
+
+//Pos start
+func (ap *ArrayPattern) Pos() token.Position {
+	return ap.Token.Pos
+}
+
+//End just past the ]
+func (ap *ArrayPattern) End() token.Position {
+	if ap.Rbrack.IsValid() {
+		return ap.Rbrack
+	}
+
+	return ap.Token.End
+}
+
+//HashPatternPair Key is a literal, or a string for a name written on
+//its own, and the value the hash has for it has to match Value
+type HashPatternPair struct {
+	Key   Expression
+	Value Pattern
+}
+
+//HashPattern {<key>: <pattern>, ...} matches hashes that have all the
+//keys, whatever else they have.  {name} is short for {"name": name}
+type HashPattern struct {
+	Token  token.Token
+	Pairs  []HashPatternPair
+	Rbrace token.Position
+}
+
+func (hp *HashPattern) patternNode() {
+
+}
+
+//TokenLiteral get literal
+func (hp *HashPattern) TokenLiteral() string {
+	return hp.Token.Literal
+}
+
+func (hp *HashPattern) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range hp.Pairs {
+		pairs = append(pairs, pair.Key.String()+":"+pair.Value.String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+//Pos start
+func (hp *HashPattern) Pos() token.Position {
+	return hp.Token.Pos
+}
+
+//End just past the }
+func (hp *HashPattern) End() token.Position {
+	if hp.Rbrace.IsValid() {
+		return hp.Rbrace
+	}
+
+	return hp.Token.End
+}
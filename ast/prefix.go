@@ -30,3 +30,13 @@ func (pe *PrefixExpression) String() string {
 
 	return out.String()
 }
+
+//Pos start
+func (pe *PrefixExpression) Pos() token.Position {
+	return pe.Token.Pos
+}
+
+//End end of the operand
+func (pe *PrefixExpression) End() token.Position {
+	return endOf(pe.Right, pe.Token.End)
+}
@@ -1,6 +1,9 @@
 package ast
 
-import "bytes"
+import (
+	"bytes"
+	"monkey/token"
+)
 
 //Program Collection of statements
 type Program struct {
@@ -25,3 +28,21 @@ func (p *Program) String() string {
 
 	return out.String()
 }
+
+//Pos start of the first statement
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+
+	return token.Position{}
+}
+
+//End end of the last statement
+func (p *Program) End() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+
+	return token.Position{}
+}
@@ -31,3 +31,13 @@ func (r *ReturnStatement) String() string {
 
 	return out.String()
 }
+
+//Pos start
+func (r *ReturnStatement) Pos() token.Position {
+	return r.Token.Pos
+}
+
+//End end of the returned value
+func (r *ReturnStatement) End() token.Position {
+	return endOf(r.ReturnValue, r.Token.End)
+}
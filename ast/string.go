@@ -21,3 +21,13 @@ func (s *StringLiteral) TokenLiteral() string {
 func (s *StringLiteral) String() string {
 	return s.Token.Literal
 }
+
+//Pos start
+func (s *StringLiteral) Pos() token.Position {
+	return s.Token.Pos
+}
+
+//End end
+func (s *StringLiteral) End() token.Position {
+	return s.Token.End
+}
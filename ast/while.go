@@ -4,9 +4,11 @@ import "monkey/token"
 import "bytes"
 
 //WhileExpression while (<expression>) { <statements> } will evaluate
-//to the number of times the condition was evaluated
+//to the number of times the condition was evaluated.  Label is the
+//name before a labelled loop, label: while ..., nil otherwise
 type WhileExpression struct {
 	Token     token.Token
+	Label     *Identifier
 	Condition Expression
 	Body      *BlockStatement
 }
@@ -23,6 +25,9 @@ func (we *WhileExpression) TokenLiteral() string {
 //String get stringy with it
 func (we *WhileExpression) String() string {
 	var out bytes.Buffer
+	if we.Label != nil {
+		out.WriteString(we.Label.String() + ": ")
+	}
 	out.WriteString("while")
 	out.WriteString(" (")
 	out.WriteString(we.Condition.String())
@@ -31,3 +36,21 @@ func (we *WhileExpression) String() string {
 
 	return out.String()
 }
+
+//Pos start of the label, or of while
+func (we *WhileExpression) Pos() token.Position {
+	if we.Label != nil {
+		return we.Label.Pos()
+	}
+
+	return we.Token.Pos
+}
+
+//End end of the body
+func (we *WhileExpression) End() token.Position {
+	if we.Body != nil {
+		return we.Body.End()
+	}
+
+	return endOf(we.Condition, we.Token.End)
+}
@@ -0,0 +1,139 @@
+package budget
+
+import (
+	"context"
+	"monkey/object"
+	"time"
+)
+
+//DefaultMaxDepth call depth allowed when a Budget doesn't set one.
+//Deeper recursion would overflow the Go stack of the tree walker
+const DefaultMaxDepth = 10000
+
+//checkEvery steps between looks at the context, which is comparatively
+//expensive
+const checkEvery = 1024
+
+//Budget limits on a single run, zero fields mean no limit.  A step is
+//one node evaluated by the tree walker or one instruction executed by
+//the virtual machine.  MaxMemory is in bytes, as counted by SizeOf, of
+//the values the run can still reach
+type Budget struct {
+	MaxSteps  int64
+	MaxDepth  int
+	MaxMemory int64
+	Timeout   time.Duration
+}
+
+//Summary what a run used.  PeakMemory is the most bytes of strings,
+//arrays and hashes the run could still reach when its memory was
+//measured, see Meter.Alloc
+type Summary struct {
+	Steps      int64
+	PeakDepth  int
+	PeakMemory int64
+}
+
+//Meter keeps count of what a run has used against its budget
+type Meter struct {
+	ctx    context.Context
+	budget Budget
+
+	steps     int64
+	untilPoll int
+	depth     int
+	peakDepth int
+
+	roots       Roots
+	live        int64
+	peakMemory  int64
+	nextMeasure int64
+}
+
+//NewMeter meter for a run that also stops when ctx is done.  Call
+//cancel once the run is over to release the timeout's timer
+func NewMeter(ctx context.Context, b Budget) (m *Meter, cancel context.CancelFunc) {
+	if b.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, b.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	if b.MaxDepth == 0 {
+		b.MaxDepth = DefaultMaxDepth
+	}
+
+	return &Meter{ctx: ctx, budget: b, untilPoll: checkEvery, nextMeasure: measureEvery}, cancel
+}
+
+//Steps how many steps the run has taken
+func (m *Meter) Steps() int64 {
+	return m.steps
+}
+
+//MaxDepth how deep calls can nest in the run
+func (m *Meter) MaxDepth() int {
+	return m.budget.MaxDepth
+}
+
+//Summary what the run has used so far
+func (m *Meter) Summary() Summary {
+	return Summary{Steps: m.steps, PeakDepth: m.peakDepth, PeakMemory: m.peakMemory}
+}
+
+//Step count a step.  An error once the budget is used up or the run
+//was cancelled
+func (m *Meter) Step() *object.Error {
+	m.steps++
+
+	if m.budget.MaxSteps > 0 && m.steps > m.budget.MaxSteps {
+		err := object.NewError("step limit of %d exceeded", m.budget.MaxSteps)
+		err.Kind = object.StepLimitError
+		return err
+	}
+
+	m.untilPoll--
+	if m.untilPoll > 0 {
+		return nil
+	}
+	m.untilPoll = checkEvery
+
+	return m.Check()
+}
+
+//Check look at the context without counting a step
+func (m *Meter) Check() *object.Error {
+	switch m.ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		err := object.NewError("timed out after %s", m.budget.Timeout)
+		err.Kind = object.TimeoutError
+		return err
+	default:
+		err := object.NewError("interrupted")
+		err.Kind = object.InterruptedError
+		return err
+	}
+}
+
+//Enter count a call.  An error if it nests too deep
+func (m *Meter) Enter() *object.Error {
+	if m.depth >= m.budget.MaxDepth {
+		err := object.NewError("call depth limit of %d exceeded", m.budget.MaxDepth)
+		err.Kind = object.DepthLimitError
+		return err
+	}
+
+	m.depth++
+	if m.depth > m.peakDepth {
+		m.peakDepth = m.depth
+	}
+
+	return nil
+}
+
+//Leave a call counted by Enter returned
+func (m *Meter) Leave() {
+	m.depth--
+}
@@ -0,0 +1,123 @@
+package budget
+
+import (
+	"context"
+	"monkey/object"
+	"testing"
+)
+
+func TestMeterSteps(t *testing.T) {
+	m, cancel := NewMeter(context.Background(), Budget{MaxSteps: 3})
+	defer cancel()
+
+	for i := 0; i < 3; i++ {
+		if err := m.Step(); err != nil {
+			t.Fatalf("step %d failed: %s", i, err)
+		}
+	}
+
+	err := m.Step()
+	if err == nil || err.Kind != object.StepLimitError {
+		t.Fatalf("expected a step limit error. got=%v", err)
+	}
+
+	if m.Steps() != 4 {
+		t.Errorf("wrong step count. want=4, got=%d", m.Steps())
+	}
+}
+
+func TestMeterDepth(t *testing.T) {
+	m, cancel := NewMeter(context.Background(), Budget{MaxDepth: 2})
+	defer cancel()
+
+	if m.Enter() != nil || m.Enter() != nil {
+		t.Fatalf("calls within the limit failed")
+	}
+
+	err := m.Enter()
+	if err == nil || err.Kind != object.DepthLimitError {
+		t.Fatalf("expected a depth limit error. got=%v", err)
+	}
+
+	m.Leave()
+	if err := m.Enter(); err != nil {
+		t.Errorf("call after returning failed: %s", err)
+	}
+}
+
+func TestMeterCancel(t *testing.T) {
+	ctx, cancelRun := context.WithCancel(context.Background())
+	m, cancel := NewMeter(ctx, Budget{})
+	defer cancel()
+
+	if err := m.Check(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cancelRun()
+
+	err := m.Check()
+	if err == nil || err.Kind != object.InterruptedError {
+		t.Fatalf("expected an interrupted error. got=%v", err)
+	}
+}
+
+func TestMeterMemory(t *testing.T) {
+	m, cancel := NewMeter(context.Background(), Budget{MaxMemory: 100})
+	defer cancel()
+
+	str := &object.String{Value: "hello"}
+	if err := m.Alloc(str); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	m.Measure()
+	if m.Summary().PeakMemory != SizeOf(str) {
+		t.Errorf("wrong peak. want=%d, got=%d", SizeOf(str), m.Summary().PeakMemory)
+	}
+
+	arr := &object.Array{Elements: []object.Object{str}}
+	if err := m.AllocResult(str, []object.Object{arr}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	m.Measure()
+	if m.Summary().PeakMemory != SizeOf(str) {
+		t.Errorf("an element handed back was counted again")
+	}
+
+	err := m.Alloc(&object.Array{Elements: make([]object.Object, 10)})
+	if err == nil || err.Kind != object.MemoryLimitError {
+		t.Fatalf("expected a memory limit error. got=%v", err)
+	}
+}
+
+func TestMeterMemoryGivenBack(t *testing.T) {
+	m, cancel := NewMeter(context.Background(), Budget{MaxMemory: 300})
+	defer cancel()
+
+	kept := &object.Array{Elements: make([]object.Object, 5)}
+	m.SetRoots(func(visit func(object.Object), visitEnv func(*object.Environment)) {
+		visit(kept)
+	})
+
+	if err := m.Alloc(kept); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Each array is garbage once the next one is made, so together
+	// they're over the budget but never at once
+	for i := 0; i < 100; i++ {
+		if err := m.Alloc(&object.Array{Elements: make([]object.Object, 5)}); err != nil {
+			t.Fatalf("unexpected error after %d arrays: %s", i, err)
+		}
+	}
+
+	if peak := m.Summary().PeakMemory; peak != 2*SizeOf(kept) {
+		t.Errorf("wrong peak. want=%d, got=%d", 2*SizeOf(kept), peak)
+	}
+
+	kept.Elements = append(kept.Elements, &object.Array{Elements: make([]object.Object, 20)})
+	err := m.Alloc(kept.Elements[5])
+	if err == nil || err.Kind != object.MemoryLimitError {
+		t.Fatalf("expected a memory limit error. got=%v", err)
+	}
+}
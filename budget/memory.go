@@ -0,0 +1,201 @@
+package budget
+
+import (
+	"monkey/object"
+)
+
+//Approximate sizes in bytes of the parts of the values a run creates.
+//Only the value itself is counted, not the values it holds, since those
+//were counted when they were created
+const (
+	stringSize    = 16
+	arraySize     = 24
+	elementSize   = 16
+	hashSize      = 48
+	hashEntrySize = 80
+	bigIntSize    = 32
+	wordSize      = 8
+)
+
+//SizeOf approximate bytes o takes, not counting the values inside it.
+//Zero for anything but strings, arrays, hashes and big integers
+func SizeOf(o object.Object) int64 {
+	switch o := o.(type) {
+	case *object.String:
+		return stringSize + int64(len(o.Value))
+	case *object.Array:
+		return arraySize + elementSize*int64(len(o.Elements))
+	case *object.Hash:
+		return hashSize + hashEntrySize*int64(len(o.Pairs))
+	case *object.BigInteger:
+		return bigIntSize + wordSize*int64(len(o.Value.Bits()))
+	default:
+		return 0
+	}
+}
+
+//measureEvery bytes allocated, at the least, between measurements of
+//what a run can still reach
+const measureEvery = 64 << 10
+
+//Roots call visit with every value a run can reach directly, the
+//values on its stack and in its variables, and visitEnv with the
+//environments its variables are in if it keeps them in environments.
+//Only the engine running it knows where they are
+type Roots func(visit func(object.Object), visitEnv func(*object.Environment))
+
+//SetRoots how to find what the run can still reach, so memory it no
+//longer can is given back when measured.  Without roots everything
+//allocated stays counted
+func (m *Meter) SetRoots(roots Roots) {
+	m.roots = roots
+}
+
+//Alloc count the memory of a value the run just created.  Once the run
+//has allocated as much again as it held when last measured, or goes
+//over its budget, what it can still reach is measured and the rest is
+//given back.  An error if that's still more than the budget allows
+func (m *Meter) Alloc(o object.Object) *object.Error {
+	return m.charge(SizeOf(o), o)
+}
+
+//Grow count the memory a value took on when it changed in place, a
+//hash gaining a key, since before was its SizeOf
+func (m *Meter) Grow(o object.Object, before int64) *object.Error {
+	grown := SizeOf(o) - before
+	if grown <= 0 {
+		return nil
+	}
+
+	return m.charge(grown, o)
+}
+
+//charge count n more bytes held, by o among others, see Alloc
+func (m *Meter) charge(n int64, o object.Object) *object.Error {
+	m.live += n
+
+	overBudget := m.budget.MaxMemory > 0 && m.live > m.budget.MaxMemory
+	if m.live < m.nextMeasure && !overBudget {
+		return nil
+	}
+
+	m.Measure(o)
+
+	if m.budget.MaxMemory > 0 && m.live > m.budget.MaxMemory {
+		err := object.NewError("memory limit of %d bytes exceeded", m.budget.MaxMemory)
+		err.Kind = object.MemoryLimitError
+		return err
+	}
+
+	return nil
+}
+
+//Measure find the memory the run can still reach, from its roots and
+//the values in extra that it's still holding on to elsewhere, and
+//record it if it's the peak so far
+func (m *Meter) Measure(extra ...object.Object) {
+	if m.roots != nil {
+		w := &walk{seen: map[object.Object]bool{}, envs: map[*object.Environment]bool{}}
+		m.roots(w.visit, w.visitEnv)
+		for _, o := range extra {
+			w.visit(o)
+		}
+		m.live = w.size
+	}
+
+	if m.live > m.peakMemory {
+		m.peakMemory = m.live
+	}
+
+	m.nextMeasure = 2 * m.live
+	if m.nextMeasure < m.live+measureEvery {
+		m.nextMeasure = m.live + measureEvery
+	}
+}
+
+//walk adds up the memory of every value it visits, and of the values
+//they reach, counting each one once
+type walk struct {
+	seen map[object.Object]bool
+	envs map[*object.Environment]bool
+	size int64
+}
+
+func (w *walk) visit(o object.Object) {
+	switch o.(type) {
+	case *object.String, *object.Array, *object.Hash, *object.BigInteger,
+		*object.Function, *object.Closure, *object.Cell:
+	default:
+		return
+	}
+
+	if w.seen[o] {
+		return
+	}
+	w.seen[o] = true
+	w.size += SizeOf(o)
+
+	switch o := o.(type) {
+	case *object.Array:
+		for _, el := range o.Elements {
+			w.visit(el)
+		}
+	case *object.Hash:
+		for _, pair := range o.Pairs {
+			w.visit(pair.Key)
+			w.visit(pair.Value)
+		}
+	case *object.Function:
+		w.visitEnv(o.Env)
+	case *object.Closure:
+		for _, free := range o.Free {
+			w.visit(free)
+		}
+	case *object.Cell:
+		w.visit(o.Value)
+	}
+}
+
+func (w *walk) visitEnv(env *object.Environment) {
+	for ; env != nil && !w.envs[env]; env = env.Outer() {
+		w.envs[env] = true
+		env.Each(func(name string, val object.Object) {
+			w.visit(val)
+		})
+	}
+}
+
+//AllocResult like Alloc for what a builtin returned, unless it's one
+//of args or an element of one, which was counted already
+func (m *Meter) AllocResult(result object.Object, args []object.Object) *object.Error {
+	if SizeOf(result) == 0 || reused(result, args) {
+		return nil
+	}
+
+	return m.Alloc(result)
+}
+
+func reused(result object.Object, args []object.Object) bool {
+	for _, arg := range args {
+		if arg == result {
+			return true
+		}
+
+		switch arg := arg.(type) {
+		case *object.Array:
+			for _, el := range arg.Elements {
+				if el == result {
+					return true
+				}
+			}
+		case *object.Hash:
+			for _, pair := range arg.Pairs {
+				if pair.Key == result || pair.Value == result {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,366 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+//Instructions a run of encoded bytecode
+type Instructions []byte
+
+//String one disassembled instruction per line, prefixed by its offset
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+//Opcode what an instruction does
+type Opcode byte
+
+const (
+	//OpConstant push constants[operand]
+	OpConstant Opcode = iota
+	//OpPop discard the top of the stack
+	OpPop
+	//OpDup push copies of the top operand values, in the same order
+	OpDup
+
+	//OpAdd +
+	OpAdd
+	//OpSub -
+	OpSub
+	//OpMul *
+	OpMul
+	//OpDiv /
+	OpDiv
+	//OpMod %
+	OpMod
+	//OpPow **
+	OpPow
+	//OpBitAnd &
+	OpBitAnd
+	//OpBitOr |
+	OpBitOr
+	//OpBitXor ^
+	OpBitXor
+	//OpShiftLeft <<
+	OpShiftLeft
+	//OpShiftRight >>
+	OpShiftRight
+
+	//OpTrue push true
+	OpTrue
+	//OpFalse push false
+	OpFalse
+	//OpNull push null
+	OpNull
+
+	//OpEqual ==
+	OpEqual
+	//OpNotEqual !=
+	OpNotEqual
+	//OpGreaterThan >
+	OpGreaterThan
+	//OpLessThan <
+	OpLessThan
+	//OpGreaterEqual >=
+	OpGreaterEqual
+	//OpLessEqual <=
+	OpLessEqual
+
+	//OpMinus -x
+	OpMinus
+	//OpBang !x
+	OpBang
+	//OpBitNot ~x
+	OpBitNot
+
+	//OpJumpNotTruthy pop, jump to operand when the value is falsy
+	OpJumpNotTruthy
+	//OpJump jump to operand
+	OpJump
+	//OpWhileTest pop the loop condition, count the test in the loop
+	//counter underneath it and jump to operand when the condition is falsy
+	OpWhileTest
+	//OpLoopEnter note the stack height as a loop starts, for break and
+	//continue to go back to
+	OpLoopEnter
+	//OpLoopExit forget the innermost loop's stack height
+	OpLoopExit
+	//OpUnwind forget the operand innermost loops and go back to the stack
+	//height of the loop outside them, ahead of a break or continue's jump
+	OpUnwind
+	//OpIterate replace the top of the stack with an iterator over it
+	OpIterate
+	//OpIterNext push the next value of the iterator on top of the stack,
+	//with its key underneath when the second operand is 2, or jump to the
+	//first operand when there are no more
+	OpIterNext
+	//OpFreshLocals clear the second operand locals from the first, so a
+	//for loop's names are bound afresh each time round
+	OpFreshLocals
+
+	//OpGetGlobal push globals[operand]
+	OpGetGlobal
+	//OpSetGlobal pop into globals[operand]
+	OpSetGlobal
+	//OpAssignGlobal store the top of the stack, without popping it, in
+	//globals[operand], which has to be defined already
+	OpAssignGlobal
+	//OpGetLocal push locals[operand]
+	OpGetLocal
+	//OpSetLocal pop into locals[operand]
+	OpSetLocal
+	//OpAssignLocal store the top of the stack, without popping it, in
+	//locals[operand], which has to be defined already
+	OpAssignLocal
+	//OpGetBuiltin push the builtin at operand in the builtin table
+	OpGetBuiltin
+	//OpGetFree push the closure's free variable operand
+	OpGetFree
+	//OpAssignFree store the top of the stack, without popping it, in the
+	//closure's free variable operand
+	OpAssignFree
+	//OpCaptureLocal push the cell holding locals[operand] for a closure
+	//to capture, moving the local into a new cell first if need be
+	OpCaptureLocal
+	//OpCaptureFree push the closure's free variable operand, still in
+	//its cell, for a closure inside it to capture
+	OpCaptureFree
+	//OpCurrentClosure push the closure being run, for recursion
+	OpCurrentClosure
+
+	//OpArray build an array from the top operand values
+	OpArray
+	//OpHash build a hash from the top operand values, keys and values alternating
+	OpHash
+	//OpInterpolate build a string from the top operand values, converted
+	//by object.ToString
+	OpInterpolate
+	//OpIndex left[index]
+	OpIndex
+	//OpSetIndex left[index] = value, popping all three and pushing value
+	OpSetIndex
+	//OpMatchArray push whether the top of the stack is an array of at
+	//most first operand elements, or of any length if the second is 1
+	OpMatchArray
+	//OpMatchHash push whether the top of the stack is a hash
+	OpMatchHash
+	//OpMatchKey pop a key and an array or hash, push the value it has for
+	//the key, or null, and whether it has the key
+	OpMatchKey
+	//OpNoMatch fail, no arm of a match matched the top of the stack
+	OpNoMatch
+	//OpDestructureArray OpMatchArray for a let, failing unless the top of
+	//the stack is such an array
+	OpDestructureArray
+	//OpDestructureHash fail unless the top of the stack is a hash
+	OpDestructureHash
+	//OpDestructureKey pop a key and an array or hash, push the value it
+	//has for the key, failing if it doesn't have one
+	OpDestructureKey
+	//OpRest pop an array, push an array of its elements from operand on
+	OpRest
+
+	//OpCall call the function under operand arguments
+	OpCall
+	//OpReturnValue return the top of the stack
+	OpReturnValue
+	//OpReturn return null
+	OpReturn
+	//OpClosure wrap constants[first operand] and the top second operand
+	//values into a closure
+	OpClosure
+)
+
+//Definition name and operand layout of an opcode
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+	OpDup:      {"OpDup", []int{1}},
+
+	OpAdd: {"OpAdd", []int{}},
+	OpSub: {"OpSub", []int{}},
+	OpMul: {"OpMul", []int{}},
+	OpDiv: {"OpDiv", []int{}},
+	OpMod: {"OpMod", []int{}},
+	OpPow: {"OpPow", []int{}},
+
+	OpBitAnd:     {"OpBitAnd", []int{}},
+	OpBitOr:      {"OpBitOr", []int{}},
+	OpBitXor:     {"OpBitXor", []int{}},
+	OpShiftLeft:  {"OpShiftLeft", []int{}},
+	OpShiftRight: {"OpShiftRight", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpEqual:       {"OpEqual", []int{}},
+	OpNotEqual:    {"OpNotEqual", []int{}},
+	OpGreaterThan: {"OpGreaterThan", []int{}},
+	OpLessThan:    {"OpLessThan", []int{}},
+
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpBitNot: {"OpBitNot", []int{}},
+
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJump:          {"OpJump", []int{2}},
+	OpWhileTest:     {"OpWhileTest", []int{2}},
+	OpLoopEnter:     {"OpLoopEnter", []int{}},
+	OpLoopExit:      {"OpLoopExit", []int{}},
+	OpUnwind:        {"OpUnwind", []int{1}},
+	OpIterate:       {"OpIterate", []int{}},
+	OpIterNext:      {"OpIterNext", []int{2, 1}},
+	OpFreshLocals:   {"OpFreshLocals", []int{1, 1}},
+
+	OpGetGlobal:      {"OpGetGlobal", []int{2}},
+	OpSetGlobal:      {"OpSetGlobal", []int{2}},
+	OpAssignGlobal:   {"OpAssignGlobal", []int{2}},
+	OpGetLocal:       {"OpGetLocal", []int{1}},
+	OpSetLocal:       {"OpSetLocal", []int{1}},
+	OpAssignLocal:    {"OpAssignLocal", []int{1}},
+	OpGetBuiltin:     {"OpGetBuiltin", []int{1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpAssignFree:     {"OpAssignFree", []int{1}},
+	OpCaptureLocal:   {"OpCaptureLocal", []int{1}},
+	OpCaptureFree:    {"OpCaptureFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+
+	OpArray:       {"OpArray", []int{2}},
+	OpHash:        {"OpHash", []int{2}},
+	OpInterpolate: {"OpInterpolate", []int{2}},
+	OpIndex:       {"OpIndex", []int{}},
+	OpSetIndex:    {"OpSetIndex", []int{}},
+	OpMatchArray:  {"OpMatchArray", []int{2, 1}},
+	OpMatchHash:   {"OpMatchHash", []int{}},
+	OpMatchKey:    {"OpMatchKey", []int{}},
+	OpNoMatch:     {"OpNoMatch", []int{}},
+
+	OpDestructureArray: {"OpDestructureArray", []int{2, 1}},
+	OpDestructureHash:  {"OpDestructureHash", []int{}},
+	OpDestructureKey:   {"OpDestructureKey", []int{}},
+	OpRest:             {"OpRest", []int{2}},
+
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+	OpClosure:     {"OpClosure", []int{2, 1}},
+}
+
+//Lookup the definition of op
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+//Make encode one instruction
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+//ReadOperands decode the operands following an opcode, along with
+//how many bytes they took up
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+//ReadUint16 two byte big endian operand
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+//ReadUint8 one byte operand
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
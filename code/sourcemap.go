@@ -0,0 +1,26 @@
+package code
+
+import (
+	"monkey/token"
+	"sort"
+)
+
+//SourceMapEntry instructions from Offset on came from source at Pos
+type SourceMapEntry struct {
+	Offset int
+	Pos    token.Position
+}
+
+//SourceMap ties instruction offsets back to source, entries are
+//sorted by offset
+type SourceMap []SourceMapEntry
+
+//Lookup the source position of the instruction at offset
+func (sm SourceMap) Lookup(offset int) token.Position {
+	i := sort.Search(len(sm), func(i int) bool { return sm[i].Offset > offset })
+	if i == 0 {
+		return token.Position{}
+	}
+
+	return sm[i-1].Pos
+}
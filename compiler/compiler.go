@@ -0,0 +1,1085 @@
+package compiler
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/code"
+	"monkey/object"
+	"monkey/token"
+	"sort"
+	"strings"
+)
+
+//EmittedInstruction an instruction and where it starts
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+//CompilationScope the instructions of the function being compiled
+type CompilationScope struct {
+	instructions        code.Instructions
+	sourceMap           code.SourceMap
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+	loops               []*loop
+}
+
+//loop a loop being compiled.  continue jumps back to start and the
+//jumps at breaks are patched to the end of the loop once it's known
+type loop struct {
+	label  string
+	start  int
+	breaks []int
+}
+
+//Compiler lowers an AST to bytecode
+type Compiler struct {
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// pos is the position of the node being compiled, every
+	// instruction emitted is mapped back to it
+	pos token.Position
+
+	producesValue bool
+}
+
+//Bytecode compiled program.  ProducesValue is false when the program
+//doesn't end in an expression, so it has no value like evaluator.Eval
+//returning nil.  BuiltinNames are the names in the builtin table it was
+//compiled against, by index.  LocalNames are the names of the main
+//program's locals, which only for loops have
+type Bytecode struct {
+	Instructions  code.Instructions
+	Constants     []object.Object
+	SourceMap     code.SourceMap
+	GlobalNames   []string
+	BuiltinNames  []string
+	LocalNames    []string
+	ProducesValue bool
+}
+
+//New compiler with the default builtins already defined
+func New() *Compiler {
+	return NewWithBuiltins(object.Builtins)
+}
+
+//NewWithBuiltins compiler for code that calls the builtins of table
+func NewWithBuiltins(table object.BuiltinTable) *Compiler {
+	return NewWithState(NewBuiltinSymbolTable(table), []object.Object{})
+}
+
+//NewWithState compiler that carries on from an earlier one's symbol
+//table and constants, so globals survive between REPL lines
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	mainScope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+
+	return &Compiler{
+		constants:   constants,
+		symbolTable: s,
+		scopes:      []CompilationScope{mainScope},
+		scopeIndex:  0,
+	}
+}
+
+//SymbolTable the compiler's top level symbol table
+func (c *Compiler) SymbolTable() *SymbolTable {
+	return c.symbolTable.Root()
+}
+
+//Compile lower node and everything under it
+func (c *Compiler) Compile(node ast.Node) error {
+	previous := c.pos
+	if pos := node.Pos(); pos.IsValid() {
+		c.pos = pos
+	}
+	defer func() { c.pos = previous }()
+
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			err := c.Compile(s)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.producesValue = false
+		if len(node.Statements) > 0 {
+			_, c.producesValue = node.Statements[len(node.Statements)-1].(*ast.ExpressionStatement)
+		}
+	case *ast.ExpressionStatement:
+		err := c.Compile(node.Expression)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpPop)
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			err := c.Compile(s)
+			if err != nil {
+				return err
+			}
+		}
+	case *ast.InfixExpression:
+		return c.compileInfixExpression(node)
+	case *ast.PrefixExpression:
+		err := c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		case "~":
+			c.emit(code.OpBitNot)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+	case *ast.IntegerLiteral:
+		integer := &object.Integer{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(integer))
+	case *ast.BigIntegerLiteral:
+		integer := &object.BigInteger{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(integer))
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+	case *ast.InterpolatedString:
+		return c.compileInterpolatedString(node)
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(node)
+	case *ast.IndexAssignExpression:
+		return c.compileIndexAssignExpression(node)
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+	case *ast.WhileExpression:
+		return c.compileWhileExpression(node)
+	case *ast.ForExpression:
+		return c.compileForExpression(node)
+	case *ast.MatchExpression:
+		return c.compileMatchExpression(node)
+	case *ast.LetStatement:
+		if node.Pattern != nil {
+			err := c.Compile(node.Value)
+			if err != nil {
+				return err
+			}
+
+			return c.compilePattern(node.Pattern, 0, nil)
+		}
+
+		var err error
+		if fn, ok := node.Value.(*ast.FunctionLiteral); ok {
+			err = c.compileFunctionLiteral(fn, node.Name.Value)
+		} else {
+			err = c.Compile(node.Value)
+		}
+		if err != nil {
+			return err
+		}
+
+		symbol := c.symbolTable.Define(node.Name.Value)
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpSetGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+	case *ast.Identifier:
+		c.loadSymbol(c.resolve(node.Value))
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			err := c.Compile(el)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpArray, len(node.Elements))
+	case *ast.HashLiteral:
+		keys := []ast.Expression{}
+		for k := range node.Pairs {
+			keys = append(keys, k)
+		}
+
+		// Map order is random, sort so the output is the same every time
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+
+		for _, k := range keys {
+			err := c.Compile(k)
+			if err != nil {
+				return err
+			}
+
+			err = c.Compile(node.Pairs[k])
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpHash, len(node.Pairs)*2)
+	case *ast.IndexExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(node.Index)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpIndex)
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node, "")
+	case *ast.ReturnStatement:
+		err := c.Compile(node.ReturnValue)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpReturnValue)
+	case *ast.BreakStatement:
+		return c.compileLoopControl(node.Label, true)
+	case *ast.ContinueStatement:
+		return c.compileLoopControl(node.Label, false)
+	case *ast.CallExpression:
+		err := c.Compile(node.Function)
+		if err != nil {
+			return err
+		}
+
+		for _, a := range node.Arguments {
+			err := c.Compile(a)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpCall, len(node.Arguments))
+	case *ast.BadExpression, *ast.BadStatement:
+		return fmt.Errorf("cannot compile malformed code at %s", node.Pos())
+	default:
+		return fmt.Errorf("cannot compile %T", node)
+	}
+
+	return nil
+}
+
+//Bytecode the result of compiling
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions:  c.currentInstructions(),
+		Constants:     c.constants,
+		SourceMap:     c.scopes[c.scopeIndex].sourceMap,
+		GlobalNames:   c.symbolTable.Root().Names(),
+		BuiltinNames:  c.symbolTable.Root().BuiltinNames(),
+		LocalNames:    c.symbolTable.Root().LocalNames(),
+		ProducesValue: c.producesValue,
+	}
+}
+
+var infixOpcodes = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"**": code.OpPow,
+	"&":  code.OpBitAnd,
+	"|":  code.OpBitOr,
+	"^":  code.OpBitXor,
+	"<<": code.OpShiftLeft,
+	">>": code.OpShiftRight,
+	">":  code.OpGreaterThan,
+	"<":  code.OpLessThan,
+	">=": code.OpGreaterEqual,
+	"<=": code.OpLessEqual,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+}
+
+func (c *Compiler) compileInfixExpression(node *ast.InfixExpression) error {
+	if node.Operator == "&&" || node.Operator == "||" {
+		return c.compileLogicalExpression(node)
+	}
+
+	op, ok := infixOpcodes[node.Operator]
+	if !ok {
+		return fmt.Errorf("unknown operator %s", node.Operator)
+	}
+
+	err := c.Compile(node.Left)
+	if err != nil {
+		return err
+	}
+
+	err = c.Compile(node.Right)
+	if err != nil {
+		return err
+	}
+
+	c.emit(op)
+
+	return nil
+}
+
+//compileLogicalExpression && and || as jumps, so the right side is only
+//run when the left doesn't decide the result.  Both push a boolean
+//compileInterpolatedString push the parts and join them with
+//OpInterpolate, leaving out empty text
+func (c *Compiler) compileInterpolatedString(node *ast.InterpolatedString) error {
+	parts := 0
+
+	for i, part := range node.Parts {
+		if i%2 == 0 && part.(*ast.StringLiteral).Value == "" {
+			continue
+		}
+
+		if err := c.Compile(part); err != nil {
+			return err
+		}
+		parts++
+	}
+
+	c.emit(code.OpInterpolate, parts)
+
+	return nil
+}
+
+//compileAssignExpression leave the value on the stack as well as
+//storing it, an assignment is an expression
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	name := node.Name.Value
+	symbol := c.resolve(name)
+
+	if symbol.Scope == FunctionScope {
+		// Inside a function its own name means the function, but the
+		// binding being assigned is the one it's being let to.  That
+		// can only be reached from inside when it's a global
+		outer, ok := c.symbolTable.Outer.Resolve(name)
+		if !ok && c.symbolTable.Outer == c.symbolTable.Root() && len(c.symbolTable.Outer.blocks) == 0 {
+			outer, ok = c.symbolTable.Outer.define(name), true
+		}
+		if !ok || outer.Scope != GlobalScope {
+			return fmt.Errorf("cannot assign to %s inside itself", name)
+		}
+		symbol = outer
+	}
+
+	if node.Operator != "=" {
+		c.loadSymbol(symbol)
+	}
+
+	err := c.compileAssignedValue(node.Operator, node.Value)
+	if err != nil {
+		return err
+	}
+
+	switch symbol.Scope {
+	case GlobalScope:
+		c.emit(code.OpAssignGlobal, symbol.Index)
+	case LocalScope:
+		c.emit(code.OpAssignLocal, symbol.Index)
+	case FreeScope:
+		c.emit(code.OpAssignFree, symbol.Index)
+	default:
+		return fmt.Errorf("cannot assign to builtin %s", name)
+	}
+
+	return nil
+}
+
+//compileIndexAssignExpression the indexed value and index are worked
+//out once, even for a compound assignment
+func (c *Compiler) compileIndexAssignExpression(node *ast.IndexAssignExpression) error {
+	err := c.Compile(node.Target.Left)
+	if err != nil {
+		return err
+	}
+
+	err = c.Compile(node.Target.Index)
+	if err != nil {
+		return err
+	}
+
+	if node.Operator != "=" {
+		c.emit(code.OpDup, 2)
+		c.emit(code.OpIndex)
+	}
+
+	err = c.compileAssignedValue(node.Operator, node.Value)
+	if err != nil {
+		return err
+	}
+
+	c.emit(code.OpSetIndex)
+
+	return nil
+}
+
+//compileAssignedValue the value for operator, for a compound one
+//combined with the current value already on the stack
+func (c *Compiler) compileAssignedValue(operator string, value ast.Expression) error {
+	err := c.Compile(value)
+	if err != nil {
+		return err
+	}
+
+	if operator == "=" {
+		return nil
+	}
+
+	op, ok := infixOpcodes[strings.TrimSuffix(operator, "=")]
+	if !ok {
+		return fmt.Errorf("unknown operator %s", operator)
+	}
+	c.emit(op)
+
+	return nil
+}
+
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	err := c.Compile(node.Left)
+	if err != nil {
+		return err
+	}
+
+	// Bogus offsets, patched once the targets are known
+	var decided int
+	if node.Operator == "&&" {
+		decided = c.emit(code.OpJumpNotTruthy, 9999)
+	} else {
+		undecided := c.emit(code.OpJumpNotTruthy, 9999)
+		c.emit(code.OpTrue)
+		decided = c.emit(code.OpJump, 9999)
+		c.changeOperand(undecided, len(c.currentInstructions()))
+	}
+
+	err = c.Compile(node.Right)
+	if err != nil {
+		return err
+	}
+
+	isFalse := c.emit(code.OpJumpNotTruthy, 9999)
+	c.emit(code.OpTrue)
+	end := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(isFalse, len(c.currentInstructions()))
+	if node.Operator == "&&" {
+		c.changeOperand(decided, len(c.currentInstructions()))
+	}
+	c.emit(code.OpFalse)
+
+	c.changeOperand(end, len(c.currentInstructions()))
+	if node.Operator == "||" {
+		c.changeOperand(decided, len(c.currentInstructions()))
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	err := c.Compile(node.Condition)
+	if err != nil {
+		return err
+	}
+
+	// Bogus offset, patched once the consequence is compiled
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	err = c.compileBlockValue(node.Consequence)
+	if err != nil {
+		return err
+	}
+
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else {
+		err := c.compileBlockValue(node.Alternative)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+//compileBlockValue compiles a block that leaves its value on the stack,
+//null when it doesn't end with an expression
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	err := c.Compile(block)
+	if err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+
+	return nil
+}
+
+//compileWhileExpression the loop's value is how many times the
+//condition was tested, counted under the condition on the stack
+func (c *Compiler) compileWhileExpression(node *ast.WhileExpression) error {
+	c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: 0}))
+	c.emit(code.OpLoopEnter)
+
+	loopStart := len(c.currentInstructions())
+
+	err := c.Compile(node.Condition)
+	if err != nil {
+		return err
+	}
+
+	testPos := c.emit(code.OpWhileTest, 9999)
+
+	l := c.enterLoop(node.Label, loopStart)
+	err = c.Compile(node.Body)
+	if err != nil {
+		return err
+	}
+	c.leaveLoop()
+
+	c.emit(code.OpJump, loopStart)
+
+	end := len(c.currentInstructions())
+	c.changeOperand(testPos, end)
+	for _, pos := range l.breaks {
+		c.changeOperand(pos, end)
+	}
+
+	c.emit(code.OpLoopExit)
+
+	return nil
+}
+
+//compileForExpression keeps the iterator on the stack while the loop
+//runs.  The body is a block whose locals are cleared each time round
+func (c *Compiler) compileForExpression(node *ast.ForExpression) error {
+	err := c.Compile(node.Iterable)
+	if err != nil {
+		return err
+	}
+
+	c.emit(code.OpIterate)
+	c.emit(code.OpLoopEnter)
+
+	c.symbolTable.EnterBlock()
+	first := c.symbolTable.nextLocal()
+
+	loopStart := c.emit(code.OpFreshLocals, 0, 0)
+
+	count := 1
+	if node.Key != nil {
+		count = 2
+	}
+	nextPos := c.emit(code.OpIterNext, 9999, count)
+
+	value := c.symbolTable.Define(node.Value.Value)
+	c.emit(code.OpSetLocal, value.Index)
+	if node.Key != nil {
+		key := c.symbolTable.Define(node.Key.Value)
+		c.emit(code.OpSetLocal, key.Index)
+	}
+
+	l := c.enterLoop(node.Label, loopStart)
+	err = c.Compile(node.Body)
+	if err != nil {
+		return err
+	}
+	c.leaveLoop()
+
+	c.emit(code.OpJump, loopStart)
+
+	end := len(c.currentInstructions())
+	c.replaceInstruction(nextPos, code.Make(code.OpIterNext, end, count))
+	for _, pos := range l.breaks {
+		c.changeOperand(pos, end)
+	}
+
+	c.emit(code.OpLoopExit)
+	c.emit(code.OpPop)
+	c.emit(code.OpNull)
+
+	c.replaceInstruction(loopStart, code.Make(code.OpFreshLocals, first, c.symbolTable.nextLocal()-first))
+	c.symbolTable.LeaveBlock()
+
+	return nil
+}
+
+//compileMatchExpression keeps the value being matched on the stack
+//while the arms try it.  Each arm is a block for the names its pattern
+//binds.  A pattern that fails part way through jumps into the arm's
+//ladder of pops, at the rung that takes off what it had pushed, and the
+//ladder ends at the next arm
+func (c *Compiler) compileMatchExpression(node *ast.MatchExpression) error {
+	err := c.Compile(node.Value)
+	if err != nil {
+		return err
+	}
+
+	ends := []int{}
+	for _, arm := range node.Arms {
+		c.symbolTable.EnterBlock()
+		first := c.symbolTable.nextLocal()
+		freshPos := c.emit(code.OpFreshLocals, 0, 0)
+
+		failures := map[int][]int{}
+
+		c.emit(code.OpDup, 1)
+		err := c.compilePattern(arm.Pattern, 1, failures)
+		if err != nil {
+			return err
+		}
+
+		if arm.Guard != nil {
+			err := c.Compile(arm.Guard)
+			if err != nil {
+				return err
+			}
+			pos := c.emit(code.OpJumpNotTruthy, 9999)
+			failures[0] = append(failures[0], pos)
+		}
+
+		c.emit(code.OpPop)
+		err = c.Compile(arm.Body)
+		if err != nil {
+			return err
+		}
+		ends = append(ends, c.emit(code.OpJump, 9999))
+
+		c.compileFailureLadder(failures)
+
+		c.replaceInstruction(freshPos, code.Make(code.OpFreshLocals, first, c.symbolTable.nextLocal()-first))
+		c.symbolTable.LeaveBlock()
+	}
+
+	c.emit(code.OpNoMatch)
+
+	for _, pos := range ends {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+
+	return nil
+}
+
+//compilePattern match the value on top of the stack against pattern,
+//taking it off.  depth is how many values are on the stack above the
+//one being matched by the whole match, counting this one.  The jumps
+//taken when the value doesn't match are added to failures by the depth
+//they leave the stack at.  Without failures, for a let, a value that
+//doesn't match is an error instead
+func (c *Compiler) compilePattern(pattern ast.Pattern, depth int, failures map[int][]int) error {
+	strict := failures == nil
+
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		c.emit(code.OpPop)
+	case *ast.BindingPattern:
+		symbol := c.symbolTable.Define(pattern.Name.Value)
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpSetGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+	case *ast.DefaultPattern:
+		return c.compilePattern(pattern.Pattern, depth, failures)
+	case *ast.LiteralPattern:
+		if strict {
+			return fmt.Errorf("literal pattern %s in a let", pattern)
+		}
+
+		err := c.Compile(pattern.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpEqual)
+		c.patternFailure(depth-1, failures)
+	case *ast.ArrayPattern:
+		elements, rest := pattern.SplitRest()
+
+		hasRest := 0
+		if rest != nil {
+			hasRest = 1
+		}
+
+		if strict {
+			c.emit(code.OpDestructureArray, len(elements), hasRest)
+		} else {
+			c.emit(code.OpMatchArray, len(elements), hasRest)
+			c.patternFailure(depth, failures)
+		}
+
+		for i, element := range elements {
+			c.emit(code.OpDup, 1)
+			c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: int64(i)}))
+
+			err := c.compilePatternKey(element, depth+1, failures)
+			if err != nil {
+				return err
+			}
+		}
+
+		if rest != nil {
+			c.emit(code.OpRest, len(elements))
+			return c.compilePattern(rest.Pattern, depth, failures)
+		}
+
+		c.emit(code.OpPop)
+	case *ast.HashPattern:
+		if strict {
+			c.emit(code.OpDestructureHash)
+		} else {
+			c.emit(code.OpMatchHash)
+			c.patternFailure(depth, failures)
+		}
+
+		for _, pair := range pattern.Pairs {
+			c.emit(code.OpDup, 1)
+			err := c.Compile(pair.Key)
+			if err != nil {
+				return err
+			}
+
+			err = c.compilePatternKey(pair.Value, depth+1, failures)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpPop)
+	default:
+		return fmt.Errorf("unknown pattern %T", pattern)
+	}
+
+	return nil
+}
+
+//compilePatternKey look up the key on top of the stack in the array or
+//hash under it and match what's there against pattern.  A key that
+//isn't there takes pattern's default if it has one, otherwise the
+//match fails
+func (c *Compiler) compilePatternKey(pattern ast.Pattern, depth int, failures map[int][]int) error {
+	dp, ok := pattern.(*ast.DefaultPattern)
+	switch {
+	case ok:
+		c.emit(code.OpMatchKey)
+		missing := c.emit(code.OpJumpNotTruthy, 9999)
+		found := c.emit(code.OpJump, 9999)
+
+		c.changeOperand(missing, len(c.currentInstructions()))
+		c.emit(code.OpPop)
+		err := c.Compile(dp.Default)
+		if err != nil {
+			return err
+		}
+
+		c.changeOperand(found, len(c.currentInstructions()))
+	case failures == nil:
+		c.emit(code.OpDestructureKey)
+	default:
+		c.emit(code.OpMatchKey)
+		c.patternFailure(depth, failures)
+	}
+
+	return c.compilePattern(pattern, depth, failures)
+}
+
+//patternFailure jump to the failure ladder at depth if the top of the
+//stack isn't truthy
+func (c *Compiler) patternFailure(depth int, failures map[int][]int) {
+	pos := c.emit(code.OpJumpNotTruthy, 9999)
+	failures[depth] = append(failures[depth], pos)
+}
+
+//compileFailureLadder a pop for each depth a failed pattern can leave
+//the stack at, the jumps from each depth landing on their rung
+func (c *Compiler) compileFailureLadder(failures map[int][]int) {
+	deepest := 0
+	for depth := range failures {
+		if depth > deepest {
+			deepest = depth
+		}
+	}
+
+	for depth := deepest; depth >= 0; depth-- {
+		for _, pos := range failures[depth] {
+			c.changeOperand(pos, len(c.currentInstructions()))
+		}
+
+		if depth > 0 {
+			c.emit(code.OpPop)
+		}
+	}
+}
+
+func (c *Compiler) enterLoop(label *ast.Identifier, start int) *loop {
+	l := &loop{start: start}
+	if label != nil {
+		l.label = label.Value
+	}
+
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = append(scope.loops, l)
+
+	return l
+}
+
+func (c *Compiler) leaveLoop() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+}
+
+//compileLoopControl a break, or a continue when isBreak is false, to
+//the loop with label or the innermost one
+func (c *Compiler) compileLoopControl(label *ast.Identifier, isBreak bool) error {
+	loops := c.scopes[c.scopeIndex].loops
+
+	target := len(loops) - 1
+	for label != nil && target >= 0 && loops[target].label != label.Value {
+		target--
+	}
+	if target < 0 {
+		return fmt.Errorf("break or continue outside a loop")
+	}
+
+	c.emit(code.OpUnwind, len(loops)-1-target)
+
+	if isBreak {
+		pos := c.emit(code.OpJump, 9999)
+		loops[target].breaks = append(loops[target].breaks, pos)
+	} else {
+		c.emit(code.OpJump, loops[target].start)
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral, name string) error {
+	c.enterScope()
+
+	if name != "" {
+		c.symbolTable.DefineFunctionName(name)
+	}
+
+	for _, p := range node.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+
+	err := c.Compile(node.Body)
+	if err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numDefinitions
+	localNames := c.symbolTable.Names()
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
+	instructions := c.leaveScope()
+
+	for _, s := range freeSymbols {
+		c.captureSymbol(s)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Name:          name,
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		SourceMap:     sourceMap,
+		LocalNames:    localNames,
+	}
+
+	fnIndex := c.addConstant(compiledFn)
+	c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+
+	return nil
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	scope := &c.scopes[c.scopeIndex]
+	posNewInstruction := len(scope.instructions)
+
+	last := len(scope.sourceMap) - 1
+	if c.pos.IsValid() && (last < 0 || scope.sourceMap[last].Pos != c.pos) {
+		scope.sourceMap = append(scope.sourceMap, code.SourceMapEntry{Offset: posNewInstruction, Pos: c.pos})
+	}
+
+	scope.instructions = append(scope.instructions, ins...)
+
+	return posNewInstruction
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	scope := &c.scopes[c.scopeIndex]
+	last := scope.lastInstruction
+
+	scope.instructions = scope.instructions[:last.Position]
+	scope.lastInstruction = scope.previousInstruction
+
+	for len(scope.sourceMap) > 0 && scope.sourceMap[len(scope.sourceMap)-1].Offset >= last.Position {
+		scope.sourceMap = scope.sourceMap[:len(scope.sourceMap)-1]
+	}
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
+
+//resolve the symbol for name.  Like the evaluator, names are looked up
+//when the code runs, so one that isn't defined yet may be a global
+//defined further down.  If it never is the VM reports it as not found
+func (c *Compiler) resolve(name string) Symbol {
+	symbol, ok := c.symbolTable.Resolve(name)
+	if !ok {
+		c.symbolTable.Root().define(name)
+		symbol, _ = c.symbolTable.Resolve(name)
+	}
+
+	return symbol
+}
+
+//captureSymbol push s for a closure being made to capture, locals and
+//free variables go by their cell so assignments to them are shared
+func (c *Compiler) captureSymbol(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.OpCaptureLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpCaptureFree, s.Index)
+	default:
+		c.loadSymbol(s)
+	}
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
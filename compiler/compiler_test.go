@@ -0,0 +1,965 @@
+package compiler
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/code"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"reflect"
+	"testing"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1.5 * 2",
+			expectedConstants: []interface{}{1.5, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMul),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 < 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLessThan),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "-1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "true && false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 12),
+				// 0004
+				code.Make(code.OpFalse),
+				// 0005
+				code.Make(code.OpJumpNotTruthy, 12),
+				// 0008
+				code.Make(code.OpTrue),
+				// 0009
+				code.Make(code.OpJump, 13),
+				// 0012
+				code.Make(code.OpFalse),
+				// 0013
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "false || true",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpFalse),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 8),
+				// 0004
+				code.Make(code.OpTrue),
+				// 0005
+				code.Make(code.OpJump, 17),
+				// 0008
+				code.Make(code.OpTrue),
+				// 0009
+				code.Make(code.OpJumpNotTruthy, 16),
+				// 0012
+				code.Make(code.OpTrue),
+				// 0013
+				code.Make(code.OpJump, 17),
+				// 0016
+				code.Make(code.OpFalse),
+				// 0017
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "if (true) { 10 }; 3333;",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "if (true) { let a = 1; }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 14),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpSetGlobal, 0),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpJump, 15),
+				// 0014
+				code.Make(code.OpNull),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestWhileExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "while (x) { x }",
+			expectedConstants: []interface{}{0},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpLoopEnter),
+				// 0004
+				code.Make(code.OpGetGlobal, 0),
+				// 0007
+				code.Make(code.OpWhileTest, 17),
+				// 0010
+				code.Make(code.OpGetGlobal, 0),
+				// 0013
+				code.Make(code.OpPop),
+				// 0014
+				code.Make(code.OpJump, 4),
+				// 0017
+				code.Make(code.OpLoopExit),
+				// 0018
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "while (x) { break }",
+			expectedConstants: []interface{}{0},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpLoopEnter),
+				// 0004
+				code.Make(code.OpGetGlobal, 0),
+				// 0007
+				code.Make(code.OpWhileTest, 18),
+				// 0010
+				code.Make(code.OpUnwind, 0),
+				// 0012
+				code.Make(code.OpJump, 18),
+				// 0015
+				code.Make(code.OpJump, 4),
+				// 0018
+				code.Make(code.OpLoopExit),
+				// 0019
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "outer: while (x) { while (x) { continue outer } }",
+			expectedConstants: []interface{}{0, 0},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpLoopEnter),
+				// 0004
+				code.Make(code.OpGetGlobal, 0),
+				// 0007
+				code.Make(code.OpWhileTest, 33),
+				// 0010
+				code.Make(code.OpConstant, 1),
+				// 0013
+				code.Make(code.OpLoopEnter),
+				// 0014
+				code.Make(code.OpGetGlobal, 0),
+				// 0017
+				code.Make(code.OpWhileTest, 28),
+				// 0020
+				code.Make(code.OpUnwind, 1),
+				// 0022
+				code.Make(code.OpJump, 4),
+				// 0025
+				code.Make(code.OpJump, 14),
+				// 0028
+				code.Make(code.OpLoopExit),
+				// 0029
+				code.Make(code.OpPop),
+				// 0030
+				code.Make(code.OpJump, 4),
+				// 0033
+				code.Make(code.OpLoopExit),
+				// 0034
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestForExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "for (x in [1]) { x }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpArray, 1),
+				// 0006
+				code.Make(code.OpIterate),
+				// 0007
+				code.Make(code.OpLoopEnter),
+				// 0008
+				code.Make(code.OpFreshLocals, 0, 1),
+				// 0011
+				code.Make(code.OpIterNext, 23, 1),
+				// 0015
+				code.Make(code.OpSetLocal, 0),
+				// 0017
+				code.Make(code.OpGetLocal, 0),
+				// 0019
+				code.Make(code.OpPop),
+				// 0020
+				code.Make(code.OpJump, 8),
+				// 0023
+				code.Make(code.OpLoopExit),
+				// 0024
+				code.Make(code.OpPop),
+				// 0025
+				code.Make(code.OpNull),
+				// 0026
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "for (k, v in h) { let s = k; break }",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpGetGlobal, 0),
+				// 0003
+				code.Make(code.OpIterate),
+				// 0004
+				code.Make(code.OpLoopEnter),
+				// 0005
+				code.Make(code.OpFreshLocals, 0, 3),
+				// 0008
+				code.Make(code.OpIterNext, 28, 2),
+				// 0012
+				code.Make(code.OpSetLocal, 0),
+				// 0014
+				code.Make(code.OpSetLocal, 1),
+				// 0016
+				code.Make(code.OpGetLocal, 1),
+				// 0018
+				code.Make(code.OpSetLocal, 2),
+				// 0020
+				code.Make(code.OpUnwind, 0),
+				// 0022
+				code.Make(code.OpJump, 28),
+				// 0025
+				code.Make(code.OpJump, 5),
+				// 0028
+				code.Make(code.OpLoopExit),
+				// 0029
+				code.Make(code.OpPop),
+				// 0030
+				code.Make(code.OpNull),
+				// 0031
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "match (x) { 1 => 2, _ => 3 }",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpGetGlobal, 0),
+				// 0003
+				code.Make(code.OpFreshLocals, 0, 0),
+				// 0006
+				code.Make(code.OpDup, 1),
+				// 0008
+				code.Make(code.OpConstant, 0),
+				// 0011
+				code.Make(code.OpEqual),
+				// 0012
+				code.Make(code.OpJumpNotTruthy, 22),
+				// 0015
+				code.Make(code.OpPop),
+				// 0016
+				code.Make(code.OpConstant, 1),
+				// 0019
+				code.Make(code.OpJump, 36),
+				// 0022
+				code.Make(code.OpFreshLocals, 0, 0),
+				// 0025
+				code.Make(code.OpDup, 1),
+				// 0027
+				code.Make(code.OpPop),
+				// 0028
+				code.Make(code.OpPop),
+				// 0029
+				code.Make(code.OpConstant, 2),
+				// 0032
+				code.Make(code.OpJump, 36),
+				// 0035
+				code.Make(code.OpNoMatch),
+				// 0036
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "match (x) { [a] if a => a }",
+			expectedConstants: []interface{}{0},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpGetGlobal, 0),
+				// 0003
+				code.Make(code.OpFreshLocals, 0, 1),
+				// 0006
+				code.Make(code.OpDup, 1),
+				// 0008
+				code.Make(code.OpMatchArray, 1, 0),
+				// 0012
+				code.Make(code.OpJumpNotTruthy, 39),
+				// 0015
+				code.Make(code.OpDup, 1),
+				// 0017
+				code.Make(code.OpConstant, 0),
+				// 0020
+				code.Make(code.OpMatchKey),
+				// 0021
+				code.Make(code.OpJumpNotTruthy, 38),
+				// 0024
+				code.Make(code.OpSetLocal, 0),
+				// 0026
+				code.Make(code.OpPop),
+				// 0027
+				code.Make(code.OpGetLocal, 0),
+				// 0029
+				code.Make(code.OpJumpNotTruthy, 40),
+				// 0032
+				code.Make(code.OpPop),
+				// 0033
+				code.Make(code.OpGetLocal, 0),
+				// 0035
+				code.Make(code.OpJump, 41),
+				// 0038
+				code.Make(code.OpPop),
+				// 0039
+				code.Make(code.OpPop),
+				// 0040
+				code.Make(code.OpNoMatch),
+				// 0041
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestDestructuringLet(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let [a, ...b] = [1];",
+			expectedConstants: []interface{}{1, 0},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpArray, 1),
+				// 0006
+				code.Make(code.OpDestructureArray, 1, 1),
+				// 0010
+				code.Make(code.OpDup, 1),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpDestructureKey),
+				// 0016
+				code.Make(code.OpSetGlobal, 0),
+				// 0019
+				code.Make(code.OpRest, 1),
+				// 0022
+				code.Make(code.OpSetGlobal, 1),
+			},
+		},
+		{
+			input:             "let {\"a\": a = 2} = {};",
+			expectedConstants: []interface{}{"a", 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpHash, 0),
+				// 0003
+				code.Make(code.OpDestructureHash),
+				// 0004
+				code.Make(code.OpDup, 1),
+				// 0006
+				code.Make(code.OpConstant, 0),
+				// 0009
+				code.Make(code.OpMatchKey),
+				// 0010
+				code.Make(code.OpJumpNotTruthy, 16),
+				// 0013
+				code.Make(code.OpJump, 20),
+				// 0016
+				code.Make(code.OpPop),
+				// 0017
+				code.Make(code.OpConstant, 1),
+				// 0020
+				code.Make(code.OpSetGlobal, 0),
+				// 0023
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let one = 1; let one = one + 1; one;",
+			expectedConstants: []interface{}{1, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "later; let later = 1;",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn(a) { fn(b) { a + b } }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(a) { fn() { fn() { a = 1 } } }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpAssignFree, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpCaptureFree, 0),
+					code.Make(code.OpClosure, 1, 1),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 2, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `let countDown = fn(x) { countDown(x - 1); };`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestAssignments(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `let x = 1; x = 2; x += 3;`,
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAssignGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.OpAssignGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(x) { x -= 1 }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpAssignLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `let a = [1]; a[0] = 2; a[0] *= 3;`,
+			expectedConstants: []interface{}{1, 0, 2, 0, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpDup, 2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpMul),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestBuiltins(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `len([]); push([], 1);`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetBuiltin, 4),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `"a${1}b${2}"`,
+			expectedConstants: []interface{}{"a", 1, "b", 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpInterpolate, 4),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestSourceMap(t *testing.T) {
+	program := parse("let a = 1;\na + true")
+
+	compiler := New()
+	if err := compiler.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := compiler.Bytecode()
+
+	// OpConstant 0, OpSetGlobal 0, OpGetGlobal 0, OpTrue, OpAdd, OpPop
+	tests := []struct {
+		offset   int
+		expected string
+	}{
+		{0, "1:9"},
+		{3, "1:1"},
+		{6, "2:1"},
+		{9, "2:5"},
+		{10, "2:1"},
+	}
+
+	for _, tt := range tests {
+		pos := bytecode.SourceMap.Lookup(tt.offset)
+		if pos.String() != tt.expected {
+			t.Errorf("instruction at %d maps to %s, wanted %s", tt.offset, pos, tt.expected)
+		}
+	}
+}
+
+func TestSymbolTableResolveFree(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("c")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("e")
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0},
+		{Name: "c", Scope: FreeScope, Index: 0},
+		{Name: "e", Scope: LocalScope, Index: 0},
+	}
+
+	for _, sym := range expected {
+		result, ok := secondLocal.Resolve(sym.Name)
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+
+	if len(secondLocal.FreeSymbols) != 1 || secondLocal.FreeSymbols[0].Scope != LocalScope {
+		t.Errorf("c should be captured from the enclosing locals, got %+v", secondLocal.FreeSymbols)
+	}
+
+	if again := secondLocal.Define("e"); again.Index != 0 {
+		t.Errorf("redefining e should reuse its slot, got %+v", again)
+	}
+}
+
+func TestSymbolTableBlocks(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	global.EnterBlock()
+	inner := global.Define("a")
+	b := global.Define("b")
+
+	if inner != (Symbol{Name: "a", Scope: LocalScope, Index: 0}) {
+		t.Errorf("a in the block should be a new local, got %+v", inner)
+	}
+
+	if b != (Symbol{Name: "b", Scope: LocalScope, Index: 1}) {
+		t.Errorf("b in the block should be a local, got %+v", b)
+	}
+
+	if again := global.Define("a"); again != inner {
+		t.Errorf("redefining a in the block should reuse its slot, got %+v", again)
+	}
+
+	fn := NewEnclosedSymbolTable(global)
+	if free, _ := fn.Resolve("a"); free.Scope != FreeScope || fn.FreeSymbols[0] != inner {
+		t.Errorf("a function in the block should capture the block's a, got %+v", free)
+	}
+
+	global.LeaveBlock()
+
+	if a, _ := global.Resolve("a"); a != (Symbol{Name: "a", Scope: GlobalScope, Index: 0}) {
+		t.Errorf("a should be the global again after the block, got %+v", a)
+	}
+
+	if _, ok := global.Resolve("b"); ok {
+		t.Errorf("b shouldn't be visible after the block")
+	}
+
+	if names := global.LocalNames(); len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Errorf("wrong local names %v", names)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	local.Define("x")
+	local.EnterBlock()
+	if x := local.Define("x"); x != (Symbol{Name: "x", Scope: LocalScope, Index: 1}) {
+		t.Errorf("x in a function's block should get the next slot, got %+v", x)
+	}
+	local.LeaveBlock()
+
+	if x, _ := local.Resolve("x"); x.Index != 0 {
+		t.Errorf("x should be the function's own local after the block, got %+v", x)
+	}
+}
+
+func TestLink(t *testing.T) {
+	first := New()
+	if err := first.Compile(parse("let a = 1; let b = 2;")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	second := New()
+	if err := second.Compile(parse("let c = fn() { b }; a + 3")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	symbols := first.SymbolTable()
+	linked, err := Link(second.Bytecode(), symbols, first.Bytecode().Constants)
+	if err != nil {
+		t.Fatalf("link failed: %s", err)
+	}
+
+	expected := []code.Instructions{
+		code.Make(code.OpClosure, 2, 0),
+		code.Make(code.OpSetGlobal, 2),
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpConstant, 3),
+		code.Make(code.OpAdd),
+		code.Make(code.OpPop),
+	}
+	if err := testInstructions(expected, linked.Instructions); err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+
+	fn := linked.Constants[2].(*object.CompiledFunction)
+	expected = []code.Instructions{
+		code.Make(code.OpGetGlobal, 1),
+		code.Make(code.OpReturnValue),
+	}
+	if err := testInstructions(expected, fn.Instructions); err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+
+	if !reflect.DeepEqual(linked.GlobalNames, []string{"a", "b", "c"}) {
+		t.Errorf("wrong global names. got=%v", linked.GlobalNames)
+	}
+
+	original := second.Bytecode().Constants[0].(*object.CompiledFunction)
+	expected = []code.Instructions{
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpReturnValue),
+	}
+	if err := testInstructions(expected, original.Instructions); err != nil {
+		t.Errorf("linking changed the original bytecode: %s", err)
+	}
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+
+		err = testInstructions(tt.expectedInstructions, bytecode.Instructions)
+		if err != nil {
+			t.Fatalf("%s: testInstructions failed: %s", tt.input, err)
+		}
+
+		err = testConstants(tt.expectedConstants, bytecode.Constants)
+		if err != nil {
+			t.Fatalf("%s: testConstants failed: %s", tt.input, err)
+		}
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+
+	return out
+}
+
+func testInstructions(expected []code.Instructions, actual code.Instructions) error {
+	concatted := concatInstructions(expected)
+
+	if len(actual) != len(concatted) {
+		return fmt.Errorf("wrong instructions length.\nwant=%q\ngot =%q", concatted, actual)
+	}
+
+	for i, ins := range concatted {
+		if actual[i] != ins {
+			return fmt.Errorf("wrong instruction at %d.\nwant=%q\ngot =%q", i, concatted, actual)
+		}
+	}
+
+	return nil
+}
+
+func testConstants(expected []interface{}, actual []object.Object) error {
+	if len(expected) != len(actual) {
+		return fmt.Errorf("wrong number of constants. got=%d, want=%d", len(actual), len(expected))
+	}
+
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			integer, ok := actual[i].(*object.Integer)
+			if !ok || integer.Value != int64(constant) {
+				return fmt.Errorf("constant %d - not Integer %d. got=%T (%+v)", i, constant, actual[i], actual[i])
+			}
+		case float64:
+			float, ok := actual[i].(*object.Float)
+			if !ok || float.Value != constant {
+				return fmt.Errorf("constant %d - not Float %g. got=%T (%+v)", i, constant, actual[i], actual[i])
+			}
+		case string:
+			str, ok := actual[i].(*object.String)
+			if !ok || str.Value != constant {
+				return fmt.Errorf("constant %d - not String %q. got=%T (%+v)", i, constant, actual[i], actual[i])
+			}
+		case []code.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				return fmt.Errorf("constant %d - not a function: %T", i, actual[i])
+			}
+
+			err := testInstructions(constant, fn.Instructions)
+			if err != nil {
+				return fmt.Errorf("constant %d - testInstructions failed: %s", i, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package compiler
+
+import (
+	"fmt"
+	"monkey/code"
+	"monkey/object"
+)
+
+//Link relocates bytecode that was compiled on its own so it can run
+//after code compiled into s and constants.  Its constants are appended
+//to constants and its globals and builtins are bound to those of s with
+//the same names, as if it had been compiled with NewWithState
+func Link(bytecode *Bytecode, s *SymbolTable, constants []object.Object) (*Bytecode, error) {
+	s = s.Root()
+
+	builtins := make([]int, len(bytecode.BuiltinNames))
+	for i, name := range bytecode.BuiltinNames {
+		builtins[i] = -1
+		for j, available := range s.builtinNames {
+			if available == name {
+				builtins[i] = j
+			}
+		}
+	}
+
+	globals := make([]int, len(bytecode.GlobalNames))
+	for i, name := range bytecode.GlobalNames {
+		globals[i] = s.Define(name).Index
+	}
+
+	l := &linker{base: len(constants), globals: globals, builtins: builtins, builtinNames: bytecode.BuiltinNames}
+
+	linked := make([]object.Object, len(constants), len(constants)+len(bytecode.Constants))
+	copy(linked, constants)
+
+	for _, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			relocated := *fn
+
+			var err error
+			relocated.Instructions, err = l.relocate(fn.Instructions)
+			if err != nil {
+				return nil, err
+			}
+
+			constant = &relocated
+		}
+
+		linked = append(linked, constant)
+	}
+
+	instructions, err := l.relocate(bytecode.Instructions)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Bytecode{
+		Instructions:  instructions,
+		Constants:     linked,
+		SourceMap:     bytecode.SourceMap,
+		GlobalNames:   s.Names(),
+		BuiltinNames:  s.BuiltinNames(),
+		LocalNames:    bytecode.LocalNames,
+		ProducesValue: bytecode.ProducesValue,
+	}, nil
+}
+
+type linker struct {
+	base         int
+	globals      []int
+	builtins     []int
+	builtinNames []string
+}
+
+func (l *linker) relocate(ins code.Instructions) (code.Instructions, error) {
+	relocated := make(code.Instructions, len(ins))
+	copy(relocated, ins)
+
+	for i := 0; i < len(relocated); {
+		def, err := code.Lookup(relocated[i])
+		if err != nil {
+			return nil, err
+		}
+
+		op := code.Opcode(relocated[i])
+		operands, read := code.ReadOperands(def, relocated[i+1:])
+
+		switch op {
+		case code.OpConstant, code.OpClosure:
+			operands[0] += l.base
+		case code.OpGetGlobal, code.OpSetGlobal, code.OpAssignGlobal:
+			if operands[0] >= len(l.globals) {
+				return nil, fmt.Errorf("global %d out of range", operands[0])
+			}
+			operands[0] = l.globals[operands[0]]
+		case code.OpGetBuiltin:
+			if operands[0] >= len(l.builtins) {
+				return nil, fmt.Errorf("builtin %d out of range", operands[0])
+			}
+			if l.builtins[operands[0]] < 0 {
+				return nil, fmt.Errorf("builtin %s isn't available", l.builtinNames[operands[0]])
+			}
+			operands[0] = l.builtins[operands[0]]
+		}
+
+		switch op {
+		case code.OpConstant, code.OpClosure, code.OpGetGlobal, code.OpSetGlobal, code.OpAssignGlobal, code.OpGetBuiltin:
+			if operands[0] >= 1<<(8*uint(def.OperandWidths[0])) {
+				return nil, fmt.Errorf("too many constants, globals or builtins to link")
+			}
+			copy(relocated[i:], code.Make(op, operands...))
+		}
+
+		i += 1 + read
+	}
+
+	return relocated, nil
+}
@@ -0,0 +1,243 @@
+package compiler
+
+import (
+	"monkey/object"
+)
+
+//SymbolScope where a name lives at run time
+type SymbolScope string
+
+const (
+	//GlobalScope top level lets
+	GlobalScope SymbolScope = "GLOBAL"
+	//LocalScope parameters and lets inside a function
+	LocalScope SymbolScope = "LOCAL"
+	//BuiltinScope the builtin table the code is compiled against
+	BuiltinScope SymbolScope = "BUILTIN"
+	//FreeScope locals of an enclosing function captured by a closure
+	FreeScope SymbolScope = "FREE"
+	//FunctionScope the name a function was bound to, inside itself
+	FunctionScope SymbolScope = "FUNCTION"
+)
+
+//Symbol a resolved name
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+//SymbolTable the names visible in one function, or at the top level
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+	names          []string
+	builtinNames   []string
+
+	// blocks the for loop bodies being compiled, innermost last.  At
+	// the top level their names are locals of the main program, named
+	// by localNames
+	blocks     []*block
+	localNames []string
+
+	FreeSymbols []Symbol
+}
+
+//block the names a for loop's body has defined, and the symbols they
+//hid which come back into view when it ends
+type block struct {
+	defined map[string]bool
+	hidden  map[string]Symbol
+}
+
+//NewSymbolTable top level table
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol), FreeSymbols: []Symbol{}}
+}
+
+//NewBuiltinSymbolTable top level table with the builtins of table
+//defined
+func NewBuiltinSymbolTable(table object.BuiltinTable) *SymbolTable {
+	s := NewSymbolTable()
+	for i, v := range table {
+		s.DefineBuiltin(i, v.Name)
+	}
+
+	return s
+}
+
+//NewEnclosedSymbolTable table for a function inside outer
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+
+	return s
+}
+
+//Define binds name in this table.  Like the evaluator's let, binding a
+//name that's already defined here reuses its slot.  Inside a block the
+//name is a new local of the block
+func (s *SymbolTable) Define(name string) Symbol {
+	if len(s.blocks) > 0 {
+		return s.defineInBlock(name)
+	}
+
+	return s.define(name)
+}
+
+func (s *SymbolTable) define(name string) Symbol {
+	scope := GlobalScope
+	if s.Outer != nil {
+		scope = LocalScope
+	}
+
+	if existing, ok := s.store[name]; ok && existing.Scope == scope {
+		return existing
+	}
+
+	symbol := Symbol{Name: name, Scope: scope, Index: s.numDefinitions}
+	s.store[name] = symbol
+	s.names = append(s.names, name)
+	s.numDefinitions++
+
+	return symbol
+}
+
+//DefineBuiltin makes the builtin at index in the builtin table visible
+//as name
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Scope: BuiltinScope, Index: index}
+	s.store[name] = symbol
+
+	for len(s.builtinNames) <= index {
+		s.builtinNames = append(s.builtinNames, "")
+	}
+	s.builtinNames[index] = name
+
+	return symbol
+}
+
+//DefineFunctionName lets a function refer to itself by the name it's
+//being bound to
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Scope: FunctionScope, Index: 0}
+	s.store[name] = symbol
+
+	return symbol
+}
+
+//Resolve look name up here and in the enclosing tables.  Locals of an
+//enclosing function become free symbols of this one
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+
+	symbol, ok = s.Outer.Resolve(name)
+	if !ok {
+		return symbol, ok
+	}
+
+	if symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+		return symbol, ok
+	}
+
+	return s.defineFree(symbol), true
+}
+
+//Root the top level table
+func (s *SymbolTable) Root() *SymbolTable {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+
+	return s
+}
+
+//Names the names of the globals or locals defined here, by index
+func (s *SymbolTable) Names() []string {
+	names := make([]string, len(s.names))
+	copy(names, s.names)
+
+	return names
+}
+
+//BuiltinNames the names of the builtins defined here, by index
+func (s *SymbolTable) BuiltinNames() []string {
+	names := make([]string, len(s.builtinNames))
+	copy(names, s.builtinNames)
+
+	return names
+}
+
+//EnterBlock start a for loop's body, whose names stay inside it
+func (s *SymbolTable) EnterBlock() {
+	s.blocks = append(s.blocks, &block{defined: map[string]bool{}, hidden: map[string]Symbol{}})
+}
+
+//LeaveBlock end the innermost block, the names it hid are visible again
+func (s *SymbolTable) LeaveBlock() {
+	b := s.blocks[len(s.blocks)-1]
+	s.blocks = s.blocks[:len(s.blocks)-1]
+
+	for name := range b.defined {
+		if symbol, ok := b.hidden[name]; ok {
+			s.store[name] = symbol
+		} else {
+			delete(s.store, name)
+		}
+	}
+}
+
+//nextLocal the index the next local will get.  Locals are never reused
+//so a block's are the ones from where it started up to where it ended
+func (s *SymbolTable) nextLocal() int {
+	if s.Outer == nil {
+		return len(s.localNames)
+	}
+
+	return s.numDefinitions
+}
+
+func (s *SymbolTable) defineInBlock(name string) Symbol {
+	b := s.blocks[len(s.blocks)-1]
+	if b.defined[name] {
+		return s.store[name]
+	}
+
+	if symbol, ok := s.store[name]; ok {
+		b.hidden[name] = symbol
+	}
+	b.defined[name] = true
+
+	symbol := Symbol{Name: name, Scope: LocalScope, Index: s.nextLocal()}
+	if s.Outer == nil {
+		s.localNames = append(s.localNames, name)
+	} else {
+		s.names = append(s.names, name)
+		s.numDefinitions++
+	}
+	s.store[name] = symbol
+
+	return symbol
+}
+
+//LocalNames the names of the main program's locals, by index
+func (s *SymbolTable) LocalNames() []string {
+	names := make([]string, len(s.localNames))
+	copy(names, s.localNames)
+
+	return names
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Scope: FreeScope, Index: len(s.FreeSymbols) - 1}
+	s.store[original.Name] = symbol
+
+	return symbol
+}
@@ -0,0 +1,75 @@
+package diagnostic
+
+import (
+	"fmt"
+	"monkey/token"
+	"strings"
+)
+
+//Severity how bad a diagnostic is
+type Severity int
+
+const (
+	//Error stops the program from running
+	Error Severity = iota
+	//Warning worth a look but not fatal
+	Warning
+	//Note extra information
+	Note
+)
+
+var severityNames = map[Severity]string{
+	Error:   "error",
+	Warning: "warning",
+	Note:    "note",
+}
+
+//String error, warning or note
+func (s Severity) String() string {
+	if name, ok := severityNames[s]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+//MarshalText so severities show up by name in JSON
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+//Diagnostic a problem found in a source file, with enough detail
+//to point at it and suggest what to do about it
+type Diagnostic struct {
+	Severity Severity          `json:"severity"`
+	Code     string            `json:"code"`
+	Message  string            `json:"message"`
+	Pos      token.Position    `json:"pos"`
+	End      token.Position    `json:"end"`
+	Expected []token.TokenType `json:"expected,omitempty"`
+	Hint     string            `json:"hint,omitempty"`
+}
+
+//Error one line summary, file:line:col: severity[code]: message
+func (d Diagnostic) Error() string {
+	var out strings.Builder
+
+	if d.Pos.IsValid() || d.Pos.Filename != "" {
+		out.WriteString(d.Pos.String())
+		out.WriteString(": ")
+	}
+
+	out.WriteString(d.Severity.String())
+	if d.Code != "" {
+		out.WriteString("[" + d.Code + "]")
+	}
+	out.WriteString(": ")
+	out.WriteString(d.Message)
+
+	return out.String()
+}
+
+//String same as Error
+func (d Diagnostic) String() string {
+	return d.Error()
+}
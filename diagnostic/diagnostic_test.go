@@ -0,0 +1,94 @@
+package diagnostic
+
+import (
+	"bytes"
+	"encoding/json"
+	"monkey/token"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	source := "let a = 1;\n\tlet x = (5;"
+	d := Diagnostic{
+		Severity: Error,
+		Code:     "P0001",
+		Message:  "Expected next token to be ), but was ; instead",
+		Pos:      token.Position{Filename: "test.monkey", Offset: 21, Line: 2, Column: 11},
+		End:      token.Position{Filename: "test.monkey", Offset: 22, Line: 2, Column: 12},
+		Expected: []token.TokenType{token.RPAREN},
+		Hint:     "insert a closing \")\"",
+	}
+
+	expected := `error[P0001]: Expected next token to be ), but was ; instead
+ --> test.monkey:2:11
+  |
+2 | 	let x = (5;
+  | 	         ^
+  = expected: )
+  = hint: insert a closing ")"
+`
+
+	var out bytes.Buffer
+	Render(&out, source, d)
+
+	if out.String() != expected {
+		t.Errorf("wrong rendering.\nwanted:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestRenderMultibyte(t *testing.T) {
+	source := `let s = "héllo" + ;`
+	d := Diagnostic{
+		Severity: Error,
+		Message:  "no prefix parse function for ; found",
+		Pos:      token.Position{Offset: 19, Line: 1, Column: 20},
+		End:      token.Position{Offset: 20, Line: 1, Column: 21},
+	}
+
+	expected := `error: no prefix parse function for ; found
+ --> 1:20
+  |
+1 | let s = "héllo" + ;
+  |                   ^
+`
+
+	var out bytes.Buffer
+	Render(&out, source, d)
+
+	if out.String() != expected {
+		t.Errorf("wrong rendering.\nwanted:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestRenderJSON(t *testing.T) {
+	d := Diagnostic{
+		Severity: Error,
+		Code:     "P0002",
+		Message:  "no prefix parse function for ) found",
+		Pos:      token.Position{Offset: 4, Line: 1, Column: 5},
+		End:      token.Position{Offset: 5, Line: 1, Column: 6},
+	}
+
+	var out bytes.Buffer
+	if err := RenderJSON(&out, []Diagnostic{d}); err != nil {
+		t.Fatalf("RenderJSON failed %s", err)
+	}
+
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("output isn't JSON %s", err)
+	}
+
+	if len(decoded) != 1 {
+		t.Fatalf("wanted 1 diagnostic but got %d", len(decoded))
+	}
+
+	if decoded[0]["severity"] != "error" {
+		t.Errorf("severity should be \"error\" but was %v", decoded[0]["severity"])
+	}
+
+	pos := decoded[0]["pos"].(map[string]interface{})
+	if pos["line"] != float64(1) || pos["column"] != float64(5) {
+		t.Errorf("wrong position %v", pos)
+	}
+}
@@ -0,0 +1,131 @@
+package diagnostic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+//Render writes d followed by the offending source line with the
+//range underlined by carets, e.g.
+//
+//	error[P0001]: Expected next token to be ), but was ; instead
+//	 --> script.monkey:1:11
+//	  |
+//	1 | let x = (5;
+//	  |           ^
+//	  = hint: insert ")"
+func Render(out io.Writer, source string, d Diagnostic) {
+	header := d.Severity.String()
+	if d.Code != "" {
+		header += "[" + d.Code + "]"
+	}
+	fmt.Fprintf(out, "%s: %s\n", header, d.Message)
+
+	if !d.Pos.IsValid() {
+		writeNotes(out, "", d)
+		return
+	}
+
+	line, ok := sourceLine(source, d.Pos.Line)
+	gutter := strings.Repeat(" ", len(strconv.Itoa(d.Pos.Line)))
+
+	fmt.Fprintf(out, "%s--> %s\n", gutter, d.Pos)
+
+	if ok {
+		fmt.Fprintf(out, "%s |\n", gutter)
+		fmt.Fprintf(out, "%d | %s\n", d.Pos.Line, line)
+		fmt.Fprintf(out, "%s | %s\n", gutter, underline(line, d))
+	}
+
+	writeNotes(out, gutter, d)
+}
+
+//RenderAll renders every diagnostic, separated by blank lines
+func RenderAll(out io.Writer, source string, diagnostics []Diagnostic) {
+	for i, d := range diagnostics {
+		if i > 0 {
+			io.WriteString(out, "\n")
+		}
+
+		Render(out, source, d)
+	}
+}
+
+//RenderJSON writes the diagnostics as a JSON array, one object per
+//diagnostic, for editors and other tools
+func RenderJSON(out io.Writer, diagnostics []Diagnostic) error {
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(diagnostics)
+}
+
+func writeNotes(out io.Writer, gutter string, d Diagnostic) {
+	if len(d.Expected) > 0 {
+		expected := []string{}
+		for _, t := range d.Expected {
+			expected = append(expected, string(t))
+		}
+
+		fmt.Fprintf(out, "%s = expected: %s\n", gutter, strings.Join(expected, ", "))
+	}
+
+	if d.Hint != "" {
+		fmt.Fprintf(out, "%s = hint: %s\n", gutter, d.Hint)
+	}
+}
+
+func sourceLine(source string, line int) (string, bool) {
+	lines := strings.Split(source, "\n")
+	if line < 1 || line > len(lines) {
+		return "", false
+	}
+
+	return strings.TrimRight(lines[line-1], "\r"), true
+}
+
+//underline carets under the columns d covers.  Columns count bytes, so
+//each rune gets one cell however many bytes it takes.  Tabs before the
+//range are kept so the carets line up however wide the terminal draws them
+func underline(line string, d Diagnostic) string {
+	start := d.Pos.Column - 1
+	if start > len(line) {
+		start = len(line)
+	}
+
+	end := len(line)
+	if d.End.Line == d.Pos.Line && d.End.Column > d.Pos.Column {
+		end = d.End.Column - 1
+	}
+	if end > len(line) {
+		end = len(line)
+	}
+
+	var out strings.Builder
+	for _, r := range line[:start] {
+		if r == '\t' {
+			out.WriteByte('\t')
+		} else {
+			out.WriteByte(' ')
+		}
+	}
+
+	width := 0
+	if end > start {
+		width = utf8.RuneCountInString(line[start:end])
+	}
+	if width < 1 {
+		width = 1
+	}
+	out.WriteString(strings.Repeat("^", width))
+
+	return out.String()
+}
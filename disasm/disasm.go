@@ -0,0 +1,224 @@
+package disasm
+
+import (
+	"fmt"
+	"io"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/object"
+	"monkey/token"
+	"strings"
+)
+
+//Instruction one decoded instruction.  Comment explains the operands,
+//the constant loaded or the name of the variable touched
+type Instruction struct {
+	Offset   int
+	Opcode   code.Opcode
+	Name     string
+	Operands []int
+	Comment  string
+	Pos      token.Position
+}
+
+//Function the instructions of the main program or of one compiled
+//function.  Constant is the function's index in the constant pool, -1
+//for the main program
+type Function struct {
+	Name          string
+	Constant      int
+	NumParameters int
+	NumLocals     int
+	Instructions  []Instruction
+}
+
+//Listing everything the compiler produced for a program
+type Listing struct {
+	Functions []Function
+}
+
+//Disassemble decode bytecode into a listing, the main program first
+//and then every function in the constant pool
+func Disassemble(bytecode *compiler.Bytecode) *Listing {
+	d := &disassembler{
+		constants:    bytecode.Constants,
+		globalNames:  bytecode.GlobalNames,
+		builtinNames: bytecode.BuiltinNames,
+	}
+
+	listing := &Listing{}
+
+	main := &object.CompiledFunction{
+		Name:         "<main>",
+		Instructions: bytecode.Instructions,
+		SourceMap:    bytecode.SourceMap,
+		NumLocals:    len(bytecode.LocalNames),
+		LocalNames:   bytecode.LocalNames,
+	}
+	listing.Functions = append(listing.Functions, d.function(main, -1))
+
+	for i, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			listing.Functions = append(listing.Functions, d.function(fn, i))
+		}
+	}
+
+	return listing
+}
+
+//Write prints the listing.  When source is given each run of
+//instructions is headed by the source line it was compiled from
+func (l *Listing) Write(out io.Writer, source string) {
+	lines := strings.Split(source, "\n")
+
+	for i, fn := range l.Functions {
+		if i > 0 {
+			io.WriteString(out, "\n")
+		}
+
+		header := fn.Name
+		if fn.Constant >= 0 {
+			header = fmt.Sprintf("%s (constant %d)", fn.Name, fn.Constant)
+		}
+		fmt.Fprintf(out, "== %s params=%d locals=%d ==\n", header, fn.NumParameters, fn.NumLocals)
+
+		line := 0
+		for _, ins := range fn.Instructions {
+			if ins.Pos.Line != line && ins.Pos.IsValid() {
+				line = ins.Pos.Line
+				fmt.Fprintf(out, "%4d| %s\n", line, sourceText(lines, line))
+			}
+
+			text := ins.Name
+			for _, operand := range ins.Operands {
+				text += fmt.Sprintf(" %d", operand)
+			}
+
+			if ins.Comment != "" {
+				fmt.Fprintf(out, "      %04d %-22s ; %s\n", ins.Offset, text, ins.Comment)
+			} else {
+				fmt.Fprintf(out, "      %04d %s\n", ins.Offset, text)
+			}
+		}
+	}
+}
+
+//String the listing without source text
+func (l *Listing) String() string {
+	var out strings.Builder
+	l.Write(&out, "")
+
+	return out.String()
+}
+
+type disassembler struct {
+	constants    []object.Object
+	globalNames  []string
+	builtinNames []string
+}
+
+func (d *disassembler) function(fn *object.CompiledFunction, constant int) Function {
+	name := fn.Name
+	if name == "" {
+		name = "<anonymous>"
+	}
+
+	result := Function{
+		Name:          name,
+		Constant:      constant,
+		NumParameters: fn.NumParameters,
+		NumLocals:     fn.NumLocals,
+	}
+
+	ins := fn.Instructions
+	for offset := 0; offset < len(ins); {
+		def, err := code.Lookup(ins[offset])
+		if err != nil {
+			result.Instructions = append(result.Instructions, Instruction{
+				Offset:  offset,
+				Opcode:  code.Opcode(ins[offset]),
+				Name:    "ERROR",
+				Comment: err.Error(),
+				Pos:     fn.SourceMap.Lookup(offset),
+			})
+			offset++
+			continue
+		}
+
+		operands, read := code.ReadOperands(def, ins[offset+1:])
+		op := code.Opcode(ins[offset])
+
+		result.Instructions = append(result.Instructions, Instruction{
+			Offset:   offset,
+			Opcode:   op,
+			Name:     def.Name,
+			Operands: operands,
+			Comment:  d.comment(fn, op, operands),
+			Pos:      fn.SourceMap.Lookup(offset),
+		})
+
+		offset += 1 + read
+	}
+
+	return result
+}
+
+func (d *disassembler) comment(fn *object.CompiledFunction, op code.Opcode, operands []int) string {
+	switch op {
+	case code.OpConstant:
+		return describeConstant(d.constant(operands[0]))
+	case code.OpClosure:
+		return fmt.Sprintf("%s, %d free", describeConstant(d.constant(operands[0])), operands[1])
+	case code.OpGetGlobal, code.OpSetGlobal, code.OpAssignGlobal:
+		return nameAt(d.globalNames, operands[0])
+	case code.OpGetLocal, code.OpSetLocal, code.OpAssignLocal, code.OpCaptureLocal:
+		return nameAt(fn.LocalNames, operands[0])
+	case code.OpGetBuiltin:
+		return nameAt(d.builtinNames, operands[0])
+	case code.OpCurrentClosure:
+		return fn.Name
+	}
+
+	return ""
+}
+
+func (d *disassembler) constant(index int) object.Object {
+	if index < len(d.constants) {
+		return d.constants[index]
+	}
+
+	return nil
+}
+
+func describeConstant(constant object.Object) string {
+	switch constant := constant.(type) {
+	case nil:
+		return "missing constant"
+	case *object.String:
+		return fmt.Sprintf("%q", constant.Value)
+	case *object.CompiledFunction:
+		if constant.Name != "" {
+			return "fn " + constant.Name
+		}
+
+		return "fn <anonymous>"
+	default:
+		return constant.Inspect()
+	}
+}
+
+func nameAt(names []string, index int) string {
+	if index < len(names) {
+		return names[index]
+	}
+
+	return ""
+}
+
+func sourceText(lines []string, line int) string {
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+
+	return strings.TrimSpace(lines[line-1])
+}
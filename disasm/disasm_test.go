@@ -0,0 +1,104 @@
+package disasm
+
+import (
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/lexer"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+func disassemble(t *testing.T, input string) *Listing {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	return Disassemble(comp.Bytecode())
+}
+
+func TestDisassemble(t *testing.T) {
+	input := `let add = fn(a, b) {
+  a + b
+};
+puts(add(1, "two"));`
+
+	listing := disassemble(t, input)
+
+	if len(listing.Functions) != 2 {
+		t.Fatalf("wrong number of functions. want=2, got=%d", len(listing.Functions))
+	}
+
+	main := listing.Functions[0]
+	if main.Name != "<main>" || main.Constant != -1 {
+		t.Errorf("wrong main function. got name=%q constant=%d", main.Name, main.Constant)
+	}
+
+	expected := []struct {
+		opcode  code.Opcode
+		comment string
+		line    int
+	}{
+		{code.OpClosure, "fn add, 0 free", 1},
+		{code.OpSetGlobal, "add", 1},
+		{code.OpGetBuiltin, "puts", 4},
+		{code.OpGetGlobal, "add", 4},
+		{code.OpConstant, "1", 4},
+		{code.OpConstant, `"two"`, 4},
+		{code.OpCall, "", 4},
+		{code.OpCall, "", 4},
+		{code.OpPop, "", 4},
+	}
+
+	if len(main.Instructions) != len(expected) {
+		t.Fatalf("wrong number of instructions. want=%d, got=%d\n%s",
+			len(expected), len(main.Instructions), listing)
+	}
+
+	for i, tt := range expected {
+		ins := main.Instructions[i]
+		if ins.Opcode != tt.opcode || ins.Comment != tt.comment || ins.Pos.Line != tt.line {
+			t.Errorf("instruction %d wrong. want=%v %q line %d, got=%s %q line %d",
+				i, tt.opcode, tt.comment, tt.line, ins.Name, ins.Comment, ins.Pos.Line)
+		}
+	}
+
+	add := listing.Functions[1]
+	if add.Name != "add" || add.NumParameters != 2 {
+		t.Errorf("wrong function. got name=%q params=%d", add.Name, add.NumParameters)
+	}
+	if add.Instructions[0].Comment != "a" || add.Instructions[0].Pos.Line != 2 {
+		t.Errorf("wrong first instruction in add. got %q line %d",
+			add.Instructions[0].Comment, add.Instructions[0].Pos.Line)
+	}
+}
+
+func TestListingWrite(t *testing.T) {
+	input := `let x = 5;
+x * 2;`
+
+	var out strings.Builder
+	disassemble(t, input).Write(&out, input)
+
+	expected := `== <main> params=0 locals=0 ==
+   1| let x = 5;
+      0000 OpConstant 0           ; 5
+      0003 OpSetGlobal 0          ; x
+   2| x * 2;
+      0006 OpGetGlobal 0          ; x
+      0009 OpConstant 1           ; 2
+      0012 OpMul
+      0013 OpPop
+`
+
+	if out.String() != expected {
+		t.Errorf("wrong listing.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
@@ -1,118 +1,272 @@
 package evaluator
 
 import (
+	"context"
 	"monkey/ast"
+	"monkey/budget"
 	"monkey/object"
-	"fmt"
+	"monkey/token"
+	"strings"
 )
 
 var (
 	//NULL null
-	NULL = &object.Null{}
+	NULL = object.NULL
 	//TRUE true
-	TRUE = &object.Boolean{Value: true}
+	TRUE = object.TRUE
 	//FALSE false
-	FALSE = &object.Boolean{Value: false}
+	FALSE = object.FALSE
 )
 
-//Eval eval ast
+//Options how EvalWith runs code.  Builtins are the functions the code
+//can call besides its own, object.Builtins when nil.  Context is what
+//they can reach, object.NewExecutionContext() when nil
+type Options struct {
+	Budget   budget.Budget
+	Builtins object.BuiltinTable
+	Context  *object.ExecutionContext
+}
+
+//Eval eval ast.  Errors come back knowing where they happened
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return EvalContext(context.Background(), node, env, budget.Budget{})
+}
+
+//EvalContext eval ast within b.  The run stops with an aborted error
+//once the budget is used up or ctx is done
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment, b budget.Budget) object.Object {
+	result, _ := EvalWith(ctx, node, env, Options{Budget: b})
+
+	return result
+}
+
+//EvalWith like EvalContext with more options, also saying what the run
+//used
+func EvalWith(ctx context.Context, node ast.Node, env *object.Environment, opts Options) (object.Object, budget.Summary) {
+	meter, cancel := budget.NewMeter(ctx, opts.Budget)
+	defer cancel()
+
+	e := &evaluation{meter: meter, builtins: opts.Builtins, exec: opts.Context}
+	if e.builtins == nil {
+		e.builtins = object.Builtins
+	}
+	if e.exec == nil {
+		e.exec = object.NewExecutionContext()
+	}
+
+	e.enter(env)
+	meter.SetRoots(func(visit func(object.Object), visitEnv func(*object.Environment)) {
+		for _, scope := range e.scopes {
+			visitEnv(scope)
+		}
+	})
+
+	result := e.Eval(node, env)
+	meter.Measure(result)
+
+	return result, meter.Summary()
+}
+
+//evaluation the state of one run of the evaluator
+type evaluation struct {
+	meter    *budget.Meter
+	builtins object.BuiltinTable
+	exec     *object.ExecutionContext
+
+	// scopes the environments code is running in, the run's roots
+	scopes []*object.Environment
+}
+
+//enter env while code runs in it, so the meter can see what it holds
+func (e *evaluation) enter(env *object.Environment) {
+	e.scopes = append(e.scopes, env)
+}
+
+//leave the environment last entered
+func (e *evaluation) leave() {
+	e.scopes = e.scopes[:len(e.scopes)-1]
+}
+
+//Eval count a step and evaluate node
+func (e *evaluation) Eval(node ast.Node, env *object.Environment) object.Object {
+	if err := e.meter.Step(); err != nil {
+		err.Pos = node.Pos()
+		return err
+	}
+
+	result := e.eval(node, env)
+
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = node.Pos()
+	}
+
+	return result
+}
+
+func (e *evaluation) eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
-		return evaluateProgram(node, env)
+		return e.evaluateProgram(node, env)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return e.Eval(node.Expression, env)
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
+	case *ast.BigIntegerLiteral:
+		return object.BigIntegerLiteral(node.Value, e.exec.StrictIntegers)
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
-		if isError(right) {
+		right := e.Eval(node.Right, env)
+		if isAbrupt(right) {
 			return right
 		}
-		return evaluatePrefixExpression(node.Operator, right)
+		return e.evaluatePrefixExpression(node.Operator, right)
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
+		if node.Operator == "&&" || node.Operator == "||" {
+			return e.evaluateLogicalExpression(node, env)
+		}
+
+		left := e.Eval(node.Left, env)
+		if isAbrupt(left) {
 			return left
 		}
-		right := Eval(node.Right, env)
-		if isError(right) {
+		right := e.Eval(node.Right, env)
+		if isAbrupt(right) {
 			return right
 		}
-		return evaluateInfixExpression(node.Operator, left, right)
+		return e.alloc(e.evaluateInfixExpression(node.Operator, left, right))
 	case *ast.BlockStatement:
-		return evaluateBlockStatement(node, env)
+		return e.evaluateBlockStatement(node, env)
 	case *ast.IfExpression:
-		return evaluateIfExpression(node, env)
+		return e.evaluateIfExpression(node, env)
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
-		if isError(val) {
+		val := e.Eval(node.ReturnValue, env)
+		if isAbrupt(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
-		if isError(val) {
+		val := e.Eval(node.Value, env)
+		if isAbrupt(val) {
 			return val
 		}
 
+		if node.Pattern != nil {
+			_, err := e.bindPattern(node.Pattern, val, env, true)
+			return err
+		}
+
+		if fn, ok := val.(*object.Function); ok && fn.Name == "" {
+			fn.Name = node.Name.Value
+		}
+
 		env.Set(node.Name.Value, val)
 	case *ast.Identifier:
-		return evaluateIdentifier(node, env)
+		return e.evaluateIdentifier(node, env)
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
 		return &object.Function{Parameters: params, Env: env, Body: body}
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
-		if isError(function) {
+		function := e.Eval(node.Function, env)
+		if isAbrupt(function) {
 			return function
 		}
-		args := evaluateExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
+		args := e.evaluateExpressions(node.Arguments, env)
+		if len(args) == 1 && isAbrupt(args[0]) {
 			return args[0]
 		}
 
-		return applyFunction(function, args)
+		return e.applyFunction(function, args, node.Pos())
 	case *ast.StringLiteral:
+		// Part of the program, like the virtual machine's constants, so
+		// not counted against the run
 		return &object.String{Value: node.Value}
+	case *ast.InterpolatedString:
+		return e.evaluateInterpolatedString(node, env)
+	case *ast.AssignExpression:
+		return e.evaluateAssignExpression(node, env)
+	case *ast.BreakStatement:
+		return &object.Break{Label: labelOf(node.Label)}
+	case *ast.ContinueStatement:
+		return &object.Continue{Label: labelOf(node.Label)}
+	case *ast.IndexAssignExpression:
+		return e.evaluateIndexAssignExpression(node, env)
 	case *ast.ArrayLiteral:
-		elements := evaluateExpressions(node.Elements, env)
-		if len(elements) == 1 && isError(elements[0]) {
+		elements := e.evaluateExpressions(node.Elements, env)
+		if len(elements) == 1 && isAbrupt(elements[0]) {
 			return elements[0]
 		}
 
-		return &object.Array{Elements: elements}
+		return e.alloc(&object.Array{Elements: elements})
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
+		left := e.Eval(node.Left, env)
+		if isAbrupt(left) {
 			return left
 		}
-		index := Eval(node.Index, env)
-		if isError(index) {
+		index := e.Eval(node.Index, env)
+		if isAbrupt(index) {
 			return index
 		}
 
 		return evaluateIndexExpression(left, index)
 	case *ast.HashLiteral:
-		return evaluateHashLiteral(node, env)
+		return e.evaluateHashLiteral(node, env)
 	case *ast.WhileExpression:
-		return evaluateWhileExpression(node, env)
+		return e.evaluateWhileExpression(node, env)
+	case *ast.ForExpression:
+		return e.evaluateForExpression(node, env)
+	case *ast.MatchExpression:
+		return e.evaluateMatchExpression(node, env)
+	case *ast.BadExpression:
+		return newError("cannot evaluate malformed expression at %s", node.Pos())
+	case *ast.BadStatement:
+		return newError("cannot evaluate malformed statement at %s", node.Pos())
 	}
 
 	return nil
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+func (e *evaluation) applyFunction(fn object.Object, args []object.Object, call token.Position) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
+		if len(args) != len(fn.Parameters) {
+			return newError("wrong number of arguments: want=%d, got=%d", len(fn.Parameters), len(args))
+		}
+
+		if err := e.meter.Enter(); err != nil {
+			return err
+		}
+		defer e.meter.Leave()
+
 		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
+
+		e.enter(extendedEnv)
+		evaluated := e.Eval(fn.Body, extendedEnv)
+		e.leave()
+
+		if err, ok := evaluated.(*object.Error); ok {
+			err.Stack = append(err.Stack, object.Frame{Function: fn, Call: call})
+		}
+
 		return unwrapReturnValue(evaluated)
 	case *object.BuiltIn:
-		return fn.Fn(args...)
+		if err := e.exec.Capabilities.Check(fn.Needs); err != nil {
+			return err
+		}
+
+		result := fn.Fn(e.exec, args...)
+		if isError(result) {
+			return result
+		}
+
+		if err := e.meter.AllocResult(result, args); err != nil {
+			return err
+		}
+
+		return result
 	default:
 		return newError("not a function %s", fn.Type())
 	}
@@ -120,7 +274,12 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 
 func evaluateArrayIndexExpression(array object.Object, index object.Object) object.Object {
 	arrayObject := array.(*object.Array)
-	i := index.(*object.Integer).Value
+	integer, ok := index.(*object.Integer)
+	if !ok {
+		// Promoted, so too large for any array
+		return newError("index out of range: %s", index.Inspect())
+	}
+	i := integer.Value
 	max := int64(len(arrayObject.Elements) - 1)
 
 	if i < 0 || i > max {
@@ -143,29 +302,34 @@ func evaluateBangOperatorExpression(right object.Object) object.Object {
 	}
 }
 
-func evaluateBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+func (e *evaluation) evaluateBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		result = e.Eval(statement, env)
 
 		if result != nil {
 			rt := result.Type()
-			if rt == object.ReturnObj || rt == object.ErrorObj {
+			if rt == object.ReturnObj || rt == object.ErrorObj || rt == object.BreakObj || rt == object.ContinueObj {
 				return result
 			}
 		}
 	}
 
+	// an empty block, or one ending in a let, is null like it is on the vm
+	if result == nil {
+		return NULL
+	}
+
 	return result
 }
 
-func evaluateExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+func (e *evaluation) evaluateExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 
-	for _, e := range exps {
-		evaluated := Eval(e, env)
-		if isError(evaluated) {
+	for _, exp := range exps {
+		evaluated := e.Eval(exp, env)
+		if isAbrupt(evaluated) {
 			return []object.Object{evaluated}
 		}
 		result = append(result, evaluated)
@@ -189,12 +353,21 @@ func evaluateHashIndexExpression(left object.Object, index object.Object) object
 	return pair.Value
 }
 
-func evaluateHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+//alloc count the memory of o, just created by the run
+func (e *evaluation) alloc(o object.Object) object.Object {
+	if err := e.meter.Alloc(o); err != nil {
+		return err
+	}
+
+	return o
+}
+
+func (e *evaluation) evaluateHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
 	pairs := make(map[object.HashKey]object.HashPair)
 
 	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
-		if isError(key) {
+		key := e.Eval(keyNode, env)
+		if isAbrupt(key) {
 			return key
 		}
 
@@ -203,8 +376,8 @@ func evaluateHashLiteral(node *ast.HashLiteral, env *object.Environment) object.
 			return newError("unusable as a hash key: %s", key.Type())
 		}
 
-		value := Eval(valueNode, env)
-		if isError(key) {
+		value := e.Eval(valueNode, env)
+		if isAbrupt(value) {
 			return value
 		}
 
@@ -212,19 +385,19 @@ func evaluateHashLiteral(node *ast.HashLiteral, env *object.Environment) object.
 		pairs[hashed] = object.HashPair{Key: key, Value: value}
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return e.alloc(&object.Hash{Pairs: pairs})
 }
 
-func evaluateIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+func (e *evaluation) evaluateIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
 	if val, ok := env.Get(node.Value); ok {
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin := e.builtins.Lookup(node.Value); builtin != nil {
 		return builtin
 	}
 
-	return newError("identifier not found: " + node.Value)
+	return newError("identifier not found: %s", node.Value)
 }
 
 func evaluateIndexExpression(left object.Object, index object.Object) object.Object {
@@ -238,26 +411,289 @@ func evaluateIndexExpression(left object.Object, index object.Object) object.Obj
 	}
 }
 
-func evaluateIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
-	if isError(condition) {
+func (e *evaluation) evaluateAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	name := node.Name.Value
+
+	var current object.Object
+	if node.Operator != "=" {
+		current = e.evaluateIdentifier(node.Name, env)
+		if isAbrupt(current) {
+			return current
+		}
+	}
+
+	value := e.Eval(node.Value, env)
+	if isAbrupt(value) {
+		return value
+	}
+
+	if current != nil {
+		value = e.alloc(e.evaluateInfixExpression(compoundOperator(node.Operator), current, value))
+		if isAbrupt(value) {
+			return value
+		}
+	}
+
+	if !env.Assign(name, value) {
+		if e.builtins.Lookup(name) != nil {
+			return newError("cannot assign to builtin %s", name)
+		}
+		return newError("identifier not found: %s", name)
+	}
+
+	return value
+}
+
+func (e *evaluation) evaluateIndexAssignExpression(node *ast.IndexAssignExpression, env *object.Environment) object.Object {
+	left := e.Eval(node.Target.Left, env)
+	if isAbrupt(left) {
+		return left
+	}
+	index := e.Eval(node.Target.Index, env)
+	if isAbrupt(index) {
+		return index
+	}
+
+	var current object.Object
+	if node.Operator != "=" {
+		current = evaluateIndexExpression(left, index)
+		if isAbrupt(current) {
+			return current
+		}
+	}
+
+	value := e.Eval(node.Value, env)
+	if isAbrupt(value) {
+		return value
+	}
+
+	if current != nil {
+		value = e.alloc(e.evaluateInfixExpression(compoundOperator(node.Operator), current, value))
+		if isAbrupt(value) {
+			return value
+		}
+	}
+
+	before := budget.SizeOf(left)
+
+	result := object.SetIndex(left, index, value)
+	if isAbrupt(result) {
+		return result
+	}
+
+	if err := e.meter.Grow(left, before); err != nil {
+		return err
+	}
+
+	return result
+}
+
+//labelOf the name of a break or continue's label, "" without one
+func labelOf(label *ast.Identifier) string {
+	if label == nil {
+		return ""
+	}
+
+	return label.Value
+}
+
+//compoundOperator the operator a compound assignment applies, + for +=
+func compoundOperator(assign string) string {
+	return strings.TrimSuffix(assign, "=")
+}
+
+func (e *evaluation) evaluateIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := e.Eval(ie.Condition, env)
+	if isAbrupt(condition) {
 		return condition
 	}
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return e.Eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return e.Eval(ie.Alternative, env)
 	} else {
 		return NULL
 	}
 }
 
-func evaluateInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+//evaluateMatchExpression gives each arm an environment of its own for
+//the names its pattern binds
+func (e *evaluation) evaluateMatchExpression(me *ast.MatchExpression, env *object.Environment) object.Object {
+	value := e.Eval(me.Value, env)
+	if isAbrupt(value) {
+		return value
+	}
+
+	for _, arm := range me.Arms {
+		scope := object.NewEnclosedEnvironment(env)
+
+		e.enter(scope)
+		result, done := e.evaluateMatchArm(arm, value, scope)
+		e.leave()
+
+		if done {
+			return result
+		}
+	}
+
+	return newError("no match arm matches %s %s", value.Type(), value.Inspect())
+}
+
+//evaluateMatchArm the arm's body if value matches it, false if it
+//doesn't so the next arm gets a try
+func (e *evaluation) evaluateMatchArm(arm *ast.MatchArm, value object.Object, scope *object.Environment) (object.Object, bool) {
+	matched, err := e.matchPattern(arm.Pattern, value, scope)
+	if err != nil {
+		return err, true
+	}
+	if !matched {
+		return nil, false
+	}
+
+	if arm.Guard != nil {
+		guard := e.Eval(arm.Guard, scope)
+		if isAbrupt(guard) {
+			return guard, true
+		}
+		if !isTruthy(guard) {
+			return nil, false
+		}
+	}
+
+	return e.Eval(arm.Body, scope), true
+}
+
+//matchPattern whether value has pattern's shape, binding the names in
+//pattern to the parts of value in env as it goes.  The error is from
+//evaluating a literal or a default in the pattern
+func (e *evaluation) matchPattern(pattern ast.Pattern, value object.Object, env *object.Environment) (bool, object.Object) {
+	return e.bindPattern(pattern, value, env, false)
+}
+
+//bindPattern matchPattern, except that when strict, as for a let, a
+//value without pattern's shape is an error saying how it's different
+func (e *evaluation) bindPattern(pattern ast.Pattern, value object.Object, env *object.Environment, strict bool) (bool, object.Object) {
+	mismatch := func(format string, a ...interface{}) (bool, object.Object) {
+		if strict {
+			return false, newError(format, a...)
+		}
+		return false, nil
+	}
+
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		return true, nil
+	case *ast.BindingPattern:
+		env.Set(pattern.Name.Value, value)
+		return true, nil
+	case *ast.DefaultPattern:
+		return e.bindPattern(pattern.Pattern, value, env, strict)
+	case *ast.LiteralPattern:
+		literal := e.Eval(pattern.Value, env)
+		if isAbrupt(literal) {
+			return false, literal
+		}
+
+		equal := e.evaluateInfixExpression("==", value, literal)
+		if isAbrupt(equal) {
+			return false, equal
+		}
+
+		if !isTruthy(equal) {
+			return mismatch("%s doesn't match %s", value.Inspect(), literal.Inspect())
+		}
+		return true, nil
+	case *ast.ArrayPattern:
+		array, ok := value.(*object.Array)
+		if !ok {
+			return mismatch("cannot destructure %s %s as an array", value.Type(), value.Inspect())
+		}
+
+		elements, rest := pattern.SplitRest()
+		if rest == nil && len(array.Elements) > len(elements) {
+			return mismatch("array of length %d is too long to destructure, the pattern has length %d", len(array.Elements), len(elements))
+		}
+
+		for i, element := range elements {
+			var item object.Object
+			if i < len(array.Elements) {
+				item = array.Elements[i]
+			} else if item, ok = e.patternDefault(element, env); !ok {
+				return mismatch("array of length %d is too short to destructure, the pattern needs length %d", len(array.Elements), i+1)
+			} else if isAbrupt(item) {
+				return false, item
+			}
+
+			matched, err := e.bindPattern(element, item, env, strict)
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+
+		if rest != nil {
+			left := []object.Object{}
+			if len(array.Elements) > len(elements) {
+				left = append(left, array.Elements[len(elements):]...)
+			}
+			restArray := e.alloc(&object.Array{Elements: left})
+			if isAbrupt(restArray) {
+				return false, restArray
+			}
+			return e.bindPattern(rest.Pattern, restArray, env, strict)
+		}
+
+		return true, nil
+	case *ast.HashPattern:
+		hash, ok := value.(*object.Hash)
+		if !ok {
+			return mismatch("cannot destructure %s %s as a hash", value.Type(), value.Inspect())
+		}
+
+		for _, pair := range pattern.Pairs {
+			key := e.Eval(pair.Key, env)
+			if isAbrupt(key) {
+				return false, key
+			}
+
+			var item object.Object
+			if entry, ok := hash.Pairs[key.(object.Hashable).HashKey()]; ok {
+				item = entry.Value
+			} else if item, ok = e.patternDefault(pair.Value, env); !ok {
+				return mismatch("hash has no key %s to destructure", key.Inspect())
+			} else if isAbrupt(item) {
+				return false, item
+			}
+
+			matched, err := e.bindPattern(pair.Value, item, env, strict)
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+//patternDefault the value of pattern's default, for an element or key
+//that isn't there, false if it doesn't have one
+func (e *evaluation) patternDefault(pattern ast.Pattern, env *object.Environment) (object.Object, bool) {
+	if dp, ok := pattern.(*ast.DefaultPattern); ok {
+		return e.Eval(dp.Default, env), true
+	}
+
+	return nil, false
+}
+
+func (e *evaluation) evaluateInfixExpression(operator string, left object.Object, right object.Object) object.Object {
 	switch {
 	case left.Type() == object.IntegerObj && right.Type() == object.IntegerObj:
-		return evaluateIntegerInfixExpression(operator, left, right)
+		return object.IntegerOperation(operator, left, right, e.exec.StrictIntegers)
+	case isNumber(left) && isNumber(right):
+		return object.FloatOperation(operator, left, right)
 	case left.Type() == object.StringObj && right.Type() == object.StringObj:
-		return evaluateStringInfixExpression(operator, left, right)
+		return object.StringOperation(operator, left, right)
 	case operator == "==":
 		return nativeBoolToBooleanObject(left == right)
 	case operator == "!=":
@@ -270,57 +706,79 @@ func evaluateInfixExpression(operator string, left object.Object, right object.O
 
 }
 
-func evaluateIntegerInfixExpression(operator string, left object.Object, right object.Object) object.Object {
-	leftInt := left.(*object.Integer).Value
-	rightInt := right.(*object.Integer).Value
-
-	switch operator {
-	case "+":
-		return &object.Integer{Value: leftInt + rightInt}
-	case "-":
-		return &object.Integer{Value: leftInt - rightInt}
-	case "*":
-		return &object.Integer{Value: leftInt * rightInt}
-	case "/":
-		return &object.Integer{Value: leftInt / rightInt}
-	case "<":
-		return nativeBoolToBooleanObject(leftInt < rightInt)
-	case ">":
-		return nativeBoolToBooleanObject(leftInt > rightInt)
-	case "==":
-		return nativeBoolToBooleanObject(leftInt == rightInt)
-	case "!=":
-		return nativeBoolToBooleanObject(leftInt != rightInt)
+func (e *evaluation) evaluateNegationOperatorExpression(right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Integer, *object.BigInteger:
+		return object.Negate(right, e.exec.StrictIntegers)
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
-	}
-}
-
-func evaluateNegationOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.IntegerObj {
 		return newError("unknown operator: -%s", right.Type())
 	}
-
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
 }
 
-func evaluatePrefixExpression(operator string, right object.Object) object.Object {
+func (e *evaluation) evaluatePrefixExpression(operator string, right object.Object) object.Object {
 	switch operator {
 	case "!":
 		return evaluateBangOperatorExpression(right)
 	case "-":
-		return evaluateNegationOperatorExpression(right)
+		return e.alloc(e.evaluateNegationOperatorExpression(right))
+	case "~":
+		if right.Type() != object.IntegerObj {
+			return newError("unknown operator: ~%s", right.Type())
+		}
+		return e.alloc(object.BitNot(right))
 	default:
 		return newError("unknown oeprator: %s%s", operator, right.Type())
 	}
 }
 
-func evaluateProgram(program *ast.Program, env *object.Environment) object.Object {
+//evaluateInterpolatedString the text with each embedded expression's
+//value converted by object.ToString in between
+func (e *evaluation) evaluateInterpolatedString(node *ast.InterpolatedString, env *object.Environment) object.Object {
+	var out strings.Builder
+
+	for i, part := range node.Parts {
+		if i%2 == 0 {
+			out.WriteString(part.(*ast.StringLiteral).Value)
+			continue
+		}
+
+		value := e.Eval(part, env)
+		if isAbrupt(value) {
+			return value
+		}
+		out.WriteString(object.ToString(value))
+	}
+
+	return e.alloc(&object.String{Value: out.String()})
+}
+
+//evaluateLogicalExpression && and ||, which only evaluate the right side
+//when the left doesn't already decide the result
+func (e *evaluation) evaluateLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := e.Eval(node.Left, env)
+	if isAbrupt(left) {
+		return left
+	}
+
+	if isTruthy(left) == (node.Operator == "||") {
+		return nativeBoolToBooleanObject(isTruthy(left))
+	}
+
+	right := e.Eval(node.Right, env)
+	if isAbrupt(right) {
+		return right
+	}
+
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
+func (e *evaluation) evaluateProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+		result = e.Eval(statement, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
@@ -334,37 +792,94 @@ func evaluateProgram(program *ast.Program, env *object.Environment) object.Objec
 
 }
 
-func evaluateStringInfixExpression(operator string, left object.Object, right object.Object) object.Object {
-	if operator != "+" {
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
-	}
-
-	leftVal := left.(*object.String).Value
-	rightVal := right.(*object.String).Value
-
-	return &object.String{Value: leftVal + rightVal}
-}
-
-func evaluateWhileExpression(we *ast.WhileExpression, env *object.Environment) object.Object {
+func (e *evaluation) evaluateWhileExpression(we *ast.WhileExpression, env *object.Environment) object.Object {
 	runs := 0
 
+loop:
 	for {
-		condition := Eval(we.Condition, env)
-		if isError(condition) {
+		condition := e.Eval(we.Condition, env)
+		if isAbrupt(condition) {
 			return condition
 		}
 
 		runs = runs + 1
-		if isTruthy(condition) {
-			Eval(we.Body, env)
-		} else {
+		if !isTruthy(condition) {
 			break
 		}
+
+		switch result := e.Eval(we.Body, env).(type) {
+		case *object.ReturnValue, *object.Error:
+			return result
+		case *object.Break:
+			if !isLoop(we.Label, result.Label) {
+				return result
+			}
+			break loop
+		case *object.Continue:
+			if !isLoop(we.Label, result.Label) {
+				return result
+			}
+		}
 	}
 
 	return &object.Integer{Value: int64(runs)}
 }
 
+//evaluateForExpression runs the body in an environment of its own each
+//time round, so closures made in one iteration keep that iteration's
+//names
+func (e *evaluation) evaluateForExpression(fe *ast.ForExpression, env *object.Environment) object.Object {
+	iterable := e.Eval(fe.Iterable, env)
+	if isAbrupt(iterable) {
+		return iterable
+	}
+
+	iterator := object.Iterate(iterable)
+	if isAbrupt(iterator) {
+		return iterator
+	}
+
+loop:
+	for {
+		key, value, ok := iterator.(object.Iterator).Next()
+		if !ok {
+			break
+		}
+
+		scope := object.NewEnclosedEnvironment(env)
+		if fe.Key != nil {
+			scope.Set(fe.Key.Value, key)
+		}
+		scope.Set(fe.Value.Value, value)
+
+		e.enter(scope)
+		result := e.Eval(fe.Body, scope)
+		e.leave()
+
+		switch result := result.(type) {
+		case *object.ReturnValue, *object.Error:
+			return result
+		case *object.Break:
+			if !isLoop(fe.Label, result.Label) {
+				return result
+			}
+			break loop
+		case *object.Continue:
+			if !isLoop(fe.Label, result.Label) {
+				return result
+			}
+		}
+	}
+
+	return NULL
+}
+
+//isLoop whether a break or continue to target is for the loop with
+//label, an empty target is for the innermost loop
+func isLoop(label *ast.Identifier, target string) bool {
+	return target == "" || (label != nil && label.Value == target)
+}
+
 func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
 	env := object.NewEnclosedEnvironment(fn.Env)
 
@@ -383,6 +898,21 @@ func isError(obj object.Object) bool {
 	return false
 }
 
+//isAbrupt whether obj is an error, or a return, break or continue on
+//its way out, any of which ends the expression it turns up in
+func isAbrupt(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Error, *object.ReturnValue, *object.Break, *object.Continue:
+		return true
+	}
+
+	return false
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.IntegerObj || obj.Type() == object.FloatObj
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case NULL:
@@ -405,7 +935,7 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean {
 }
 
 func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+	return object.NewError(format, a...)
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
@@ -1,12 +1,41 @@
 package evaluator
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"monkey/ast"
+	"monkey/budget"
+	"monkey/compiler"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/vm"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
+//engine what testEval runs programs with.  TestMain runs every test
+//once with the tree walker and once compiled on the vm
+var engine = "eval"
+
+func TestMain(m *testing.M) {
+	for _, e := range []string{"eval", "vm"} {
+		engine = e
+
+		if code := m.Run(); code != 0 {
+			fmt.Printf("FAIL: tests failed with the %s engine\n", e)
+			os.Exit(code)
+		}
+	}
+
+	os.Exit(0)
+}
+
 func TestArrayIndexExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -122,6 +151,55 @@ func TestBangOperator(t *testing.T) {
 	}
 }
 
+func TestBudgets(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		input    string
+		ctx      context.Context
+		budget   budget.Budget
+		expected object.ErrorKind
+	}{
+		{"while (true) { 1 }", context.Background(), budget.Budget{MaxSteps: 1000}, object.StepLimitError},
+		{"let f = fn(n) { f(n + 1) }; f(0)", context.Background(), budget.Budget{MaxDepth: 50}, object.DepthLimitError},
+		{"let f = fn(n) { f(n + 1) }; f(0)", context.Background(), budget.Budget{MaxDepth: 3000}, object.DepthLimitError},
+		{"while (true) { 1 }", context.Background(), budget.Budget{Timeout: 20 * time.Millisecond}, object.TimeoutError},
+		{"while (true) { 1 }", cancelled, budget.Budget{}, object.InterruptedError},
+		{"let a = []; while (true) { let a = push(a, a); }", context.Background(), budget.Budget{MaxMemory: 1 << 20}, object.MemoryLimitError},
+		{`let s = "x"; while (true) { let s = s + s; }`, context.Background(), budget.Budget{MaxMemory: 1 << 20}, object.MemoryLimitError},
+		{"let h = {}; let i = 0; while (true) { h[i] = i; i += 1 }", context.Background(), budget.Budget{MaxMemory: 1 << 20}, object.MemoryLimitError},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalContext(tt.ctx, tt.input, tt.budget)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Kind != tt.expected || !errObj.Aborted() {
+			t.Errorf("wrong error kind for %q. want=%d, got=%d (%s)", tt.input, tt.expected, errObj.Kind, errObj.Message)
+		}
+
+		if !errObj.Pos.IsValid() {
+			t.Errorf("error for %q has no position", tt.input)
+		}
+	}
+
+	evaluated := testEvalContext(context.Background(), "let f = fn(n) { if (n < 1) { 0 } else { f(n - 1) } }; f(20)", budget.Budget{MaxSteps: 10000, MaxDepth: 30})
+	testIntegerObject(t, evaluated, 0)
+
+	evaluated = testEvalContext(context.Background(), "let f = fn(n) { if (n < 1) { 0 } else { 1 + f(n - 1) } }; f(9000)", budget.Budget{})
+	testIntegerObject(t, evaluated, 9000)
+
+	// Far more is allocated than the budget, but little of it at once
+	evaluated = testEvalContext(context.Background(), `let i = 0; while (i < 20000) { let s = "ab" + "cd"; let a = [s, s]; i += 1 }; i`, budget.Budget{MaxMemory: 100000})
+	testIntegerObject(t, evaluated, 20000)
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -185,6 +263,95 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestCapabilities(t *testing.T) {
+	dir, err := ioutil.TempDir("", "capabilities")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	inside := filepath.Join(dir, "inside.txt")
+	if err := ioutil.WriteFile(inside, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		granted  *object.Capabilities
+		expected interface{}
+	}{
+		{`len("abc")`, &object.Capabilities{}, 3},
+		{`puts("hi")`, &object.Capabilities{}, "permission denied: stdout capability not granted"},
+		{fmt.Sprintf(`readfile(%q)`, inside), object.DefaultCapabilities(), "permission denied: read capability not granted"},
+		{fmt.Sprintf(`readfile(%q)`, inside), &object.Capabilities{Granted: object.CapFileRead}, "hello"},
+		{fmt.Sprintf(`readfile(%q)`, inside), &object.Capabilities{Granted: object.CapFileRead, ReadRoots: []string{dir}}, "hello"},
+		{`readfile("/etc/passwd")`, &object.Capabilities{Granted: object.CapFileRead, ReadRoots: []string{dir}}, "permission denied: /etc/passwd is outside the allowed directories"},
+		{fmt.Sprintf(`writefile(%q, "x")`, filepath.Join(dir, "out.txt")), &object.Capabilities{Granted: object.CapFileRead}, "permission denied: write capability not granted"},
+		{`getenv("HOME")`, object.DefaultCapabilities(), "permission denied: env capability not granted"},
+		{`now()`, object.DefaultCapabilities(), "permission denied: clock capability not granted"},
+		{`random(10)`, object.DefaultCapabilities(), "permission denied: random capability not granted"},
+		{`let f = fn() { now() }; f()`, &object.Capabilities{Granted: object.CapRandom}, "permission denied: clock capability not granted"},
+	}
+
+	for _, tt := range tests {
+		exec := object.NewExecutionContext()
+		exec.Capabilities = tt.granted
+		evaluated := testEvalExec(tt.input, exec)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected || (strings.HasPrefix(expected, "permission denied") && errObj.Kind != object.PermissionError) {
+					t.Errorf("wrong error for %q. want=%q, got=%q (kind %d)", tt.input, expected, errObj.Message, errObj.Kind)
+				}
+				continue
+			}
+
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("wrong result for %q. want=%q, got=%T(%+v)", tt.input, expected, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestStreams(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	exec := object.NewExecutionContext()
+	exec.Stdout = &stdout
+	exec.Stderr = &stderr
+	exec.Stdin = strings.NewReader("first\r\nsecond\nlast")
+
+	input := `puts("out", 1); eputs("err"); [gets(), readline(), gets(), gets()]`
+	evaluated := testEvalExec(input, exec)
+
+	if stdout.String() != "out\n1\n" {
+		t.Errorf("wrong stdout. got=%q", stdout.String())
+	}
+	if stderr.String() != "err\n" {
+		t.Errorf("wrong stderr. got=%q", stderr.String())
+	}
+
+	lines, ok := evaluated.(*object.Array)
+	if !ok || len(lines.Elements) != 4 {
+		t.Fatalf("expected 4 lines read. got=%T(%+v)", evaluated, evaluated)
+	}
+	for i, expected := range []string{"first", "second", "last"} {
+		if str, ok := lines.Elements[i].(*object.String); !ok || str.Value != expected {
+			t.Errorf("wrong line %d. want=%q, got=%+v", i, expected, lines.Elements[i])
+		}
+	}
+	testNullObject(t, lines.Elements[3])
+
+	exec.Capabilities = &object.Capabilities{Granted: object.CapStdout}
+	evaluated = testEvalExec("gets()", exec)
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Kind != object.PermissionError {
+		t.Errorf("gets without stdin should be refused. got=%+v", evaluated)
+	}
+}
+
 func TestClosure(t *testing.T) {
 	input := `
 	let newAdder = fn(x) {
@@ -250,6 +417,34 @@ func TestErrorHandling(t *testing.T) {
 			`{"name": "monkey"}[fn(){}];`,
 			"unusable as a hash key: FUNCTION",
 		},
+		{
+			"5 / 0",
+			"division by zero: 5 / 0",
+		},
+		{
+			"let zero = 0; 1 + 10 / zero",
+			"division by zero: 10 / 0",
+		},
+		{
+			"(9223372036854775807 + 1) / 0",
+			"division by zero: 9223372036854775808 / 0",
+		},
+		{
+			"2.5 / 0",
+			"division by zero: 2.5 / 0",
+		},
+		{
+			"1 / 0.0",
+			"division by zero: 1 / 0.0",
+		},
+		{
+			"let add = fn(a, b) { a + b }; add(1)",
+			"wrong number of arguments: want=2, got=1",
+		},
+		{
+			"fn(a) { a }(1, 2)",
+			"wrong number of arguments: want=1, got=2",
+		},
 	}
 
 	for _, tt := range tests {
@@ -265,6 +460,62 @@ func TestErrorHandling(t *testing.T) {
 			t.Errorf("Wong error message.  wanted %q but got %q", tt.expected, errorObj.Message)
 		}
 
+		if !errorObj.Pos.IsValid() {
+			t.Errorf("error for %q has no position", tt.input)
+		}
+	}
+}
+
+func TestErrorLocations(t *testing.T) {
+	input := `let inner = fn(x) {
+	x + missing
+};
+let outer = fn() {
+	inner(1)
+};
+outer();`
+
+	evaluated := testEval(input)
+
+	errorObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got %T", evaluated)
+	}
+
+	if errorObj.Pos.String() != "2:6" {
+		t.Errorf("error should be at 2:6 but was at %s", errorObj.Pos)
+	}
+
+	expectedStack := []struct {
+		name string
+		call string
+	}{
+		{"inner", "5:2"},
+		{"outer", "7:1"},
+	}
+
+	if len(errorObj.Stack) != len(expectedStack) {
+		t.Fatalf("wanted %d frames but got %d", len(expectedStack), len(errorObj.Stack))
+	}
+
+	for i, expected := range expectedStack {
+		frame := errorObj.Stack[i]
+		if frame.Name() != expected.name {
+			t.Errorf("frame %d should be %s but was %s", i, expected.name, frame.Name())
+		}
+
+		if frame.Call.String() != expected.call {
+			t.Errorf("frame %d called from %s but wanted %s", i, frame.Call, expected.call)
+		}
+	}
+
+	expectedTraceback := `ERROR: identifier not found: missing
+    at inner (2:6)
+    at outer (5:2)
+    at <main> (7:1)`
+
+	if errorObj.Inspect() != expectedTraceback {
+		t.Errorf("wrong traceback.\nwanted:\n%s\ngot:\n%s", expectedTraceback, errorObj.Inspect())
 	}
 }
 
@@ -382,6 +633,10 @@ func TestEvalBooleanExpression(t *testing.T) {
 }
 
 func TestFunctionObject(t *testing.T) {
+	if engine != "eval" {
+		t.Skip("compiled functions don't keep their AST")
+	}
+
 	input := "fn(x) { x + 2; }"
 
 	evaluated := testEval(input)
@@ -405,6 +660,34 @@ func TestFunctionObject(t *testing.T) {
 	}
 }
 
+func TestFunctionInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(x) { x }", "fn(x) {"},
+		{"let add = fn(a, b) { a + b }; add", "fn(a, b) {"},
+		{`"${fn() { 1 }}"`, "fn() {"},
+		{"let outer = fn(a) { fn(b) { a + b } }; outer(1)", "fn(b) {"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if !strings.HasPrefix(evaluated.Inspect(), tt.expected) {
+			t.Errorf("wrong inspect for %s. want prefix %q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	var stdout bytes.Buffer
+	exec := object.NewExecutionContext()
+	exec.Stdout = &stdout
+
+	testEvalExec("puts(fn(a) { a })", exec)
+	if !strings.HasPrefix(stdout.String(), "fn(a) {") {
+		t.Errorf("wrong stdout. got=%q", stdout.String())
+	}
+}
+
 func TestHashExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -527,6 +810,18 @@ func TestIfElseExpression(t *testing.T) {
 			"if (1 < 2) { 10 } else { 20 }",
 			10,
 		},
+		{
+			"if (1 > 2) { 10 } else if (2 > 1) { 20 } else { 30 }",
+			20,
+		},
+		{
+			"if (1 > 2) { 10 } else if (2 > 3) { 20 } else if (3 > 4) { 30 } else { 40 }",
+			40,
+		},
+		{
+			"if (1 > 2) { 10 } else if (2 > 3) { 20 }",
+			nil,
+		},
 	}
 
 	for _, tt := range tests {
@@ -544,6 +839,31 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
+func TestEmptyBlocks(t *testing.T) {
+	tests := []string{
+		"fn() {}()",
+		"let q = fn() {}; q()",
+		"fn() { let a = 1; }()",
+		"if (true) {}",
+		"let x = if (true) {}; x",
+	}
+
+	for _, input := range tests {
+		if !testNullObject(t, testEval(input)) {
+			t.Errorf("%s", input)
+		}
+	}
+
+	var stdout bytes.Buffer
+	exec := object.NewExecutionContext()
+	exec.Stdout = &stdout
+
+	testEvalExec("puts(fn() {}()); let x = if (true) {}; puts(x)", exec)
+	if stdout.String() != "null\nnull\n" {
+		t.Errorf("wrong stdout. got=%q", stdout.String())
+	}
+}
+
 func TestEvalIntegerExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -589,6 +909,187 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"3.14", 3.14},
+		{"-2.5", -2.5},
+		{"1e3", 1000.0},
+		{"0.1 + 0.2", 0.30000000000000004},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2.0},
+		{"7 / 2.0", 3.5},
+		{"7 / 2", 3},
+		{"10 - 2.5 * 2", 5.0},
+		{"1.5 < 2", true},
+		{"2 > 2.5", false},
+		{"1 == 1.0", true},
+		{"1.0 != 1", false},
+		{"0.5 == 0.25 * 2", true},
+		{"int(3.9)", 3},
+		{"int(-3.9)", -3},
+		{`int("42")`, 42},
+		{"float(3)", 3.0},
+		{`float("2.5")`, 2.5},
+		{`int(float("NaN"))`, "NaN doesn't fit in an integer"},
+		{`float("pi")`, `can't convert "pi" to a float`},
+		{`1.5 + "a"`, "type mismatch: FLOAT + STRING"},
+		{"{1: 10}[1.0]", 10},
+		{"{1.5: 10}[1.5]", 10},
+		{"{2.0: 10}[2]", 10},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case int:
+			if !testIntegerObject(t, evaluated, int64(expected)) {
+				t.Errorf("For %s", tt.input)
+			}
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok || errObj.Message != expected {
+				t.Errorf("wrong error for %q. want=%q, got=%+v", tt.input, expected, evaluated)
+			}
+		}
+	}
+}
+
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"let f = fn(n) { if (n < 2) { 1 } else { n * f(n - 1) } }; f(25)", "15511210043330985984000000"},
+		{"(9223372036854775807 + 1) - 1", "9223372036854775807"},
+		{"9223372036854775807 * 2 / 2 == 9223372036854775807", "true"},
+		{"9223372036854775807 + 1 > 9223372036854775807", "true"},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808"},
+		{"(9223372036854775807 + 1) * 1.0", "9.223372036854776e+18"},
+		{"int(1e30)", "1000000000000000019884624838656"},
+		{`int("123456789012345678901234567890") + 1`, "123456789012345678901234567891"},
+		{"{9223372036854775807 + 1: 1}[9223372036854775807 * 2 - 9223372036854775806]", "1"},
+		{"9223372036854775808", "9223372036854775808"},
+		{"-9223372036854775808 == -9223372036854775807 - 1", "true"},
+		{"123456789012345678901234567890 - 123456789012345678901234567889", "1"},
+		{"match (9223372036854775807 + 1) { 9223372036854775808 => true, _ => false }", "true"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2][9223372036854775807 + 1]", "index out of range: 9223372036854775808"},
+		{"let a = [1]; a[9223372036854775807 + 1] = 1", "index out of range: 9223372036854775808"},
+		{"range(9223372036854775807 + 1)", "argument to `range` is too large, got 9223372036854775808"},
+	}
+
+	for _, tt := range errors {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok || errObj.Message != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	strict := []string{
+		"9223372036854775807 + 1",
+		"-9223372036854775807 - 2",
+		"-(-9223372036854775807 - 1)",
+		`int("99999999999999999999")`,
+		"9223372036854775808",
+	}
+
+	for _, input := range strict {
+		exec := object.NewExecutionContext()
+		exec.StrictIntegers = true
+		evaluated := testEvalExec(input, exec)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok || errObj.Kind != object.OverflowError {
+			t.Errorf("strict %q should overflow. got=%s", input, evaluated.Inspect())
+		}
+	}
+}
+
+func TestOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"7 % 3", "1"},
+		{"-7 % 3", "-1"},
+		{"7.5 % 2", "1.5"},
+		{"2 ** 10", "1024"},
+		{"2 ** 3 ** 2", "512"},
+		{"-2 ** 2", "-4"},
+		{"2 ** -1", "0.5"},
+		{"2 ** 0.5 > 1.41", "true"},
+		{"2 ** 64", "18446744073709551616"},
+		{"3 <= 3", "true"},
+		{"3 >= 4", "false"},
+		{"2.5 >= 2", "true"},
+		{`"abc" < "abd"`, "true"},
+		{`"b" >= "a"`, "true"},
+		{`"a" == "a"`, "true"},
+		{`"a" != "a"`, "false"},
+		{"6 & 3", "2"},
+		{"6 | 3", "7"},
+		{"6 ^ 3", "5"},
+		{"~5", "-6"},
+		{"1 << 10", "1024"},
+		{"1 << 64", "18446744073709551616"},
+		{"-16 >> 2", "-4"},
+		{"1 >> 100", "0"},
+		{"(1 << 70) >> 68", "4"},
+		{"1 + 2 * 3 % 4 ** 2", "7"},
+		{"1 < 2 && 2 < 3", "true"},
+		{"1 > 2 || 2 > 3", "false"},
+		{"false && missing", "false"},
+		{"true || missing", "true"},
+		{"1 && 2", "true"},
+		{"let n = if (false) { 1 }; n || false", "false"},
+		{"false && 1 / 0", "false"},
+		{"true || 1 / 0", "true"},
+		{"5 % 0", "ERROR: division by zero: 5 % 0"},
+		{"0 ** -1", "ERROR: division by zero: 0 ** -1"},
+		{"1 << -1", "ERROR: negative shift count: 1 << -1"},
+		{"2 ** 10000000", "ERROR: integer too large: 2 ** 10000000"},
+		{"~1.5", "ERROR: unknown operator: ~FLOAT"},
+		{"1.5 & 1", "ERROR: unknown operator: FLOAT & INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		result := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			result = "ERROR: " + errObj.Message
+		}
+
+		if result != tt.expected {
+			t.Errorf("wrong result for %q. want=%s, got=%s", tt.input, tt.expected, result)
+		}
+	}
+}
+
 func TestReturnStatement(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -658,6 +1159,437 @@ func TestStringLiteral(t *testing.T) {
 	}
 }
 
+func TestInterpolatedStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"plain ${"text"}"`, "plain text"},
+		{`let xs = [1, 2, 3]; "total: ${xs[0] + xs[1] + xs[2]} of ${len(xs)}"`, "total: 6 of 3"},
+		{`"${1.5} ${true} ${[1, "two"]} ${if (false) { 1 }}"`, "1.5 true [1, two] null"},
+		{`let name = "x"; "say \"${name + "!"}\""`, `say "x!"`},
+		{`"outer ${"inner ${1 + 1}"} end"`, "outer inner 2 end"},
+		{`let h = {"k": "v"}; "${h["k"]}"`, "v"},
+		{`"cost: \${price}"`, "cost: ${price}"},
+		{`let f = fn(n) { "n=${n}" }; f(2) + f(3)`, "n=2n=3"},
+		{`"${2 ** 64}"`, "18446744073709551616"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+
+		if !ok {
+			t.Errorf("I wanted a String for %s but I got a %T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if str.Value != tt.expected {
+			t.Errorf("String has the wrong value. want=%q, got=%q", tt.expected, str.Value)
+		}
+	}
+
+	evaluated := testEval(`"a ${1 / 0} b"`)
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != "division by zero: 1 / 0" {
+		t.Errorf("wanted the division by zero error, got %T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestAssignments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 1; x = 2; x", 2},
+		{"let x = 1; x = x + 1", 2},
+		{"let x = 1; let y = 1; x = y = 5; x + y", 10},
+		{"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x", 6},
+		{"let s = \"a\"; s += \"b\"; s", "ab"},
+		{"let i = 0; let sum = 0; while (i < 5) { sum += i; i += 1 }; sum", 10},
+		{"let f = fn() { let i = 0; while (i < 3) { i = i + 1 }; i }; f()", 3},
+		{"let count = 0; let inc = fn() { count += 1 }; inc(); inc(); count", 2},
+		{"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()", 3},
+		{"let counter = fn() { let n = 0; fn() { n += 1 } }; let a = counter(); let b = counter(); a(); a(); b()", 1},
+		{"let f = fn() { let n = 1; let get = fn() { n }; n = 5; get() }; f()", 5},
+		{"let f = fn(n) { let g = fn() { fn() { n *= 2 } }; g()(); g()(); n }; f(3)", 12},
+		{"let f = fn() { let n = 1; let set = fn(v) { n = v }; set(7); n }; f()", 7},
+		{"let a = [1, 2, 3]; a[1] = 20; a", []int{1, 20, 3}},
+		{"let a = [1, 2, 3]; a[2] += 10; a", []int{1, 2, 13}},
+		{"let a = [1, 2]; let b = a; b[0] = 9; a", []int{9, 2}},
+		{"let h = {\"k\": 1}; h[\"k\"] = 2; h[\"new\"] = 3; h[\"k\"] + h[\"new\"]", 5},
+		{"let h = {}; h[1] = 1; h[1] += 1; h[1]", 2},
+		{"let i = 0; let a = [0, 0]; let next = fn() { i += 1; i - 1 }; a[next()] += 5; [a[0], a[1], i]", []int{5, 0, 1}},
+		{"let a = [1]; (a[0] = 4) + 1", 5},
+		{"y = 1", "identifier not found: y"},
+		{"let f = fn() { z = 1 }; f()", "identifier not found: z"},
+		{"len = 1", "cannot assign to builtin len"},
+		{"let a = [1]; a[1] = 2", "index out of range: 1"},
+		{"let a = [1]; a[-1] = 2", "index out of range: -1"},
+		{"let a = [1]; a[\"x\"] = 2", "array index must be INTEGER, got STRING"},
+		{"let h = {}; h[fn() {}] = 1", "unusable as a hash key: FUNCTION"},
+		{"let s = \"abc\"; s[0] = \"x\"", "index assignment not supported: STRING"},
+		{"let x = 1; x += \"a\"", "type mismatch: INTEGER + STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case []int:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("%s: obj not Array. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+
+			if len(array.Elements) != len(expected) {
+				t.Errorf("%s: wrong num of elements. want=%d, got=%d", tt.input, len(expected), len(array.Elements))
+				continue
+			}
+
+			for i, expectedElem := range expected {
+				testIntegerObject(t, array.Elements[i], int64(expectedElem))
+			}
+		case string:
+			switch result := evaluated.(type) {
+			case *object.String:
+				if result.Value != expected {
+					t.Errorf("%s: wrong string. want=%q, got=%q", tt.input, expected, result.Value)
+				}
+			case *object.Error:
+				if result.Message != expected {
+					t.Errorf("%s: wrong error message. want=%q, got=%q", tt.input, expected, result.Message)
+				}
+			default:
+				t.Errorf("%s: wanted %q, got %T (%+v)", tt.input, expected, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestCyclicValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = [1]; a[0] = a; a", "[[...]]"},
+		{`let h = {}; h["self"] = h; h`, "{self: {...}}"},
+		{`let a = [1]; let h = {"a": a}; a[0] = h; a`, "[{a: [...]}]"},
+		{`let a = [1]; a[0] = a; "${a}"`, "[[...]]"},
+		{`let h = {}; h["self"] = h; "${h}"`, "{self: {...}}"},
+		{"let b = [1]; [b, b]", "[[1], [1]]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	var stdout bytes.Buffer
+	exec := object.NewExecutionContext()
+	exec.Stdout = &stdout
+
+	testEvalExec(`let a = [1]; a[0] = a; puts(a); let h = {}; h["self"] = h; puts(h)`, exec)
+	if stdout.String() != "[[...]]\n{self: {...}}\n" {
+		t.Errorf("wrong stdout. got=%q", stdout.String())
+	}
+}
+
+func TestLoopControl(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; while (true) { i += 1; if (i == 3) { break } }; i", 3},
+		{"let i = 0; let sum = 0; while (i < 6) { i += 1; if (i % 2 == 0) { continue }; sum += i }; sum", 9},
+		{"let i = 0; while (i < 10) { i += 1; if (i == 4) { break; } }", 4},
+		{"let hits = 0; let i = 0; outer: while (i < 3) { i += 1; let j = 0; while (true) { j += 1; if (j == 2) { continue outer }; hits += 1 } }; hits", 3},
+		{"let i = 0; let j = 0; outer: while (true) { i += 1; while (true) { j += 1; if (j == 5) { break outer }; if (j % 2 == 0) { break } } }; [i, j]", []int{3, 5}},
+		{"let f = fn() { let i = 0; while (true) { i += 1; if (i == 7) { return i * 2 } } }; f()", 14},
+		{"let f = fn() { while (true) { while (true) { return 1 } } }; f() + 1", 2},
+		{"let f = fn(n) { let i = 0; while (true) { if (i == n) { break }; i += 1 }; i }; f(2) + f(3)", 5},
+		{"let out = []; let i = 0; while (i < 3) { i += 1; let s = [i, i * 10]; if (i == 2) { continue }; out = push(out, s[1]) }; out", []int{10, 30}},
+		{"let i = 0; while (true) { i += 1; if (i == 2) { i + \"x\" }; if (i > 5) { break } }", "type mismatch: INTEGER + STRING"},
+		{"let i = 0; while (i < 3) { i += 1; -true }; i", "unknown operator: -BOOLEAN"},
+		{"let i = 0; while (true) { i += 1; let stop = if (i == 3) { break } }; i", 3},
+		{"let i = 0; let n = 0; while (i < 4) { i += 1; n += if (i % 2 == 0) { continue } else { 1 } }; n", 2},
+		{"let i = 0; while (true) { i += 1; let h = {\"a\": if (i == 3) { break } else { i }} }; i", 3},
+		{"let i = 0; let n = 0; while (i < 4) { i += 1; let h = {\"a\": if (i % 2 == 0) { continue } else { 1 }}; n += h[\"a\"] }; n", 2},
+		{"let h = {\"a\": 5 / 0}; 1", "division by zero: 5 / 0"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case []int:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("%s: obj not Array. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+
+			if len(array.Elements) != len(expected) {
+				t.Errorf("%s: wrong num of elements. want=%d, got=%d", tt.input, len(expected), len(array.Elements))
+				continue
+			}
+
+			for i, expectedElem := range expected {
+				testIntegerObject(t, array.Elements[i], int64(expectedElem))
+			}
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%s: no error object returned. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+
+			if errObj.Message != expected {
+				t.Errorf("%s: wrong error message. want=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestForExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let sum = 0; for (x in [1, 2, 3]) { sum += x }; sum", 6},
+		{"let out = []; for (i, x in [5, 6]) { out = push(out, i * 10 + x) }; out", []int{5, 16}},
+		{"let out = []; for (c in \"héllo\") { out = push(out, c) }; out", []string{"h", "é", "l", "l", "o"}},
+		{"let out = []; for (i, c in \"ab\") { out = push(out, i) }; out", []int{0, 1}},
+		{"let out = []; for (k, v in {\"b\": 2, \"a\": 1}) { out = push(out, k) }; out", []string{"a", "b"}},
+		{"let sum = 0; for (v in {\"b\": 2, \"a\": 1}) { sum += v }; sum", 3},
+		{"let out = []; for (i in range(3)) { out = push(out, i) }; out", []int{0, 1, 2}},
+		{"let out = []; for (i in range(2, 11, 4)) { out = push(out, i) }; out", []int{2, 6, 10}},
+		{"let out = []; for (i in range(3, 0, -1)) { out = push(out, i) }; out", []int{3, 2, 1}},
+		{"let out = []; for (i in range(5, 5)) { out = push(out, i) }; out", []int{}},
+		{"let fs = []; for (i in range(3)) { fs = push(fs, fn() { i }) }; [fs[0](), fs[1](), fs[2]()]", []int{0, 1, 2}},
+		{"let fs = []; for (i in [1, 2]) { let d = i * 2; fs = push(fs, fn() { d }) }; [fs[0](), fs[1]()]", []int{2, 4}},
+		{"let f = fn() { let fs = []; for (i in [4, 5]) { fs = push(fs, fn() { i }) }; fs }; let fs = f(); [fs[0](), fs[1]()]", []int{4, 5}},
+		{"let x = 1; for (x in [9]) { let x = 10 }; x", 1},
+		{"let n = 0; for (i in range(10)) { if (i % 2 == 0) { continue }; if (i > 6) { break }; n += 1 }; n", 3},
+		{"let hits = []; outer: for (a in range(3)) { for (b in range(3)) { if (b > a) { continue outer }; if (a == 2) { break outer }; hits = push(hits, a * 10 + b) } }; hits", []int{0, 10, 11}},
+		{"let find = fn(xs, t) { for (i, x in xs) { if (x == t) { return i } }; -1 }; [find([4, 5, 6], 6), find([4], 1)]", []int{2, -1}},
+		{"for (x in [1, 2]) { x + true }", "type mismatch: INTEGER + BOOLEAN"},
+		{"for (x in 5) { x }", "cannot iterate over INTEGER"},
+		{"range(1, 2, 0)", "range step can't be 0"},
+		{"range(\"a\")", "argument to `range` must be INTEGER, got STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case []int:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("%s: obj not Array. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+
+			if len(array.Elements) != len(expected) {
+				t.Errorf("%s: wrong num of elements. want=%d, got=%d", tt.input, len(expected), len(array.Elements))
+				continue
+			}
+
+			for i, expectedElem := range expected {
+				testIntegerObject(t, array.Elements[i], int64(expectedElem))
+			}
+		case []string:
+			if evaluated.Inspect() != "["+strings.Join(expected, ", ")+"]" {
+				t.Errorf("%s: wrong elements. want=%v, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%s: no error object returned. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+
+			if errObj.Message != expected {
+				t.Errorf("%s: wrong error message. want=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"match (2) { 1 => 10, 2 => 20, _ => 30 }", 20},
+		{"match (7) { 1 => 10, _ => 30 }", 30},
+		{"match (-3) { -3 => 1, _ => 2 }", 1},
+		{"match (2.0) { 2 => 1, _ => 2 }", 1},
+		{"match (\"b\") { \"a\" => 1, \"b\" => 2 }", 2},
+		{"match (false) { true => 1, false => 2 }", 2},
+		{"match (\"1\") { 1 => 1, _ => 2 }", 2},
+		{"match (5) { n => n * 2 }", 10},
+		{"match ([1, 2]) { [a] => a, [a, b] => a + b, _ => 0 }", 3},
+		{"match ([1, [2, 3]]) { [a, [b, c]] => a + b + c }", 6},
+		{"match ([1, 2, 3]) { [a, b] => 0, [_, _, c] => c }", 3},
+		{"match ([1, [2]]) { [a, [b, c]] => 0, [a, [b]] => b }", 2},
+		{"match ({\"x\": 1, \"y\": 2}) { {\"x\": x, \"z\": z} => 0, {\"x\": x, \"y\": y} => x + y }", 3},
+		{"match ({\"name\": \"a\", \"age\": 30}) { {age: 30, name} => len(name) + 30 }", 31},
+		{"match ({1: [5]}) { {1: [v]} => v }", 5},
+		{"match ({\"k\": 1}) { [k] => 1, {\"k\": 2} => 2, {k} => k + 10 }", 11},
+		{"match (15) { n if n > 20 => 1, n if n > 10 => 2, _ => 3 }", 2},
+		{"match ([3, 1]) { [a, b] if a < b => 1, [a, b] => 2 }", 2},
+		{"let n = 1; match (5) { n => n }; n", 1},
+		{"let f = fn(x) { let y = match (x) { 1 => if (true) { return 100 }, _ => 0 }; y + 1 }; f(1) + f(2)", 101},
+		{"let out = []; for (i in range(4)) { let v = match (i) { 1 => if (true) { continue }, 3 => if (true) { break }, _ => i }; out = push(out, v) }; out", []int{0, 2}},
+		{"let fs = []; for (p in [[1, 2], [3, 4]]) { fs = push(fs, match (p) { [a, b] => fn() { a * b } }) }; fs[0]() + fs[1]()", 14},
+		{"match (3) { 1 => 10, 2 => 20 }", "no match arm matches INTEGER 3"},
+		{"match ([1]) { [a, b] => a }", "no match arm matches ARRAY [1]"},
+		{"match (1) { n if n + true => 1 }", "type mismatch: INTEGER + BOOLEAN"},
+		{"match (1 + true) { _ => 1 }", "type mismatch: INTEGER + BOOLEAN"},
+		{"match ([1, 2, 3]) { [a] => [a], [a, ...rest] => rest }", []int{2, 3}},
+		{"match ([1]) { [a, ...rest] => push(rest, a) }", []int{1}},
+		{"match ([]) { [a, ...rest] => 1, [..._] => 2 }", 2},
+		{"match ([1]) { [a, b = 10] => a + b }", 11},
+		{"match ([1, 2, 3]) { [a, b = 10] => 0, _ => 1 }", 1},
+		{"match ({\"a\": 1}) { {a, b: [c] = [5]} => a + c }", 6},
+		{"match ({}) { {a} => 1, {a = 2} => a }", 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case []int:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("%s: obj not Array. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+
+			if len(array.Elements) != len(expected) {
+				t.Errorf("%s: wrong num of elements. want=%d, got=%d", tt.input, len(expected), len(array.Elements))
+				continue
+			}
+
+			for i, expectedElem := range expected {
+				testIntegerObject(t, array.Elements[i], int64(expectedElem))
+			}
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%s: no error object returned. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+
+			if errObj.Message != expected {
+				t.Errorf("%s: wrong error message. want=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestDestructuringLet(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn() { [1, 2, 3] }; let [a, b, c] = f(); a * 100 + b * 10 + c", 123},
+		{"let [a, b, ...rest] = [1, 2, 3, 4]; rest", []int{3, 4}},
+		{"let [a, ...rest] = [1]; rest", []int{}},
+		{"let [_, b] = [1, 2]; b", 2},
+		{"let [a, [b, c]] = [1, [2, 3]]; a + b + c", 6},
+		{"let person = {\"name\": \"ann\", \"age\": 40}; let {name, age: years} = person; len(name) + years", 43},
+		{"let {1: one, true: yes} = {1: 10, true: 20}; one + yes", 30},
+		{"let {point: [x, y]} = {\"point\": [3, 4]}; x * y", 12},
+		{"let [a, b = 5] = [1]; a + b", 6},
+		{"let [a, b = a + 1] = [1]; b", 2},
+		{"let {a = 1, b = 2} = {\"b\": 3}; a + b", 4},
+		{"let {a: [b] = [7]} = {}; b", 7},
+		{"let f = fn(xs) { let [h, ...t] = xs; if (len(t) == 0) { h } else { h + f(t) } }; f([1, 2, 3])", 6},
+		{"let f = fn(p) { let {x, y} = p; fn() { x - y } }; f({\"x\": 5, \"y\": 2})()", 3},
+		{"let total = 0; for (p in [[1, 2], [3, 4]]) { let [a, b] = p; total += a * b }; total", 14},
+		{"let [a] = 5;", "cannot destructure INTEGER 5 as an array"},
+		{"let [a] = [1, 2];", "array of length 2 is too long to destructure, the pattern has length 1"},
+		{"let [a, b, c] = [1];", "array of length 1 is too short to destructure, the pattern needs length 2"},
+		{"let [a, b = 2, c] = [1];", "array of length 1 is too short to destructure, the pattern needs length 3"},
+		{"let {a} = [1];", "cannot destructure ARRAY [1] as a hash"},
+		{"let {a} = {\"b\": 1};", "hash has no key a to destructure"},
+		{"let [a, [b]] = [1, 2];", "cannot destructure INTEGER 2 as an array"},
+		{"let [a = 1 + true] = [];", "type mismatch: INTEGER + BOOLEAN"},
+		{"let [a] = [1] + 1;", "type mismatch: ARRAY + INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case []int:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("%s: obj not Array. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+
+			if len(array.Elements) != len(expected) {
+				t.Errorf("%s: wrong num of elements. want=%d, got=%d", tt.input, len(expected), len(array.Elements))
+				continue
+			}
+
+			for i, expectedElem := range expected {
+				testIntegerObject(t, array.Elements[i], int64(expectedElem))
+			}
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%s: no error object returned. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+
+			if errObj.Message != expected {
+				t.Errorf("%s: wrong error message. want=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"tab\there"`, "tab\there"},
+		{`"\"quoted\"" + "\n"`, "\"quoted\"\n"},
+		{"`C:\\dir\\` + `\nnext`", "C:\\dir\\\nnext"},
+		{`"caf\u{e9}"`, "café"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+
+		if !ok {
+			t.Fatalf("I wanted a String for %s but I got a %T (%+v)", tt.input, evaluated, evaluated)
+		}
+
+		if str.Value != tt.expected {
+			t.Errorf("String has the wrong value. want=%q, got=%q", tt.expected, str.Value)
+		}
+	}
+}
+
 func TestLetStatement(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -702,13 +1634,50 @@ func TestWhileStatement(t *testing.T) {
 }
 
 func testEval(input string) object.Object {
+	return testEvalContext(context.Background(), input, budget.Budget{})
+}
+
+func testEvalContext(ctx context.Context, input string, b budget.Budget) object.Object {
+	return testEvalWith(ctx, input, b, object.NewExecutionContext())
+}
+
+func testEvalExec(input string, exec *object.ExecutionContext) object.Object {
+	return testEvalWith(context.Background(), input, budget.Budget{}, exec)
+}
+
+func testEvalWith(ctx context.Context, input string, b budget.Budget, exec *object.ExecutionContext) object.Object {
 
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
+
+	if engine == "vm" {
+		return testRun(ctx, program, b, exec)
+	}
+
 	env := object.NewEnvironment()
 
-	return Eval(program, env)
+	result, _ := EvalWith(ctx, program, env, Options{Budget: b, Context: exec})
+	return result
+}
+
+func testRun(ctx context.Context, program *ast.Program, b budget.Budget, exec *object.ExecutionContext) object.Object {
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return object.NewError("%s", err)
+	}
+
+	machine := vm.New(comp.Bytecode())
+	machine.SetExecutionContext(exec)
+	if err := machine.RunContext(ctx, b); err != nil {
+		if errorObj, ok := err.(*object.Error); ok {
+			return errorObj
+		}
+
+		return object.NewError("%s", err)
+	}
+
+	return machine.Result()
 }
 
 func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
@@ -729,6 +1698,21 @@ func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	return true
 }
 
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	result, ok := obj.(*object.Integer)
 
@@ -0,0 +1,68 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"monkey/compiler"
+	"monkey/lexer"
+	"monkey/module"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+)
+
+//RunCached runs each source on engine like Run, but compiles each one
+//on its own and keeps the result in a .mkc file next to it.  Sources
+//that haven't changed since are loaded from there without parsing
+func RunCached(engine *VM, sources []Source, out io.Writer) {
+	defer redirect(engine, out)()
+
+	for _, source := range sources {
+		path := module.CachePath(source.Name)
+
+		bytecode, err := module.Load(path, source.Text)
+		if err != nil {
+			if !os.IsNotExist(err) && err != module.ErrStale {
+				if _, ok := err.(*module.VersionError); !ok {
+					fmt.Fprintf(out, "ignoring %s: %s\n", path, err)
+				}
+			}
+
+			bytecode = compileSource(engine.Builtins(), source, out)
+			if bytecode == nil {
+				continue
+			}
+
+			// A cache that can't be written only costs the next run time
+			module.Save(path, source.Text, bytecode)
+		}
+
+		evaluated := engine.RunBytecode(context.Background(), bytecode)
+		if evaluated != nil {
+			io.WriteString(out, evaluated.Inspect())
+			io.WriteString(out, "\n")
+		}
+	}
+}
+
+//compileSource parse and compile source against the builtins of table,
+//reporting problems to out.  Nil if there were any
+func compileSource(table object.BuiltinTable, source Source, out io.Writer) *compiler.Bytecode {
+	p := parser.New(lexer.NewFile(source.Name, source.Text))
+	program := p.ParseProgram()
+
+	if len(p.Diagnostics()) != 0 {
+		printParserErrors(out, source.Text, p.Diagnostics())
+		return nil
+	}
+
+	comp := compiler.NewWithBuiltins(table)
+	if err := comp.Compile(program); err != nil {
+		io.WriteString(out, object.NewError("%s", err).Inspect())
+		io.WriteString(out, "\n")
+		return nil
+	}
+
+	return comp.Bytecode()
+}
@@ -0,0 +1,245 @@
+package executor
+
+import (
+	"context"
+	"io"
+	"monkey/ast"
+	"monkey/budget"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/vm"
+)
+
+//Engine runs parsed programs, keeping globals between runs.  A run
+//stops early with an aborted *object.Error when ctx is done.  Summary
+//is what the most recent run used.  Define and Lookup reach the globals
+//from the host, DefineBuiltin adds to or replaces the engine's builtins.
+//ExecutionContext is what the builtins can reach, its streams included
+type Engine interface {
+	Run(ctx context.Context, program *ast.Program) object.Object
+	Summary() budget.Summary
+	Define(name string, value object.Object)
+	Lookup(name string) (object.Object, bool)
+	DefineBuiltin(name string, builtin *object.BuiltIn)
+	ExecutionContext() *object.ExecutionContext
+}
+
+//Options limits, permissions and streams for every run of an engine.
+//Nil Capabilities means object.DefaultCapabilities(), nil streams the
+//process's own.  StrictIntegers makes integer overflow an error rather
+//than a big integer
+type Options struct {
+	Budget         budget.Budget
+	Capabilities   *object.Capabilities
+	Stdout         io.Writer
+	Stderr         io.Writer
+	Stdin          io.Reader
+	StrictIntegers bool
+}
+
+//NewEngine engine by name, "eval" for the tree walker or "vm" for the
+//bytecode virtual machine, that runs code with opts.  Nil if the name
+//is unknown
+func NewEngine(name string, env *object.Environment, opts Options) Engine {
+	exec := object.NewExecutionContext()
+	if opts.Capabilities != nil {
+		exec.Capabilities = opts.Capabilities
+	}
+	if opts.Stdout != nil {
+		exec.Stdout = opts.Stdout
+	}
+	if opts.Stderr != nil {
+		exec.Stderr = opts.Stderr
+	}
+	if opts.Stdin != nil {
+		exec.Stdin = opts.Stdin
+	}
+	exec.StrictIntegers = opts.StrictIntegers
+
+	switch name {
+	case "eval", "":
+		tw := NewTreeWalker(env)
+		tw.Budget = opts.Budget
+		tw.Context = exec
+		return tw
+	case "vm":
+		v := NewVM()
+		v.Budget = opts.Budget
+		v.Context = exec
+		return v
+	default:
+		return nil
+	}
+}
+
+//TreeWalker runs programs with evaluator.Eval.  Context is what the
+//builtins it calls can reach
+type TreeWalker struct {
+	Budget  budget.Budget
+	Context *object.ExecutionContext
+
+	env      *object.Environment
+	builtins object.BuiltinTable
+	summary  budget.Summary
+}
+
+//NewTreeWalker tree walking engine over env with the default builtins
+func NewTreeWalker(env *object.Environment) *TreeWalker {
+	return &TreeWalker{env: env, builtins: object.Builtins, Context: object.NewExecutionContext()}
+}
+
+//Run evaluate program
+func (tw *TreeWalker) Run(ctx context.Context, program *ast.Program) (result object.Object) {
+	defer recoverInternalError(&result)
+
+	opts := evaluator.Options{Budget: tw.Budget, Builtins: tw.builtins, Context: tw.Context}
+
+	result, summary := evaluator.EvalWith(ctx, program, tw.env, opts)
+	tw.summary = summary
+
+	return result
+}
+
+//Define bind name in the global environment
+func (tw *TreeWalker) Define(name string, value object.Object) {
+	tw.env.Set(name, value)
+}
+
+//Lookup the global called name
+func (tw *TreeWalker) Lookup(name string) (object.Object, bool) {
+	return tw.env.Get(name)
+}
+
+//DefineBuiltin make builtin callable as name
+func (tw *TreeWalker) DefineBuiltin(name string, builtin *object.BuiltIn) {
+	tw.builtins = tw.builtins.With(name, builtin)
+}
+
+//Summary what the last run used
+func (tw *TreeWalker) Summary() budget.Summary {
+	return tw.summary
+}
+
+//ExecutionContext what the builtins can reach
+func (tw *TreeWalker) ExecutionContext() *object.ExecutionContext {
+	return tw.Context
+}
+
+//VM compiles programs to bytecode and runs them on the virtual machine.
+//Context is what the builtins it calls can reach
+type VM struct {
+	Budget  budget.Budget
+	Context *object.ExecutionContext
+
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+	builtins    object.BuiltinTable
+	summary     budget.Summary
+}
+
+//NewVM bytecode engine with nothing defined yet but the default builtins
+func NewVM() *VM {
+	return &VM{
+		symbolTable: compiler.NewBuiltinSymbolTable(object.Builtins),
+		constants:   []object.Object{},
+		globals:     make([]object.Object, vm.GlobalsSize),
+		builtins:    object.Builtins,
+		Context:     object.NewExecutionContext(),
+	}
+}
+
+//Define bind the global name
+func (v *VM) Define(name string, value object.Object) {
+	symbol := v.symbolTable.Define(name)
+	v.globals[symbol.Index] = value
+}
+
+//Lookup the global called name
+func (v *VM) Lookup(name string) (object.Object, bool) {
+	symbol, ok := v.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope || v.globals[symbol.Index] == nil {
+		return nil, false
+	}
+
+	return v.globals[symbol.Index], true
+}
+
+//DefineBuiltin make builtin callable as name.  Builtins keep their
+//place in the table, so code compiled earlier still finds its own
+func (v *VM) DefineBuiltin(name string, builtin *object.BuiltIn) {
+	v.builtins = v.builtins.With(name, builtin)
+	v.symbolTable.DefineBuiltin(v.builtins.Index(name), name)
+}
+
+//Builtins the builtins code run on the engine can call
+func (v *VM) Builtins() object.BuiltinTable {
+	return v.builtins
+}
+
+//Run compile and run program, errors of either kind come back as
+//*object.Error like they do from the evaluator
+func (v *VM) Run(ctx context.Context, program *ast.Program) (result object.Object) {
+	defer recoverInternalError(&result)
+
+	comp := compiler.NewWithState(v.symbolTable, v.constants)
+	if err := comp.Compile(program); err != nil {
+		return object.NewError("%s", err)
+	}
+
+	return v.run(ctx, comp.Bytecode())
+}
+
+//RunBytecode link bytecode compiled on its own, say loaded from a .mkc
+//file, against what has run before and run it
+func (v *VM) RunBytecode(ctx context.Context, bytecode *compiler.Bytecode) (result object.Object) {
+	defer recoverInternalError(&result)
+
+	linked, err := compiler.Link(bytecode, v.symbolTable, v.constants)
+	if err != nil {
+		return object.NewError("%s", err)
+	}
+
+	return v.run(ctx, linked)
+}
+
+func (v *VM) run(ctx context.Context, bytecode *compiler.Bytecode) object.Object {
+	v.constants = bytecode.Constants
+
+	machine := vm.NewWithGlobalsStore(bytecode, v.globals)
+	machine.SetBuiltins(v.builtins)
+	machine.SetExecutionContext(v.Context)
+	err := machine.RunContext(ctx, v.Budget)
+	v.summary = machine.Summary()
+
+	if err != nil {
+		if errorObj, ok := err.(*object.Error); ok {
+			return errorObj
+		}
+
+		return object.NewError("%s", err)
+	}
+
+	return machine.Result()
+}
+
+//Summary what the last run used
+func (v *VM) Summary() budget.Summary {
+	return v.summary
+}
+
+//ExecutionContext what the builtins can reach
+func (v *VM) ExecutionContext() *object.ExecutionContext {
+	return v.Context
+}
+
+//recoverInternalError turn a panic in the engine or a builtin into an
+//InternalError result, so a bug ends the run rather than the process
+func recoverInternalError(result *object.Object) {
+	if r := recover(); r != nil {
+		err := object.NewError("internal error: %v", r)
+		err.Kind = object.InternalError
+		*result = err
+	}
+}
@@ -1,8 +1,9 @@
 package executor
 
 import (
+	"context"
 	"io"
-	"monkey/evaluator"
+	"monkey/diagnostic"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
@@ -21,20 +22,51 @@ const monkeyFace = `            __,__
            '-----'
 `
 
-//Run run
+//Source monkey code and the name of the file it came from
+type Source struct {
+	Name string
+	Text string
+}
+
+//Execute runs unnamed sources one after the other in env, printing to
+//out
 func Execute(sources []string, env *object.Environment, out io.Writer) {
+	named := []Source{}
 	for _, source := range sources {
+		named = append(named, Source{Text: source})
+	}
+
+	ExecuteSources(named, env, out)
+}
+
+//ExecuteSources runs each source in env, errors are reported against
+//the source's name
+func ExecuteSources(sources []Source, env *object.Environment, out io.Writer) {
+	Run(NewTreeWalker(env), sources, out)
+}
+
+//Run runs each source on engine, one after the other.  What the sources
+//print goes to out along with their results and errors
+func Run(engine Engine, sources []Source, out io.Writer) {
+	RunContext(context.Background(), engine, sources, out)
+}
 
-		l := lexer.New(source)
+//RunContext like Run, but stops early when ctx is done
+func RunContext(ctx context.Context, engine Engine, sources []Source, out io.Writer) {
+	defer redirect(engine, out)()
+
+	for _, source := range sources {
+
+		l := lexer.NewFile(source.Name, source.Text)
 		p := parser.New(l)
 		program := p.ParseProgram()
 
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+		if len(p.Diagnostics()) != 0 {
+			printParserErrors(out, source.Text, p.Diagnostics())
 			continue
 		}
 
-		evaluated := evaluator.Eval(program, env)
+		evaluated := engine.Run(ctx, program)
 		if evaluated != nil {
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
@@ -43,11 +75,21 @@ func Execute(sources []string, env *object.Environment, out io.Writer) {
 
 }
 
-func printParserErrors(out io.Writer, errors []string) {
+//redirect send what engine's builtins print to standard output to out
+//until the returned func puts it back
+func redirect(engine Engine, out io.Writer) func() {
+	exec := engine.ExecutionContext()
+	stdout := exec.Stdout
+	exec.Stdout = out
+
+	return func() {
+		exec.Stdout = stdout
+	}
+}
+
+func printParserErrors(out io.Writer, source string, diagnostics []diagnostic.Diagnostic) {
 	io.WriteString(out, monkeyFace)
 	io.WriteString(out, "Woops! We ran into some monkey business here!\n")
 	io.WriteString(out, " parser errors:\n")
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
-	}
+	diagnostic.RenderAll(out, source, diagnostics)
 }
@@ -0,0 +1,105 @@
+package interpreter
+
+import (
+	"fmt"
+	"monkey/object"
+	"reflect"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+//adapt wrap fn so monkey can call it, checking up front that every
+//parameter and result can be converted
+func adapt(name string, fn interface{}) (*object.BuiltIn, error) {
+	if builtin, ok := fn.(func(ctx *object.ExecutionContext, args ...object.Object) object.Object); ok {
+		return &object.BuiltIn{Fn: builtin}, nil
+	}
+	if builtin, ok := fn.(object.BuiltInFunction); ok {
+		return &object.BuiltIn{Fn: builtin}, nil
+	}
+
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, fmt.Errorf("can't register %s: %T isn't a function", name, fn)
+	}
+	t := v.Type()
+
+	for p := 0; p < t.NumIn(); p++ {
+		in := t.In(p)
+		if t.IsVariadic() && p == t.NumIn()-1 {
+			in = in.Elem()
+		}
+
+		if err := object.Convertible(in); err != nil {
+			return nil, fmt.Errorf("can't register %s: parameter %d: %s", name, p+1, err)
+		}
+	}
+
+	results := t.NumOut()
+	returnsError := results > 0 && t.Out(results-1) == errorType
+	if returnsError {
+		results--
+	}
+	if results > 1 {
+		return nil, fmt.Errorf("can't register %s: returns more than one value", name)
+	}
+	if results == 1 {
+		if err := object.Convertible(t.Out(0)); err != nil {
+			return nil, fmt.Errorf("can't register %s: result: %s", name, err)
+		}
+	}
+
+	return &object.BuiltIn{Fn: func(ctx *object.ExecutionContext, args ...object.Object) object.Object {
+		in, err := arguments(name, t, args)
+		if err != nil {
+			return err
+		}
+
+		out := v.Call(in)
+
+		if returnsError && !out[len(out)-1].IsNil() {
+			return object.NewError("%s", out[len(out)-1].Interface().(error))
+		}
+
+		if results == 0 {
+			return object.NULL
+		}
+
+		result, convErr := object.FromGoValue(out[0])
+		if convErr != nil {
+			return object.NewError("result of `%s`: %s", name, convErr)
+		}
+
+		return result
+	}}, nil
+}
+
+func arguments(name string, t reflect.Type, args []object.Object) ([]reflect.Value, *object.Error) {
+	fixed := t.NumIn()
+	if t.IsVariadic() {
+		fixed--
+		if len(args) < fixed {
+			return nil, object.NewError("wrong number of arguments to `%s`. got=%d, want at least %d", name, len(args), fixed)
+		}
+	} else if len(args) != fixed {
+		return nil, object.NewError("wrong number of arguments to `%s`. got=%d, want=%d", name, len(args), fixed)
+	}
+
+	in := make([]reflect.Value, len(args))
+	for p, arg := range args {
+		var want reflect.Type
+		if p < fixed {
+			want = t.In(p)
+		} else {
+			want = t.In(fixed).Elem()
+		}
+
+		value, err := object.ToGoValue(arg, want)
+		if err != nil {
+			return nil, object.NewError("argument %d to `%s` %s", p+1, name, err)
+		}
+		in[p] = value
+	}
+
+	return in, nil
+}
@@ -0,0 +1,145 @@
+package interpreter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"monkey/budget"
+	"monkey/diagnostic"
+	"monkey/executor"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strings"
+)
+
+//maxBuiltins compiled code refers to builtins with a one byte operand
+const maxBuiltins = 256
+
+//Options how an Interpreter runs code.  The zero value runs on the tree
+//walker without limits, with object.DefaultCapabilities(), on the
+//process's standard streams, and integers that overflow become big
+//integers rather than errors as they do with StrictIntegers
+type Options struct {
+	Engine         string
+	Budget         budget.Budget
+	Capabilities   *object.Capabilities
+	Stdout         io.Writer
+	Stderr         io.Writer
+	Stdin          io.Reader
+	StrictIntegers bool
+}
+
+//Interpreter a monkey runtime for embedding in Go programs.  Each one
+//has its own globals and builtins, so interpreters never see each
+//other's definitions
+type Interpreter struct {
+	engine   executor.Engine
+	builtins map[string]bool
+}
+
+//ParseError the source couldn't be parsed
+type ParseError struct {
+	Diagnostics []diagnostic.Diagnostic
+}
+
+func (e *ParseError) Error() string {
+	messages := []string{}
+	for _, d := range e.Diagnostics {
+		messages = append(messages, d.Error())
+	}
+
+	return strings.Join(messages, "\n")
+}
+
+//New interpreter with the default builtins, printing to and reading
+//from the streams in opts
+func New(opts Options) (*Interpreter, error) {
+	engineOpts := executor.Options{
+		Budget:         opts.Budget,
+		Capabilities:   opts.Capabilities,
+		Stdout:         opts.Stdout,
+		Stderr:         opts.Stderr,
+		Stdin:          opts.Stdin,
+		StrictIntegers: opts.StrictIntegers,
+	}
+	engine := executor.NewEngine(opts.Engine, object.NewEnvironment(), engineOpts)
+	if engine == nil {
+		return nil, fmt.Errorf("unknown engine %q", opts.Engine)
+	}
+
+	i := &Interpreter{engine: engine, builtins: map[string]bool{}}
+
+	for _, def := range object.Builtins {
+		i.builtins[def.Name] = true
+	}
+
+	return i, nil
+}
+
+//Register make the Go function fn callable from monkey as name.  fn's
+//parameters and results are converted with object.ToGo and
+//object.FromGo, and a last result of type error becomes a runtime error
+//when it isn't nil.  A function that takes and returns object.Object
+//values as object.BuiltInFunction does is used as it is
+func (i *Interpreter) Register(name string, fn interface{}) error {
+	builtin, err := adapt(name, fn)
+	if err != nil {
+		return err
+	}
+
+	return i.RegisterBuiltin(name, builtin)
+}
+
+//RegisterBuiltin make builtin callable from monkey as name.  Set its
+//Needs for a builtin that only some interpreters should be able to call
+func (i *Interpreter) RegisterBuiltin(name string, builtin *object.BuiltIn) error {
+	if !i.builtins[name] && len(i.builtins) >= maxBuiltins {
+		return fmt.Errorf("can't register %s: at most %d builtins", name, maxBuiltins)
+	}
+	i.builtins[name] = true
+
+	i.engine.DefineBuiltin(name, builtin)
+
+	return nil
+}
+
+//Set bind the global name to value
+func (i *Interpreter) Set(name string, value object.Object) {
+	i.engine.Define(name, value)
+}
+
+//Get the value of the global called name
+func (i *Interpreter) Get(name string) (object.Object, bool) {
+	return i.engine.Lookup(name)
+}
+
+//Eval run source, see Run
+func (i *Interpreter) Eval(ctx context.Context, source string) (object.Object, error) {
+	return i.Run(ctx, "", source)
+}
+
+//Run run source, which came from the file called name, in the
+//interpreter's globals.  Errors are a *ParseError or a runtime
+//*object.Error.  The value is nil when the code doesn't end in an
+//expression
+func (i *Interpreter) Run(ctx context.Context, name string, source string) (object.Object, error) {
+	p := parser.New(lexer.NewFile(name, source))
+	program := p.ParseProgram()
+
+	if len(p.Diagnostics()) != 0 {
+		return nil, &ParseError{Diagnostics: p.Diagnostics()}
+	}
+
+	result := i.engine.Run(ctx, program)
+	if err, ok := result.(*object.Error); ok {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+//Summary what the last run used
+func (i *Interpreter) Summary() budget.Summary {
+	return i.engine.Summary()
+}
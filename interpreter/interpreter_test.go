@@ -0,0 +1,230 @@
+package interpreter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"monkey/object"
+	"strings"
+	"testing"
+)
+
+var engines = []string{"eval", "vm"}
+
+func newInterpreter(t *testing.T, engine string, out *bytes.Buffer) *Interpreter {
+	i, err := New(Options{Engine: engine, Stdout: out})
+	if err != nil {
+		t.Fatalf("New failed: %s", err)
+	}
+
+	return i
+}
+
+func TestRegister(t *testing.T) {
+	for _, engine := range engines {
+		i := newInterpreter(t, engine, &bytes.Buffer{})
+
+		err := i.Register("repeat", func(n int64, s string) (string, error) {
+			if n < 0 {
+				return "", errors.New("negative count")
+			}
+			return strings.Repeat(s, int(n)), nil
+		})
+		if err != nil {
+			t.Fatalf("Register failed: %s", err)
+		}
+
+		err = i.Register("sum", func(xs ...int) int {
+			total := 0
+			for _, x := range xs {
+				total += x
+			}
+			return total
+		})
+		if err != nil {
+			t.Fatalf("Register failed: %s", err)
+		}
+
+		err = i.Register("kind", func(o object.Object) string { return string(o.Type()) })
+		if err != nil {
+			t.Fatalf("Register failed: %s", err)
+		}
+
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{`repeat(3, "ab")`, "ababab"},
+			{`sum(1, 2, 3, 4)`, "10"},
+			{`sum()`, "0"},
+			{`kind([1])`, "ARRAY"},
+			{`let r = fn(n) { repeat(n, "x") }; r(2)`, "xx"},
+		}
+
+		for _, tt := range tests {
+			result, err := i.Eval(context.Background(), tt.input)
+			if err != nil {
+				t.Errorf("[%s] %q failed: %s", engine, tt.input, err)
+				continue
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("[%s] %q wrong result. want=%q, got=%q", engine, tt.input, tt.expected, result.Inspect())
+			}
+		}
+
+		errorTests := []struct {
+			input    string
+			expected string
+		}{
+			{`repeat(-1, "ab")`, "negative count"},
+			{`repeat("3", "ab")`, "argument 1 to `repeat` must be INTEGER, got STRING"},
+			{`repeat(3)`, "wrong number of arguments to `repeat`. got=1, want=2"},
+			{`sum(1, true)`, "argument 2 to `sum` must be INTEGER, got BOOLEAN"},
+		}
+
+		for _, tt := range errorTests {
+			_, err := i.Eval(context.Background(), tt.input)
+			errObj, ok := err.(*object.Error)
+			if !ok {
+				t.Errorf("[%s] %q: expected a runtime error. got=%v", engine, tt.input, err)
+				continue
+			}
+			if errObj.Message != tt.expected {
+				t.Errorf("[%s] %q wrong message. want=%q, got=%q", engine, tt.input, tt.expected, errObj.Message)
+			}
+			if !errObj.Pos.IsValid() {
+				t.Errorf("[%s] %q: error has no position", engine, tt.input)
+			}
+		}
+	}
+}
+
+func TestRegisterRejectsUnsupportedFunctions(t *testing.T) {
+	i := newInterpreter(t, "eval", &bytes.Buffer{})
+
+	tests := []interface{}{
+		42,
+		func(c complex64) {},
+		func() (int, int) { return 0, 0 },
+		func() chan int { return nil },
+	}
+
+	for _, fn := range tests {
+		if err := i.Register("bad", fn); err == nil {
+			t.Errorf("expected an error registering %T", fn)
+		}
+	}
+}
+
+func TestInterpretersAreIsolated(t *testing.T) {
+	for _, engine := range engines {
+		var outA, outB bytes.Buffer
+		a := newInterpreter(t, engine, &outA)
+		b := newInterpreter(t, engine, &outB)
+
+		a.Register("greet", func() string { return "hello from a" })
+		a.Set("limit", &object.Integer{Value: 10})
+
+		if _, err := a.Eval(context.Background(), `let x = limit * 2; puts(greet())`); err != nil {
+			t.Fatalf("[%s] eval failed: %s", engine, err)
+		}
+
+		if x, ok := a.Get("x"); !ok || x.Inspect() != "20" {
+			t.Errorf("[%s] wrong value for x. got=%v", engine, x)
+		}
+
+		if outA.String() != "hello from a\n" {
+			t.Errorf("[%s] wrong output. got=%q", engine, outA.String())
+		}
+
+		if _, err := b.Eval(context.Background(), `greet()`); err == nil {
+			t.Errorf("[%s] builtin leaked between interpreters", engine)
+		}
+		if _, ok := b.Get("x"); ok {
+			t.Errorf("[%s] global leaked between interpreters", engine)
+		}
+		if outB.Len() != 0 {
+			t.Errorf("[%s] output leaked between interpreters: %q", engine, outB.String())
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	i := newInterpreter(t, "eval", &bytes.Buffer{})
+
+	_, err := i.Run(context.Background(), "rules.monkey", "let = 5;")
+	parseErr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("expected a *ParseError. got=%T (%v)", err, err)
+	}
+
+	if len(parseErr.Diagnostics) != 1 || parseErr.Diagnostics[0].Pos.Filename != "rules.monkey" {
+		t.Errorf("wrong diagnostics: %v", parseErr.Diagnostics)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	for _, engine := range engines {
+		out := &bytes.Buffer{}
+		i, err := New(Options{Engine: engine, Stdout: out, Capabilities: &object.Capabilities{Granted: object.CapClock}})
+		if err != nil {
+			t.Fatalf("New failed: %s", err)
+		}
+
+		if _, err := i.Eval(context.Background(), "now()"); err != nil {
+			t.Errorf("[%s] granted capability refused: %s", engine, err)
+		}
+
+		_, err = i.Eval(context.Background(), `puts("hi")`)
+		errObj, ok := err.(*object.Error)
+		if !ok || errObj.Kind != object.PermissionError {
+			t.Errorf("[%s] puts without stdout should be refused. got=%v", engine, err)
+		}
+		if out.Len() != 0 {
+			t.Errorf("[%s] puts printed without permission: %q", engine, out.String())
+		}
+	}
+}
+
+func TestPanicsBecomeInternalErrors(t *testing.T) {
+	for _, engine := range engines {
+		i := newInterpreter(t, engine, &bytes.Buffer{})
+
+		i.Register("explode", func() int64 {
+			var values []int64
+			return values[3]
+		})
+
+		_, err := i.Eval(context.Background(), "1 + explode()")
+		errObj, ok := err.(*object.Error)
+		if !ok || errObj.Kind != object.InternalError {
+			t.Fatalf("[%s] a panic should be an internal error. got=%v", engine, err)
+		}
+		if !strings.HasPrefix(errObj.Message, "internal error: ") {
+			t.Errorf("[%s] wrong message: %s", engine, errObj.Message)
+		}
+
+		result, err := i.Eval(context.Background(), "1 + 2")
+		if err != nil || result.Inspect() != "3" {
+			t.Errorf("[%s] interpreter unusable after a panic. got=%v, %v", engine, result, err)
+		}
+	}
+}
+
+func ExampleInterpreter_Register() {
+	i, _ := New(Options{})
+
+	i.Register("discount", func(price int64, percent int64) int64 {
+		return price - price*percent/100
+	})
+
+	result, err := i.Eval(context.Background(), `discount(200, 15)`)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println(result.Inspect())
+	// Output: 170
+}
@@ -1,27 +1,81 @@
 package lexer
 
-import "monkey/token"
+import (
+	"fmt"
+	"monkey/diagnostic"
+	"monkey/token"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	//CodeUnterminatedComment a block comment runs to the end of the input
+	CodeUnterminatedComment = "L0001"
+	//CodeUnterminatedString a string runs to the end of the input
+	CodeUnterminatedString = "L0002"
+	//CodeInvalidEscape a backslash in a string isn't a known escape
+	CodeInvalidEscape = "L0003"
+)
 
 //Lexer monkey's work-in-progress lexer
 type Lexer struct {
+	filename     string
 	input        string
 	position     int
 	readPosition int
 	ch           byte
+
+	line      int
+	lineStart int
+
+	diagnostics []diagnostic.Diagnostic
+
+	// interpolations the ${ } being lexed, innermost last
+	interpolations []interpolation
+}
+
+//interpolation a ${ } in a string, start is where the string's opening
+//quote is and depth counts the braces open inside it
+type interpolation struct {
+	start token.Position
+	depth int
 }
 
 //New Default ctor
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewFile("", input)
+}
+
+//NewFile lexer whose token positions carry the given file name
+func NewFile(filename string, input string) *Lexer {
+	l := &Lexer{filename: filename, input: input, line: 1}
 	l.readChar()
 	return l
 }
 
-//NextToken returns the next token in the sequence
+//Diagnostics problems found in the tokens read so far.  The lexer
+//carries on past them, a string with a bad escape is still a STRING and
+//an unterminated one ends at the end of the input
+func (l *Lexer) Diagnostics() []diagnostic.Diagnostic {
+	return l.diagnostics
+}
+
+//NextToken returns the next token in the sequence, with the comments
+//in front of it
 func (l *Lexer) NextToken() token.Token {
+	comments := l.skipTrivia()
+
+	tok := l.readToken()
+	tok.Comments = comments
+
+	return tok
+}
+
+func (l *Lexer) readToken() token.Token {
 	var tok token.Token
 
-	l.skipWhitespace() // Can also try breaking out of the char
+	start := l.currentPosition()
 
 	switch l.ch {
 	case '=':
@@ -29,6 +83,10 @@ func (l *Lexer) NextToken() token.Token {
 			ch := l.ch
 			l.readChar()
 			tok = token.Token{Type: token.EQ, Literal: string(ch) + string(l.ch)}
+		} else if l.peekChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.FAT_ARROW, Literal: string(ch) + string(l.ch)}
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
@@ -41,17 +99,27 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		tok = l.pairedToken(token.PLUS, map[byte]token.TokenType{'=': token.PLUS_ASSIGN})
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		tok = l.pairedToken(token.MINUS, map[byte]token.TokenType{'=': token.MINUS_ASSIGN})
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		tok = l.pairedToken(token.SLASH, map[byte]token.TokenType{'=': token.SLASH_ASSIGN})
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		tok = l.pairedToken(token.ASTERISK, map[byte]token.TokenType{'*': token.POWER, '=': token.ASTERISK_ASSIGN})
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		tok = l.pairedToken(token.LT, map[byte]token.TokenType{'=': token.LT_EQ, '<': token.SHIFT_LEFT})
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		tok = l.pairedToken(token.GT, map[byte]token.TokenType{'=': token.GT_EQ, '>': token.SHIFT_RIGHT})
+	case '&':
+		tok = l.pairedToken(token.AMPERSAND, map[byte]token.TokenType{'&': token.AND})
+	case '|':
+		tok = l.pairedToken(token.PIPE, map[byte]token.TokenType{'|': token.OR})
+	case '^':
+		tok = newToken(token.CARET, l.ch)
+	case '~':
+		tok = newToken(token.TILDE, l.ch)
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case '(':
@@ -61,8 +129,21 @@ func (l *Lexer) NextToken() token.Token {
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
 	case '{':
+		if n := len(l.interpolations); n > 0 {
+			l.interpolations[n-1].depth++
+		}
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
+		n := len(l.interpolations)
+		if n > 0 && l.interpolations[n-1].depth == 0 {
+			opened := l.interpolations[n-1].start
+			l.interpolations = l.interpolations[:n-1]
+			tok.Literal, tok.Type = l.readString(opened, token.STRING_MIDDLE, token.STRING_TAIL)
+			break
+		}
+		if n > 0 {
+			l.interpolations[n-1].depth--
+		}
 		tok = newToken(token.RBRACE, l.ch)
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
@@ -70,21 +151,36 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.RBRACKET, l.ch)
 	case ':':
 		tok = newToken(token.COLON, l.ch)
+	case '.':
+		if l.peekChar() == '.' && l.readPosition+1 < len(l.input) && l.input[l.readPosition+1] == '.' {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case '"':
+		tok.Literal, tok.Type = l.readString(start, token.STRING_HEAD, token.STRING)
+	case '`':
 		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		tok.Literal = l.readRawString(start)
 	case 0:
+		if len(l.interpolations) > 0 {
+			l.unterminatedString(l.interpolations[0].start)
+			l.interpolations = nil
+		}
 		tok.Literal = ""
 		tok.Type = token.EOF
 	default:
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos, tok.End = start, l.currentPosition()
 
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Literal = l.readNumber()
-			tok.Type = token.INT
+			tok.Literal, tok.Type = l.readNumber()
+			tok.Pos, tok.End = start, l.currentPosition()
 
 			return tok
 		}
@@ -93,16 +189,117 @@ func (l *Lexer) NextToken() token.Token {
 	}
 
 	l.readChar()
+	tok.Pos, tok.End = start, l.currentPosition()
 	return tok
 }
 
-func (l *Lexer) readNumber() string {
+//skipTrivia skip whitespace and comments, returning the comments.  A
+//block comment that's never closed takes the rest of the input
+func (l *Lexer) skipTrivia() []token.Comment {
+	var comments []token.Comment
+
+	for {
+		l.skipWhitespace()
+
+		if l.ch != '/' || (l.peekChar() != '/' && l.peekChar() != '*') {
+			return comments
+		}
+
+		start := l.currentPosition()
+		closed := true
+		if l.peekChar() == '/' {
+			l.skipLineComment()
+		} else {
+			closed = l.skipBlockComment()
+		}
+
+		end := l.currentPosition()
+		text := l.input[start.Offset:end.Offset]
+
+		if !closed {
+			l.addError(CodeUnterminatedComment, start, end, "unterminated block comment", "insert a closing \"*/\"")
+		}
+
+		comments = append(comments, token.Comment{Text: text, Pos: start, End: end})
+	}
+}
+
+func (l *Lexer) skipLineComment() {
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+}
+
+//skipBlockComment skip a block comment and any nested in it, false when
+//the input ends first
+func (l *Lexer) skipBlockComment() bool {
+	depth := 0
+
+	for l.ch != 0 {
+		switch {
+		case l.ch == '/' && l.peekChar() == '*':
+			depth++
+			l.readChar()
+		case l.ch == '*' && l.peekChar() == '/':
+			depth--
+			l.readChar()
+		}
+		l.readChar()
+
+		if depth == 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (l *Lexer) currentPosition() token.Position {
+	return token.Position{
+		Filename: l.filename,
+		Offset:   l.position,
+		Line:     l.line,
+		Column:   l.position - l.lineStart + 1,
+	}
+}
+
+//readNumber an integer, or a float when the digits go on to a fraction
+//or an exponent: 3.14, 1e-9, 2.5E3
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	position := l.position
-	for isDigit(l.ch) {
+	tokenType := token.TokenType(token.INT)
+
+	l.readDigits()
+
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
 		l.readChar()
+		l.readDigits()
 	}
 
-	return l.input[position:l.position]
+	if l.ch == 'e' || l.ch == 'E' {
+		next := l.peekChar()
+		if (next == '+' || next == '-') && l.readPosition+1 < len(l.input) {
+			next = l.input[l.readPosition+1]
+		}
+
+		if isDigit(next) {
+			tokenType = token.FLOAT
+			l.readChar()
+			if l.ch == '+' || l.ch == '-' {
+				l.readChar()
+			}
+			l.readDigits()
+		}
+	}
+
+	return l.input[position:l.position], tokenType
+}
+
+func (l *Lexer) readDigits() {
+	for isDigit(l.ch) {
+		l.readChar()
+	}
 }
 
 func (l *Lexer) readIdentifier() string {
@@ -114,12 +311,117 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readString() string {
+//readString the text of a "" string with its escapes decoded, up to its
+//closing quote or the next ${.  The token is an interpolated when it
+//stops at a ${ and closed when it stops at the quote.  start is where
+//the string's opening quote is
+func (l *Lexer) readString(start token.Position, interpolated, closed token.TokenType) (string, token.TokenType) {
+	var out strings.Builder
+
+	for {
+		l.readChar()
+
+		switch l.ch {
+		case '"':
+			return out.String(), closed
+		case '$':
+			if l.peekChar() != '{' {
+				out.WriteByte(l.ch)
+				continue
+			}
+			l.readChar()
+			l.interpolations = append(l.interpolations, interpolation{start: start})
+			return out.String(), interpolated
+		case 0:
+			l.unterminatedString(start)
+			return out.String(), closed
+		case '\\':
+			l.readEscape(&out)
+		default:
+			out.WriteByte(l.ch)
+		}
+	}
+}
+
+//readEscape decode the escape sequence starting at the backslash under
+//the lexer.  One it doesn't know is an error and is kept as written
+func (l *Lexer) readEscape(out *strings.Builder) {
+	start := l.currentPosition()
+	l.readChar()
+
+	switch l.ch {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case 'r':
+		out.WriteByte('\r')
+	case '\\', '"', '$':
+		out.WriteByte(l.ch)
+	case 'u':
+		if r, ok := l.readUnicodeEscape(); ok {
+			out.WriteRune(r)
+			return
+		}
+		l.invalidEscape(start, out, "write a code point as \\u{1F600}")
+	case 0:
+		// Unterminated, readString reports it
+	default:
+		l.invalidEscape(start, out, "write a backslash as \\\\")
+	}
+}
+
+//readUnicodeEscape the code point in the {hex} after a \u
+func (l *Lexer) readUnicodeEscape() (rune, bool) {
+	if l.peekChar() != '{' {
+		return 0, false
+	}
+	l.readChar()
+
+	digits := l.readPosition
+	for isHexDigit(l.peekChar()) {
+		l.readChar()
+	}
+	hex := l.input[digits:l.readPosition]
+
+	if l.peekChar() != '}' || len(hex) == 0 || len(hex) > 6 {
+		return 0, false
+	}
+	l.readChar()
+
+	value, _ := strconv.ParseUint(hex, 16, 32)
+	if !utf8.ValidRune(rune(value)) {
+		return 0, false
+	}
+
+	return rune(value), true
+}
+
+func (l *Lexer) invalidEscape(start token.Position, out *strings.Builder, hint string) {
+	text := l.input[start.Offset:l.readPosition]
+	out.WriteString(text)
+
+	end := l.currentPosition()
+	end.Offset++
+	end.Column++
+
+	l.addError(CodeInvalidEscape, start, end, fmt.Sprintf("invalid escape sequence %s", text), hint)
+}
+
+//readRawString the contents of a `` string as written, newlines and
+//backslashes included, start is where its opening backtick is
+func (l *Lexer) readRawString(start token.Position) string {
 	position := l.position + 1
+
 	for {
 		l.readChar()
 
-		if l.ch == '"' || l.ch == 0 {
+		if l.ch == '`' {
+			break
+		}
+
+		if l.ch == 0 {
+			l.addError(CodeUnterminatedString, start, l.currentPosition(), "unterminated raw string", "insert a closing \"`\"")
 			break
 		}
 	}
@@ -127,10 +429,29 @@ func (l *Lexer) readString() string {
 	return l.input[position:l.position]
 }
 
+func (l *Lexer) unterminatedString(start token.Position) {
+	l.addError(CodeUnterminatedString, start, l.currentPosition(), "unterminated string", "insert a closing '\"'")
+}
+
+func (l *Lexer) addError(code string, pos, end token.Position, msg, hint string) {
+	l.diagnostics = append(l.diagnostics, diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     code,
+		Message:  msg,
+		Pos:      pos,
+		End:      end,
+		Hint:     hint,
+	})
+}
+
 func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
 
+func isHexDigit(ch byte) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
 func isLetter(ch byte) bool {
 	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
 }
@@ -141,11 +462,34 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
+//pairedToken the two character token in pairs when the next character
+//completes one, otherwise single
+func (l *Lexer) pairedToken(single token.TokenType, pairs map[byte]token.TokenType) token.Token {
+	if pair, ok := pairs[l.peekChar()]; ok {
+		ch := l.ch
+		l.readChar()
+		return token.Token{Type: pair, Literal: string(ch) + string(l.ch)}
+	}
+
+	return newToken(single, l.ch)
+}
+
 func newToken(tokenType token.TokenType, ch byte) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
 func (l *Lexer) readChar() {
+	// Parked at the end, keep EOF positions pointing at the end of input
+	if l.readPosition > len(l.input) {
+		l.ch = 0
+		return
+	}
+
+	if l.ch == '\n' {
+		l.line++
+		l.lineStart = l.readPosition
+	}
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
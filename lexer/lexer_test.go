@@ -17,7 +17,7 @@ func TestNextToken(t *testing.T) {
 	};
 
 	let result = add(five, ten);
-	!-/*5;
+	!-/ *5;
 	5 < 10 > 5;
 
 	if (5 < 10) {
@@ -158,3 +158,353 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestNumbers(t *testing.T) {
+	input := "3.14 1e-9 2.5E+3 7 1e x 4.foo"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "1e-9"},
+		{token.FLOAT, "2.5E+3"},
+		{token.INT, "7"},
+		{token.INT, "1"},
+		{token.IDENT, "e"},
+		{token.IDENT, "x"},
+		{token.INT, "4"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "foo"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%s %q, got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestLoopAndMatchKeywords(t *testing.T) {
+	input := `while (true) { break; continue }
+	for (k, v in h) {}
+	match (x) { _ => 1 }`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.WHILE, "while"},
+		{token.LPAREN, "("},
+		{token.TRUE, "true"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.BREAK, "break"},
+		{token.SEMICOLON, ";"},
+		{token.CONTINUE, "continue"},
+		{token.RBRACE, "}"},
+		{token.FOR, "for"},
+		{token.LPAREN, "("},
+		{token.IDENT, "k"},
+		{token.COMMA, ","},
+		{token.IDENT, "v"},
+		{token.IN, "in"},
+		{token.IDENT, "h"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
+		{token.MATCH, "match"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "_"},
+		{token.FAT_ARROW, "=>"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%s %q, got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestOperators(t *testing.T) {
+	input := "% ** * <= >= < > << >> && & || | ^ ~ += -= *= /= => = + - ... .."
+
+	expected := []token.TokenType{
+		token.PERCENT, token.POWER, token.ASTERISK, token.LT_EQ, token.GT_EQ,
+		token.LT, token.GT, token.SHIFT_LEFT, token.SHIFT_RIGHT, token.AND,
+		token.AMPERSAND, token.OR, token.PIPE, token.CARET, token.TILDE,
+		token.PLUS_ASSIGN, token.MINUS_ASSIGN, token.ASTERISK_ASSIGN, token.SLASH_ASSIGN,
+		token.FAT_ARROW, token.ASSIGN, token.PLUS, token.MINUS, token.ELLIPSIS,
+		token.ILLEGAL, token.ILLEGAL, token.EOF,
+	}
+
+	l := New(input)
+
+	for i, tokenType := range expected {
+		tok := l.NextToken()
+
+		if tok.Type != tokenType {
+			t.Fatalf("tests[%d] - tokenType wrong. expected=%q, got=%q", i, tokenType, tok.Type)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading
+let x = 5; // trailing
+/* block /* nested */ still block */ x /**/
+// last`
+
+	tests := []struct {
+		expectedType     token.TokenType
+		expectedLiteral  string
+		expectedComments []string
+	}{
+		{token.LET, "let", []string{"// leading"}},
+		{token.IDENT, "x", nil},
+		{token.ASSIGN, "=", nil},
+		{token.INT, "5", nil},
+		{token.SEMICOLON, ";", nil},
+		{token.IDENT, "x", []string{"// trailing", "/* block /* nested */ still block */"}},
+		{token.EOF, "", []string{"/**/", "// last"}},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%s %q, got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+
+		if len(tok.Comments) != len(tt.expectedComments) {
+			t.Fatalf("tests[%d] - wrong number of comments. expected=%d, got=%d",
+				i, len(tt.expectedComments), len(tok.Comments))
+		}
+
+		for j, comment := range tok.Comments {
+			if comment.Text != tt.expectedComments[j] {
+				t.Errorf("tests[%d] - comment %d wrong. expected=%q, got=%q", i, j, tt.expectedComments[j], comment.Text)
+			}
+		}
+	}
+}
+
+func TestCommentPositions(t *testing.T) {
+	l := New("1 /* a\nb */ 2")
+
+	l.NextToken()
+	tok := l.NextToken()
+
+	if len(tok.Comments) != 1 {
+		t.Fatalf("wrong number of comments. got=%d", len(tok.Comments))
+	}
+
+	comment := tok.Comments[0]
+	if comment.Pos != (token.Position{Offset: 2, Line: 1, Column: 3}) {
+		t.Errorf("pos wrong. got=%+v", comment.Pos)
+	}
+	if comment.End != (token.Position{Offset: 11, Line: 2, Column: 5}) {
+		t.Errorf("end wrong. got=%+v", comment.End)
+	}
+	if tok.Pos != (token.Position{Offset: 12, Line: 2, Column: 6}) {
+		t.Errorf("token pos wrong. got=%+v", tok.Pos)
+	}
+}
+
+func TestUnterminatedComment(t *testing.T) {
+	l := New("x /* open /* nested */ still open")
+
+	l.NextToken()
+	tok := l.NextToken()
+
+	if tok.Type != token.EOF {
+		t.Fatalf("expected EOF after the comment, got=%s", tok.Type)
+	}
+
+	if len(tok.Comments) != 1 || tok.Comments[0].Text != "/* open /* nested */ still open" {
+		t.Errorf("wrong comments. got=%+v", tok.Comments)
+	}
+
+	diagnostics := l.Diagnostics()
+	if len(diagnostics) != 1 || diagnostics[0].Code != CodeUnterminatedComment {
+		t.Fatalf("wrong diagnostics. got=%+v", diagnostics)
+	}
+
+	if diagnostics[0].Pos.Column != 3 {
+		t.Errorf("error at column %d, wanted 3", diagnostics[0].Pos.Column)
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"plain"`, "plain"},
+		{`"a\nb\tc\rd"`, "a\nb\tc\rd"},
+		{`"say \"hi\""`, `say "hi"`},
+		{`"back\\slash"`, `back\slash`},
+		{`"\u{41}\u{e9}\u{1F600}"`, "Aé😀"},
+		{"`raw \\n \"quoted\"\nsecond line`", "raw \\n \"quoted\"\nsecond line"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != token.STRING || tok.Literal != tt.expected {
+			t.Errorf("wrong token for %s. expected=STRING %q, got=%s %q", tt.input, tt.expected, tok.Type, tok.Literal)
+		}
+
+		if len(l.Diagnostics()) != 0 {
+			t.Errorf("unexpected diagnostics for %s: %+v", tt.input, l.Diagnostics())
+		}
+
+		if tok := l.NextToken(); tok.Type != token.EOF {
+			t.Errorf("expected EOF after %s, got=%s", tt.input, tok.Type)
+		}
+	}
+}
+
+func TestInterpolation(t *testing.T) {
+	input := `"a ${f("}", {b: 1})} \${c} ${"${d}"}"`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.STRING_HEAD, "a "},
+		{token.IDENT, "f"},
+		{token.LPAREN, "("},
+		{token.STRING, "}"},
+		{token.COMMA, ","},
+		{token.LBRACE, "{"},
+		{token.IDENT, "b"},
+		{token.COLON, ":"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
+		{token.RPAREN, ")"},
+		{token.STRING_MIDDLE, " ${c} "},
+		{token.STRING_HEAD, ""},
+		{token.IDENT, "d"},
+		{token.STRING_TAIL, ""},
+		{token.STRING_TAIL, ""},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%s %q, got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+
+	if len(l.Diagnostics()) != 0 {
+		t.Errorf("unexpected diagnostics: %+v", l.Diagnostics())
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		literal  string
+		code     string
+		position string
+	}{
+		{`"a\qb"`, `a\qb`, CodeInvalidEscape, "1:3"},
+		{`"\u41"`, `\u41`, CodeInvalidEscape, "1:2"},
+		{`"\u{}"`, `\u{}`, CodeInvalidEscape, "1:2"},
+		{`"\u{D800}"`, `\u{D800}`, CodeInvalidEscape, "1:2"},
+		{"x\n  \"never closed", "never closed", CodeUnterminatedString, "2:3"},
+		{"`never\nclosed", "never\nclosed", CodeUnterminatedString, "1:1"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+
+		tok := l.NextToken()
+		if tok.Type != token.STRING {
+			tok = l.NextToken()
+		}
+
+		if tok.Type != token.STRING || tok.Literal != tt.literal {
+			t.Errorf("wrong token for %s. expected=STRING %q, got=%s %q", tt.input, tt.literal, tok.Type, tok.Literal)
+		}
+
+		diagnostics := l.Diagnostics()
+		if len(diagnostics) != 1 {
+			t.Errorf("wanted one diagnostic for %s, got %+v", tt.input, diagnostics)
+			continue
+		}
+
+		if diagnostics[0].Code != tt.code {
+			t.Errorf("%s: code was %s but wanted %s", tt.input, diagnostics[0].Code, tt.code)
+		}
+
+		if diagnostics[0].Pos.String() != tt.position {
+			t.Errorf("%s: error at %s but wanted %s", tt.input, diagnostics[0].Pos, tt.position)
+		}
+	}
+}
+
+func TestNextTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  \"hi\" == x\n"
+
+	tests := []struct {
+		expectedType token.TokenType
+		expectedPos  token.Position
+		expectedEnd  token.Position
+	}{
+		{token.LET, token.Position{Filename: "test.monkey", Offset: 0, Line: 1, Column: 1}, token.Position{Filename: "test.monkey", Offset: 3, Line: 1, Column: 4}},
+		{token.IDENT, token.Position{Filename: "test.monkey", Offset: 4, Line: 1, Column: 5}, token.Position{Filename: "test.monkey", Offset: 5, Line: 1, Column: 6}},
+		{token.ASSIGN, token.Position{Filename: "test.monkey", Offset: 6, Line: 1, Column: 7}, token.Position{Filename: "test.monkey", Offset: 7, Line: 1, Column: 8}},
+		{token.INT, token.Position{Filename: "test.monkey", Offset: 8, Line: 1, Column: 9}, token.Position{Filename: "test.monkey", Offset: 9, Line: 1, Column: 10}},
+		{token.SEMICOLON, token.Position{Filename: "test.monkey", Offset: 9, Line: 1, Column: 10}, token.Position{Filename: "test.monkey", Offset: 10, Line: 1, Column: 11}},
+		{token.STRING, token.Position{Filename: "test.monkey", Offset: 13, Line: 2, Column: 3}, token.Position{Filename: "test.monkey", Offset: 17, Line: 2, Column: 7}},
+		{token.EQ, token.Position{Filename: "test.monkey", Offset: 18, Line: 2, Column: 8}, token.Position{Filename: "test.monkey", Offset: 20, Line: 2, Column: 10}},
+		{token.IDENT, token.Position{Filename: "test.monkey", Offset: 21, Line: 2, Column: 11}, token.Position{Filename: "test.monkey", Offset: 22, Line: 2, Column: 12}},
+	}
+
+	l := NewFile("test.monkey", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokenType wrong.  expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Pos != tt.expectedPos {
+			t.Errorf("tests[%d] - pos wrong. expected=%+v, got=%+v", i, tt.expectedPos, tok.Pos)
+		}
+
+		if tok.End != tt.expectedEnd {
+			t.Errorf("tests[%d] - end wrong. expected=%+v, got=%+v", i, tt.expectedEnd, tok.End)
+		}
+	}
+}
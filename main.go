@@ -1,27 +1,112 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"monkey/budget"
+	"monkey/executor"
+	"monkey/object"
 	"monkey/repl"
 	"monkey/script"
 	"os"
 	"os/user"
+	"strings"
 )
 
 func main() {
+	engineName := flag.String("engine", "eval", "how to run code: eval (tree walker) or vm (bytecode)")
+	maxSteps := flag.Int64("max-steps", 0, "stop a run after this many evaluation steps, 0 for no limit")
+	maxDepth := flag.Int("max-depth", 0, "deepest function calls may nest, 0 for the default")
+	maxMemory := flag.Int64("max-memory", 0, "stop a run that allocates more than this many bytes, 0 for no limit")
+	summary := flag.Bool("summary", false, "after each script, print the steps, call depth and memory it used")
+	timeout := flag.Duration("timeout", 0, "stop a run that takes longer than this, 0 for no limit")
+	allow := flag.String("allow", "", "capabilities to grant besides the standard streams, comma separated: read, write, env, clock, random or all")
+	allowRead := flag.String("allow-read", "", "grant reading files under these directories, comma separated")
+	allowWrite := flag.String("allow-write", "", "grant writing files under these directories, comma separated")
+	strictInt := flag.Bool("strict-int", false, "make integer overflow an error instead of switching to big integers")
+	cache := flag.Bool("cache", false, "with -engine vm, keep compiled scripts in .mkc files next to them")
+	flag.Parse()
+
+	if flag.Arg(0) == "disasm" {
+		if err := script.Disassemble(os.Stdout, flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	capabilities, err := grantedCapabilities(*allow, *allowRead, *allowWrite)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	opts := executor.Options{
+		Budget:         budget.Budget{MaxSteps: *maxSteps, MaxDepth: *maxDepth, MaxMemory: *maxMemory, Timeout: *timeout},
+		Capabilities:   capabilities,
+		StrictIntegers: *strictInt,
+	}
+	engine := executor.NewEngine(*engineName, object.NewEnvironment(), opts)
+	if engine == nil {
+		fmt.Fprintf(os.Stderr, "unknown engine %q\n", *engineName)
+		os.Exit(2)
+	}
+
 	user, err := user.Current()
 
 	if err != nil {
 		panic(err)
 	}
 
-	if len(os.Args) > 2 {
+	if flag.NArg() > 0 {
 		fmt.Printf("Scripting mode.\n")
-		script.Run(os.Stdout, os.Args[1:])
+
+		run := func(files []string) {
+			if vm, ok := engine.(*executor.VM); ok && *cache {
+				script.RunCached(vm, os.Stdout, files)
+			} else {
+				script.RunEngine(engine, os.Stdout, files)
+			}
+		}
+
+		if !*summary {
+			run(flag.Args())
+			return
+		}
+
+		for _, file := range flag.Args() {
+			run([]string{file})
+
+			s := engine.Summary()
+			fmt.Fprintf(os.Stderr, "%s: %d steps, peak call depth %d, peak memory %d bytes\n",
+				file, s.Steps, s.PeakDepth, s.PeakMemory)
+		}
 	} else {
 		fmt.Printf("Hello %s! This is the monkey programming language!\n", user.Username)
 		fmt.Printf("Feel free to type in commands\n")
 
-		repl.Start(os.Stdin, os.Stdout)
+		repl.StartEngine(os.Stdin, os.Stdout, engine)
 	}
 }
+
+func grantedCapabilities(allow, allowRead, allowWrite string) (*object.Capabilities, error) {
+	capabilities := object.DefaultCapabilities()
+
+	granted, err := object.ParseCapabilities(allow)
+	if err != nil {
+		return nil, err
+	}
+	capabilities.Granted |= granted
+
+	if allowRead != "" {
+		capabilities.Granted |= object.CapFileRead
+		capabilities.ReadRoots = strings.Split(allowRead, ",")
+	}
+	if allowWrite != "" {
+		capabilities.Granted |= object.CapFileWrite
+		capabilities.WriteRoots = strings.Split(allowWrite, ",")
+	}
+
+	return capabilities, nil
+}
@@ -0,0 +1,70 @@
+package module
+
+import (
+	"errors"
+	"io/ioutil"
+	"monkey/compiler"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//ErrStale the cached module was compiled from different source
+var ErrStale = errors.New("compiled module is out of date")
+
+//CachePath where the compiled form of the script at path is kept,
+//next to it with the extension swapped for .mkc.  A script that's
+//already called .mkc gets another one, so it's never written over
+func CachePath(path string) string {
+	if filepath.Ext(path) == ".mkc" {
+		return path + ".mkc"
+	}
+
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".mkc"
+}
+
+//Load the module cached at path if it was compiled from source by
+//this version of the format.  Otherwise the error says why not: it
+//doesn't exist, is ErrStale, a *VersionError or damaged
+func Load(path string, source string) (*compiler.Bytecode, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m, err := Read(f)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.SourceHash != Hash(source) {
+		return nil, ErrStale
+	}
+
+	return m.Bytecode, nil
+}
+
+//Save cache bytecode compiled from source at path.  The file is
+//written aside and renamed into place, so readers never see half of it
+func Save(path string, source string, bytecode *compiler.Bytecode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	// TempFile makes the file private, a cache is as readable as its source
+	err = tmp.Chmod(0644)
+	if err == nil {
+		err = Write(tmp, &Module{SourceHash: Hash(source), Bytecode: bytecode})
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
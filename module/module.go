@@ -0,0 +1,504 @@
+package module
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/object"
+	"monkey/token"
+)
+
+//Version of the .mkc format.  Bump it whenever the layout or the
+//instruction set changes, older files are then recompiled
+const Version = 11
+
+var magic = []byte("MKC\x00")
+
+const (
+	tagInteger byte = iota + 1
+	tagString
+	tagFunction
+	tagFloat
+	tagBigInteger
+)
+
+//ErrNotModule the data doesn't start like a compiled module
+var ErrNotModule = errors.New("not a compiled monkey module")
+
+//ErrCorrupt the data is damaged or truncated
+var ErrCorrupt = errors.New("corrupt compiled module")
+
+//VersionError the module was written in another version of the format
+type VersionError struct {
+	Version int
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("compiled module has format version %d, want %d", e.Version, Version)
+}
+
+//Module a compiled program and the hash of the source it came from
+type Module struct {
+	SourceHash [sha256.Size]byte
+	Bytecode   *compiler.Bytecode
+}
+
+//Hash what Module.SourceHash is for source
+func Hash(source string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(source))
+}
+
+//Write encode m to w
+//
+//The layout is the magic "MKC\0", the version as a big endian uint16,
+//the source hash, a table of every string the module uses, the body,
+//and a CRC-32 of everything before it.  Numbers are varints and
+//strings are indexes into the table
+func Write(w io.Writer, m *Module) error {
+	e := &encoder{strings: map[string]int{}}
+	if err := e.bytecode(m.Bytecode); err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	out.Write(magic)
+	binary.Write(&out, binary.BigEndian, uint16(Version))
+	out.Write(m.SourceHash[:])
+
+	table := &encoder{}
+	table.uint(len(e.table))
+	for _, s := range e.table {
+		table.bytes([]byte(s))
+	}
+	out.Write(table.buf.Bytes())
+	out.Write(e.buf.Bytes())
+
+	binary.Write(&out, binary.BigEndian, crc32.ChecksumIEEE(out.Bytes()))
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+//Read decode a module written by Write.  Damaged data gives
+//ErrNotModule, ErrCorrupt or a *VersionError, never a broken module
+func Read(r io.Reader) (*Module, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	header := len(magic) + 2 + sha256.Size
+	if len(data) < len(magic) || !bytes.Equal(data[:len(magic)], magic) {
+		return nil, ErrNotModule
+	}
+	if len(data) < header+4 {
+		return nil, fmt.Errorf("%w: truncated header", ErrCorrupt)
+	}
+
+	version := int(binary.BigEndian.Uint16(data[len(magic):]))
+	if version != Version {
+		return nil, &VersionError{Version: version}
+	}
+
+	body, sum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCorrupt)
+	}
+
+	m := &Module{}
+	copy(m.SourceHash[:], data[len(magic)+2:])
+
+	d := &decoder{data: body[header:]}
+	n := d.count()
+	for i := 0; i < n && d.err == nil; i++ {
+		d.table = append(d.table, string(d.bytes()))
+	}
+
+	m.Bytecode = d.bytecode()
+	if d.err == nil && d.pos != len(d.data) {
+		d.fail("%d bytes of trailing data", len(d.data)-d.pos)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	if err := verify(m.Bytecode); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCorrupt, err)
+	}
+
+	return m, nil
+}
+
+type encoder struct {
+	buf     bytes.Buffer
+	strings map[string]int
+	table   []string
+}
+
+func (e *encoder) uint(v int) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf.Write(b[:binary.PutUvarint(b[:], uint64(v))])
+}
+
+func (e *encoder) int(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf.Write(b[:binary.PutVarint(b[:], v)])
+}
+
+func (e *encoder) float(v float64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], math.Float64bits(v))
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.buf.WriteByte(1)
+	} else {
+		e.buf.WriteByte(0)
+	}
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uint(len(b))
+	e.buf.Write(b)
+}
+
+func (e *encoder) string(s string) {
+	index, ok := e.strings[s]
+	if !ok {
+		index = len(e.table)
+		e.strings[s] = index
+		e.table = append(e.table, s)
+	}
+
+	e.uint(index)
+}
+
+func (e *encoder) strs(ss []string) {
+	e.uint(len(ss))
+	for _, s := range ss {
+		e.string(s)
+	}
+}
+
+func (e *encoder) bytecode(b *compiler.Bytecode) error {
+	e.bytes(b.Instructions)
+	e.sourceMap(b.SourceMap)
+	e.strs(b.GlobalNames)
+	e.strs(b.BuiltinNames)
+	e.strs(b.LocalNames)
+	e.bool(b.ProducesValue)
+
+	e.uint(len(b.Constants))
+	for _, constant := range b.Constants {
+		switch constant := constant.(type) {
+		case *object.Integer:
+			e.buf.WriteByte(tagInteger)
+			e.int(constant.Value)
+		case *object.Float:
+			e.buf.WriteByte(tagFloat)
+			e.float(constant.Value)
+		case *object.BigInteger:
+			e.buf.WriteByte(tagBigInteger)
+			e.string(constant.Value.String())
+		case *object.String:
+			e.buf.WriteByte(tagString)
+			e.string(constant.Value)
+		case *object.CompiledFunction:
+			e.buf.WriteByte(tagFunction)
+			e.string(constant.Name)
+			e.bytes(constant.Instructions)
+			e.uint(constant.NumLocals)
+			e.uint(constant.NumParameters)
+			e.sourceMap(constant.SourceMap)
+			e.strs(constant.LocalNames)
+		default:
+			return fmt.Errorf("can't write constant of type %s", constant.Type())
+		}
+	}
+
+	return nil
+}
+
+func (e *encoder) sourceMap(sm code.SourceMap) {
+	e.uint(len(sm))
+	for _, entry := range sm {
+		e.uint(entry.Offset)
+		e.string(entry.Pos.Filename)
+		e.uint(entry.Pos.Offset)
+		e.uint(entry.Pos.Line)
+		e.uint(entry.Pos.Column)
+	}
+}
+
+type decoder struct {
+	data  []byte
+	pos   int
+	table []string
+	err   error
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: %s", ErrCorrupt, fmt.Sprintf(format, a...))
+	}
+}
+
+func (d *decoder) uint() int {
+	if d.err != nil {
+		return 0
+	}
+
+	v, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 || v > math.MaxInt32 {
+		d.fail("bad number at byte %d", d.pos)
+		return 0
+	}
+	d.pos += n
+
+	return int(v)
+}
+
+//count a length that's about to be read, every element takes at least
+//a byte so anything longer than what's left is damage
+func (d *decoder) count() int {
+	n := d.uint()
+	if n > len(d.data)-d.pos {
+		d.fail("length %d runs past the end", n)
+		return 0
+	}
+
+	return n
+}
+
+func (d *decoder) int() int64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, n := binary.Varint(d.data[d.pos:])
+	if n <= 0 {
+		d.fail("bad number at byte %d", d.pos)
+		return 0
+	}
+	d.pos += n
+
+	return v
+}
+
+func (d *decoder) float() float64 {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.data)-d.pos < 8 {
+		d.fail("unexpected end of data")
+		return 0
+	}
+	d.pos += 8
+
+	return math.Float64frombits(binary.BigEndian.Uint64(d.data[d.pos-8:]))
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if d.pos >= len(d.data) {
+		d.fail("unexpected end of data")
+		return 0
+	}
+	d.pos++
+
+	return d.data[d.pos-1]
+}
+
+func (d *decoder) bool() bool {
+	return d.byte() != 0
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.count()
+	if d.err != nil {
+		return nil
+	}
+
+	b := make([]byte, n)
+	copy(b, d.data[d.pos:])
+	d.pos += n
+
+	return b
+}
+
+func (d *decoder) string() string {
+	index := d.uint()
+	if d.err != nil {
+		return ""
+	}
+	if index >= len(d.table) {
+		d.fail("string %d out of range", index)
+		return ""
+	}
+
+	return d.table[index]
+}
+
+func (d *decoder) strs() []string {
+	n := d.count()
+
+	ss := []string{}
+	for i := 0; i < n && d.err == nil; i++ {
+		ss = append(ss, d.string())
+	}
+
+	return ss
+}
+
+func (d *decoder) bytecode() *compiler.Bytecode {
+	b := &compiler.Bytecode{}
+	b.Instructions = d.bytes()
+	b.SourceMap = d.sourceMap()
+	b.GlobalNames = d.strs()
+	b.BuiltinNames = d.strs()
+	b.LocalNames = d.strs()
+	b.ProducesValue = d.bool()
+
+	n := d.count()
+	b.Constants = []object.Object{}
+	for i := 0; i < n && d.err == nil; i++ {
+		switch tag := d.byte(); tag {
+		case tagInteger:
+			b.Constants = append(b.Constants, &object.Integer{Value: d.int()})
+		case tagFloat:
+			b.Constants = append(b.Constants, &object.Float{Value: d.float()})
+		case tagString:
+			b.Constants = append(b.Constants, &object.String{Value: d.string()})
+		case tagBigInteger:
+			value, ok := new(big.Int).SetString(d.string(), 10)
+			if !ok {
+				d.fail("malformed big integer constant")
+			}
+			b.Constants = append(b.Constants, &object.BigInteger{Value: value})
+		case tagFunction:
+			b.Constants = append(b.Constants, &object.CompiledFunction{
+				Name:          d.string(),
+				Instructions:  d.bytes(),
+				NumLocals:     d.uint(),
+				NumParameters: d.uint(),
+				SourceMap:     d.sourceMap(),
+				LocalNames:    d.strs(),
+			})
+		default:
+			d.fail("unknown constant tag %d", tag)
+		}
+	}
+
+	return b
+}
+
+func (d *decoder) sourceMap() code.SourceMap {
+	n := d.count()
+
+	sm := code.SourceMap{}
+	for i := 0; i < n && d.err == nil; i++ {
+		sm = append(sm, code.SourceMapEntry{
+			Offset: d.uint(),
+			Pos: token.Position{
+				Filename: d.string(),
+				Offset:   d.uint(),
+				Line:     d.uint(),
+				Column:   d.uint(),
+			},
+		})
+	}
+
+	return sm
+}
+
+//verify checks the instructions decode and only refer to constants,
+//globals and locals that exist, so the VM can trust them
+func verify(b *compiler.Bytecode) error {
+	main := &object.CompiledFunction{NumLocals: len(b.LocalNames)}
+	if err := verifyInstructions("main program", b.Instructions, b, main); err != nil {
+		return err
+	}
+
+	for _, constant := range b.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			if fn.NumParameters > fn.NumLocals {
+				return fmt.Errorf("function %q has more parameters than locals", fn.Name)
+			}
+			if err := verifyInstructions(fmt.Sprintf("function %q", fn.Name), fn.Instructions, b, fn); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func verifyInstructions(where string, ins code.Instructions, b *compiler.Bytecode, fn *object.CompiledFunction) error {
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return fmt.Errorf("%s: %s at %04d", where, err, i)
+		}
+
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if i+1+width > len(ins) {
+			return fmt.Errorf("%s: truncated %s at %04d", where, def.Name, i)
+		}
+
+		operands, read := code.ReadOperands(def, ins[i+1:])
+
+		switch code.Opcode(ins[i]) {
+		case code.OpConstant:
+			if operands[0] >= len(b.Constants) {
+				return fmt.Errorf("%s: constant %d out of range at %04d", where, operands[0], i)
+			}
+		case code.OpClosure:
+			if operands[0] >= len(b.Constants) {
+				return fmt.Errorf("%s: constant %d out of range at %04d", where, operands[0], i)
+			}
+			if _, ok := b.Constants[operands[0]].(*object.CompiledFunction); !ok {
+				return fmt.Errorf("%s: closure over a non-function at %04d", where, i)
+			}
+		case code.OpGetGlobal, code.OpSetGlobal:
+			if operands[0] >= len(b.GlobalNames) {
+				return fmt.Errorf("%s: global %d out of range at %04d", where, operands[0], i)
+			}
+		case code.OpGetLocal, code.OpSetLocal, code.OpAssignLocal, code.OpCaptureLocal:
+			if operands[0] >= fn.NumLocals {
+				return fmt.Errorf("%s: local %d out of range at %04d", where, operands[0], i)
+			}
+		case code.OpFreshLocals:
+			if operands[0]+operands[1] > fn.NumLocals {
+				return fmt.Errorf("%s: locals %d to %d out of range at %04d", where, operands[0], operands[0]+operands[1], i)
+			}
+		case code.OpGetBuiltin:
+			if operands[0] >= len(b.BuiltinNames) {
+				return fmt.Errorf("%s: builtin %d out of range at %04d", where, operands[0], i)
+			}
+		case code.OpJump, code.OpJumpNotTruthy, code.OpWhileTest, code.OpIterNext:
+			if operands[0] > len(ins) {
+				return fmt.Errorf("%s: jump to %04d out of range at %04d", where, operands[0], i)
+			}
+		}
+
+		i += 1 + read
+	}
+
+	return nil
+}
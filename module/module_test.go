@@ -0,0 +1,154 @@
+package module
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"monkey/compiler"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/vm"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const input = `let greet = fn(name) { "hello " + name };
+let adder = fn(x) { fn(y) { x + y } };
+let nums = [1, 2, adder(40)(2), 2.5e-1, 99999999999999999999];
+puts(len(nums));
+greet("monkey")`
+
+func compile(t *testing.T, source string) *compiler.Bytecode {
+	p := parser.New(lexer.NewFile("test.monkey", source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	return comp.Bytecode()
+}
+
+func encode(t *testing.T, bytecode *compiler.Bytecode) []byte {
+	var buf bytes.Buffer
+	if err := Write(&buf, &Module{SourceHash: Hash(input), Bytecode: bytecode}); err != nil {
+		t.Fatalf("write failed: %s", err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	bytecode := compile(t, input)
+
+	m, err := Read(bytes.NewReader(encode(t, bytecode)))
+	if err != nil {
+		t.Fatalf("read failed: %s", err)
+	}
+
+	if m.SourceHash != Hash(input) {
+		t.Errorf("source hash wasn't kept")
+	}
+
+	if !reflect.DeepEqual(m.Bytecode, bytecode) {
+		t.Errorf("bytecode changed.\nwant=%#v\ngot=%#v", bytecode, m.Bytecode)
+	}
+
+	machine := vm.New(m.Bytecode)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+}
+
+func TestRejectsDamage(t *testing.T) {
+	data := encode(t, compile(t, input))
+
+	truncated := data[:len(data)/2]
+
+	flipped := append([]byte{}, data...)
+	flipped[len(flipped)/2] ^= 0xff
+
+	otherVersion := append([]byte{}, data...)
+	otherVersion[len(magic)+1]++
+
+	tests := []struct {
+		data     []byte
+		expected error
+	}{
+		{[]byte("let x = 5;"), ErrNotModule},
+		{[]byte{}, ErrNotModule},
+		{truncated, ErrCorrupt},
+		{flipped, ErrCorrupt},
+	}
+
+	for _, tt := range tests {
+		_, err := Read(bytes.NewReader(tt.data))
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("wrong error. want=%v, got=%v", tt.expected, err)
+		}
+	}
+
+	_, err := Read(bytes.NewReader(otherVersion))
+	if versionErr, ok := err.(*VersionError); !ok || versionErr.Version != Version+1 {
+		t.Errorf("wrong error for another version. got=%v", err)
+	}
+}
+
+func TestVerifyCatchesBadReferences(t *testing.T) {
+	bytecode := compile(t, `let a = 1; a`)
+	bytecode.Constants = nil
+
+	if err := verify(bytecode); err == nil {
+		t.Errorf("expected an error for a missing constant")
+	}
+}
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mkc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := CachePath(filepath.Join(dir, "script.monkey"))
+	if filepath.Base(path) != "script.mkc" {
+		t.Errorf("wrong cache path %q", path)
+	}
+
+	if same := filepath.Join(dir, "script.mkc"); CachePath(same) == same {
+		t.Errorf("the cache path of %q is the script itself", same)
+	}
+
+	if _, err := Load(path, input); !os.IsNotExist(err) {
+		t.Errorf("expected a missing file. got=%v", err)
+	}
+
+	if err := Save(path, input, compile(t, input)); err != nil {
+		t.Fatalf("save failed: %s", err)
+	}
+
+	if _, err := Load(path, input); err != nil {
+		t.Errorf("load failed: %s", err)
+	}
+
+	if info, err := os.Stat(path); err != nil {
+		t.Errorf("stat failed: %s", err)
+	} else if info.Mode().Perm() != 0644 {
+		t.Errorf("cache should be written with mode 0644. got=%v", info.Mode().Perm())
+	}
+
+	if _, err := Load(path, input+";"); err != ErrStale {
+		t.Errorf("expected ErrStale after the source changed. got=%v", err)
+	}
+
+	entries, _ := ioutil.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %d entries", len(entries))
+	}
+}
@@ -17,12 +17,22 @@ func (ao *Array) Type() ObjectType {
 
 //Inspect inspect
 func (ao *Array) Inspect() string {
+	return ao.inspect(map[Object]bool{})
+}
+
+func (ao *Array) inspect(printing map[Object]bool) string {
+	if printing[ao] {
+		return "[...]"
+	}
+	printing[ao] = true
+	defer delete(printing, ao)
+
 	var out bytes.Buffer
 
 	elements := []string{}
 
 	for _, e := range ao.Elements {
-		elements = append(elements, e.Inspect())
+		elements = append(elements, inspectWithin(e, printing))
 	}
 
 	out.WriteString("[")
@@ -0,0 +1,318 @@
+package object
+
+import (
+	"math"
+	"math/big"
+)
+
+//BigInteger an integer too large for an Integer.  Arithmetic makes one
+//when an int64 would overflow and goes back to an Integer as soon as
+//the value fits again, so scripts only ever see INTEGER
+type BigInteger struct {
+	Value *big.Int
+}
+
+//Inspect Inspection
+func (b *BigInteger) Inspect() string {
+	return b.Value.String()
+}
+
+//Type type
+func (b *BigInteger) Type() ObjectType {
+	return IntegerObj
+}
+
+var (
+	minInt64 = big.NewInt(math.MinInt64)
+	maxInt64 = big.NewInt(math.MaxInt64)
+)
+
+//maxIntegerBits how large shifts and powers may make an integer, a
+//little over 300,000 digits
+const maxIntegerBits = 1 << 20
+
+//NewInteger v as an *Integer when it fits in an int64, otherwise as a
+//*BigInteger
+func NewInteger(v *big.Int) Object {
+	if v.Cmp(minInt64) >= 0 && v.Cmp(maxInt64) <= 0 {
+		return &Integer{Value: v.Int64()}
+	}
+
+	return &BigInteger{Value: v}
+}
+
+//BigIntegerLiteral the value of an integer literal too large for an
+//int64, or an OverflowError when strict
+func BigIntegerLiteral(value *big.Int, strict bool) Object {
+	if strict {
+		err := NewError("integer overflow: literal %s doesn't fit in 64 bits", value)
+		err.Kind = OverflowError
+		return err
+	}
+
+	return &BigInteger{Value: value}
+}
+
+//BigValue the value of an integer of either size as a *big.Int
+func BigValue(o Object) (*big.Int, bool) {
+	switch o := o.(type) {
+	case *Integer:
+		return big.NewInt(o.Value), true
+	case *BigInteger:
+		return o.Value, true
+	default:
+		return nil, false
+	}
+}
+
+//IntegerOperation apply an arithmetic or comparison operator to two
+//integers.  A result that overflows an int64 becomes a BigInteger,
+//unless strict is set, then it's an OverflowError
+func IntegerOperation(operator string, left, right Object, strict bool) Object {
+	if (operator == "/" || operator == "%") && isZero(right) {
+		return divisionByZero(left, operator, right)
+	}
+
+	if operator == "**" && isNegative(right) {
+		if isZero(left) {
+			return divisionByZero(left, operator, right)
+		}
+		return FloatOperation(operator, left, right)
+	}
+
+	if (operator == "<<" || operator == ">>") && isNegative(right) {
+		return NewError("negative shift count: %s %s %s", left.Inspect(), operator, right.Inspect())
+	}
+
+	leftInt, leftSmall := left.(*Integer)
+	rightInt, rightSmall := right.(*Integer)
+
+	if leftSmall && rightSmall {
+		result, ok := smallIntegerOperation(operator, leftInt.Value, rightInt.Value)
+		if ok {
+			return result
+		}
+
+		if strict {
+			err := NewError("integer overflow: %d %s %d", leftInt.Value, operator, rightInt.Value)
+			err.Kind = OverflowError
+			return err
+		}
+	}
+
+	leftBig, _ := BigValue(left)
+	rightBig, _ := BigValue(right)
+
+	switch operator {
+	case "+":
+		return NewInteger(new(big.Int).Add(leftBig, rightBig))
+	case "-":
+		return NewInteger(new(big.Int).Sub(leftBig, rightBig))
+	case "*":
+		return NewInteger(new(big.Int).Mul(leftBig, rightBig))
+	case "/":
+		return NewInteger(new(big.Int).Quo(leftBig, rightBig))
+	case "%":
+		return NewInteger(new(big.Int).Rem(leftBig, rightBig))
+	case "**":
+		if leftBig.CmpAbs(big.NewInt(1)) > 0 && (!rightBig.IsInt64() || rightBig.Int64() > maxIntegerBits/int64(leftBig.BitLen()-1)) {
+			return tooLarge(left, operator, right)
+		}
+		return NewInteger(new(big.Int).Exp(leftBig, rightBig, nil))
+	case "&":
+		return NewInteger(new(big.Int).And(leftBig, rightBig))
+	case "|":
+		return NewInteger(new(big.Int).Or(leftBig, rightBig))
+	case "^":
+		return NewInteger(new(big.Int).Xor(leftBig, rightBig))
+	case "<<":
+		if !rightBig.IsInt64() || int64(leftBig.BitLen())+rightBig.Int64() > maxIntegerBits {
+			return tooLarge(left, operator, right)
+		}
+		return NewInteger(new(big.Int).Lsh(leftBig, uint(rightBig.Int64())))
+	case ">>":
+		if !rightBig.IsInt64() || rightBig.Int64() > maxIntegerBits {
+			// Everything is shifted out, leaving the sign
+			if leftBig.Sign() < 0 {
+				return &Integer{Value: -1}
+			}
+			return &Integer{Value: 0}
+		}
+		return NewInteger(new(big.Int).Rsh(leftBig, uint(rightBig.Int64())))
+	case "<":
+		return nativeBool(leftBig.Cmp(rightBig) < 0)
+	case ">":
+		return nativeBool(leftBig.Cmp(rightBig) > 0)
+	case "<=":
+		return nativeBool(leftBig.Cmp(rightBig) <= 0)
+	case ">=":
+		return nativeBool(leftBig.Cmp(rightBig) >= 0)
+	case "==":
+		return nativeBool(leftBig.Cmp(rightBig) == 0)
+	case "!=":
+		return nativeBool(leftBig.Cmp(rightBig) != 0)
+	default:
+		return NewError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+//Negate -o for an integer of either size
+func Negate(o Object, strict bool) Object {
+	if integer, ok := o.(*Integer); ok {
+		if integer.Value != math.MinInt64 {
+			return &Integer{Value: -integer.Value}
+		}
+
+		if strict {
+			err := NewError("integer overflow: -%d", integer.Value)
+			err.Kind = OverflowError
+			return err
+		}
+	}
+
+	value, _ := BigValue(o)
+	return NewInteger(new(big.Int).Neg(value))
+}
+
+//smallIntegerOperation the result when it can be worked out in int64s,
+//false when it overflows
+func smallIntegerOperation(operator string, left, right int64) (Object, bool) {
+	switch operator {
+	case "+":
+		result := left + right
+		if (left > 0 && right > 0 && result < 0) || (left < 0 && right < 0 && result >= 0) {
+			return nil, false
+		}
+		return &Integer{Value: result}, true
+	case "-":
+		result := left - right
+		if (right < 0 && result < left) || (right > 0 && result > left) {
+			return nil, false
+		}
+		return &Integer{Value: result}, true
+	case "*":
+		if left == 0 || right == 0 {
+			return &Integer{Value: 0}, true
+		}
+		result := left * right
+		if result/right != left || (left == -1 && right == math.MinInt64) || (right == -1 && left == math.MinInt64) {
+			return nil, false
+		}
+		return &Integer{Value: result}, true
+	case "/":
+		if left == math.MinInt64 && right == -1 {
+			return nil, false
+		}
+		return &Integer{Value: left / right}, true
+	case "%":
+		return &Integer{Value: left % right}, true
+	case "**":
+		return smallPower(left, right)
+	case "&":
+		return &Integer{Value: left & right}, true
+	case "|":
+		return &Integer{Value: left | right}, true
+	case "^":
+		return &Integer{Value: left ^ right}, true
+	case "<<":
+		if right >= 63 && left != 0 {
+			return nil, false
+		}
+		result := left << uint(right)
+		if result>>uint(right) != left {
+			return nil, false
+		}
+		return &Integer{Value: result}, true
+	case ">>":
+		if right >= 63 {
+			right = 63
+		}
+		return &Integer{Value: left >> uint(right)}, true
+	case "<":
+		return nativeBool(left < right), true
+	case ">":
+		return nativeBool(left > right), true
+	case "<=":
+		return nativeBool(left <= right), true
+	case ">=":
+		return nativeBool(left >= right), true
+	case "==":
+		return nativeBool(left == right), true
+	case "!=":
+		return nativeBool(left != right), true
+	default:
+		return NewError("unknown operator: %s %s %s", IntegerObj, operator, IntegerObj), true
+	}
+}
+
+//smallPower base ** exponent by squaring, false once it overflows
+func smallPower(base, exponent int64) (Object, bool) {
+	result := int64(1)
+
+	for exponent > 0 {
+		if exponent&1 == 1 {
+			product, ok := smallIntegerOperation("*", result, base)
+			if !ok {
+				return nil, false
+			}
+			result = product.(*Integer).Value
+		}
+
+		exponent >>= 1
+		if exponent > 0 {
+			square, ok := smallIntegerOperation("*", base, base)
+			if !ok {
+				return nil, false
+			}
+			base = square.(*Integer).Value
+		}
+	}
+
+	return &Integer{Value: result}, true
+}
+
+//BitNot ~o for an integer of either size
+func BitNot(o Object) Object {
+	if integer, ok := o.(*Integer); ok {
+		return &Integer{Value: ^integer.Value}
+	}
+
+	value, _ := BigValue(o)
+	return NewInteger(new(big.Int).Not(value))
+}
+
+func isNegative(o Object) bool {
+	value, ok := BigValue(o)
+	return ok && value.Sign() < 0
+}
+
+//tooLarge the error for a shift or power whose result would be
+//unreasonably large
+func tooLarge(left Object, operator string, right Object) *Error {
+	return NewError("integer too large: %s %s %s", left.Inspect(), operator, right.Inspect())
+}
+
+func isZero(o Object) bool {
+	switch o := o.(type) {
+	case *Integer:
+		return o.Value == 0
+	case *Float:
+		return o.Value == 0
+	default:
+		return false
+	}
+}
+
+//divisionByZero the error for dividing left by right, which is zero,
+//with / or %
+func divisionByZero(left Object, operator string, right Object) *Error {
+	return NewError("division by zero: %s %s %s", left.Inspect(), operator, right.Inspect())
+}
+
+func nativeBool(value bool) *Boolean {
+	if value {
+		return TRUE
+	}
+
+	return FALSE
+}
@@ -4,6 +4,13 @@ import (
 	"fmt"
 )
 
+var (
+	//TRUE true
+	TRUE = &Boolean{Value: true}
+	//FALSE false
+	FALSE = &Boolean{Value: false}
+)
+
 //Boolean boolean
 type Boolean struct {
 	Value bool
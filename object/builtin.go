@@ -1,11 +1,13 @@
 package object
 
-//BuiltInFunction built in
-type BuiltInFunction func(args ...Object) Object
+//BuiltInFunction built in, ctx is what it may reach outside the script
+type BuiltInFunction func(ctx *ExecutionContext, args ...Object) Object
 
-//BuiltIn built in
+//BuiltIn built in.  Needs are the capabilities it can't be called
+//without
 type BuiltIn struct {
-	Fn BuiltInFunction
+	Fn    BuiltInFunction
+	Needs Capability
 }
 
 //Type type
@@ -0,0 +1,448 @@
+package object
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//BuiltinDefinition a builtin and the name programs call it by
+type BuiltinDefinition struct {
+	Name    string
+	Builtin *BuiltIn
+}
+
+//BuiltinTable the builtins a run can call.  The order matters, compiled
+//code refers to builtins by their index in the table
+type BuiltinTable []BuiltinDefinition
+
+//Lookup the builtin called name, nil when there isn't one
+func (t BuiltinTable) Lookup(name string) *BuiltIn {
+	if i := t.Index(name); i >= 0 {
+		return t[i].Builtin
+	}
+
+	return nil
+}
+
+//Index where the builtin called name is in the table, -1 if it isn't
+func (t BuiltinTable) Index(name string) int {
+	for i, def := range t {
+		if def.Name == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+//With a copy of the table with name bound to builtin, replacing any
+//builtin of that name or else added at the end
+func (t BuiltinTable) With(name string, builtin *BuiltIn) BuiltinTable {
+	table := make(BuiltinTable, len(t), len(t)+1)
+	copy(table, t)
+
+	if i := table.Index(name); i >= 0 {
+		table[i].Builtin = builtin
+		return table
+	}
+
+	return append(table, BuiltinDefinition{Name: name, Builtin: builtin})
+}
+
+//Builtins the functions every program can call unless it's given a
+//table of its own
+var Builtins = BuiltinTable{
+	{
+		"len",
+		&BuiltIn{
+			Fn: func(ctx *ExecutionContext, args ...Object) Object {
+				if len(args) != 1 {
+					return NewError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Array:
+					return &Integer{Value: int64(len(arg.Elements))}
+				case *String:
+					return &Integer{Value: int64(len(arg.Value))}
+				default:
+					return NewError("argument to `len` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"first",
+		&BuiltIn{
+			Fn: func(ctx *ExecutionContext, args ...Object) Object {
+				if len(args) != 1 {
+					return NewError("wrong number of arguments. wanted 1 got %d", len(args))
+				}
+
+				if args[0].Type() != ArrayObj {
+					return NewError("arguments to `first` must be ARRAY")
+				}
+
+				arr := args[0].(*Array)
+				if len(arr.Elements) > 0 {
+					return arr.Elements[0]
+				}
+
+				return NULL
+			},
+		},
+	},
+	{
+		"last",
+		&BuiltIn{
+			Fn: func(ctx *ExecutionContext, args ...Object) Object {
+				if len(args) != 1 {
+					return NewError("wrong number of arguments. wanted 1 got %d", len(args))
+				}
+
+				if args[0].Type() != ArrayObj {
+					return NewError("arguments to `last` must be ARRAY")
+				}
+
+				arr := args[0].(*Array)
+				length := len(arr.Elements)
+				if length > 0 {
+					return arr.Elements[length-1]
+				}
+
+				return NULL
+			},
+		},
+	},
+	{
+		"rest",
+		&BuiltIn{
+			Fn: func(ctx *ExecutionContext, args ...Object) Object {
+				if len(args) != 1 {
+					return NewError("wrong number of arguments. wanted 1 got %d", len(args))
+				}
+
+				if args[0].Type() != ArrayObj {
+					return NewError("arguments to `rest` must be ARRAY")
+				}
+
+				arr := args[0].(*Array)
+				length := len(arr.Elements)
+				if length > 0 {
+					newElements := make([]Object, length-1, length-1)
+					copy(newElements, arr.Elements[1:length])
+
+					return &Array{Elements: newElements}
+				}
+
+				return NULL
+			},
+		},
+	},
+	{
+		"push",
+		&BuiltIn{
+			Fn: func(ctx *ExecutionContext, args ...Object) Object {
+				if len(args) != 2 {
+					return NewError("wrong number of arguments. wanted 2 got %d", len(args))
+				}
+
+				if args[0].Type() != ArrayObj {
+					return NewError("first argument to `push` must be ARRAY")
+				}
+
+				arr := args[0].(*Array)
+				length := len(arr.Elements)
+
+				newElements := make([]Object, length+1, length+1)
+				copy(newElements, arr.Elements)
+				newElements[length] = args[1]
+
+				return &Array{Elements: newElements}
+			},
+		},
+	},
+	{
+		"puts",
+		&BuiltIn{
+			Fn: func(ctx *ExecutionContext, args ...Object) Object {
+				return printLines(ctx.Stdout, args)
+			},
+			Needs: CapStdout,
+		},
+	},
+	{
+		"readfile",
+		&BuiltIn{
+			Fn: func(ctx *ExecutionContext, args ...Object) Object {
+				if len(args) != 1 {
+					return NewError("wrong number of arguments. wanted 1 got %d", len(args))
+				}
+
+				path, ok := args[0].(*String)
+				if !ok {
+					return NewError("argument to `readfile` must be STRING, got %s", args[0].Type())
+				}
+
+				if err := ctx.Capabilities.CheckPath(CapFileRead, path.Value); err != nil {
+					return err
+				}
+
+				content, err := ioutil.ReadFile(path.Value)
+				if err != nil {
+					return NewError("%s", err)
+				}
+
+				return &String{Value: string(content)}
+			},
+			Needs: CapFileRead,
+		},
+	},
+	{
+		"writefile",
+		&BuiltIn{
+			Fn: func(ctx *ExecutionContext, args ...Object) Object {
+				if len(args) != 2 {
+					return NewError("wrong number of arguments. wanted 2 got %d", len(args))
+				}
+
+				path, ok := args[0].(*String)
+				if !ok {
+					return NewError("first argument to `writefile` must be STRING, got %s", args[0].Type())
+				}
+
+				content, ok := args[1].(*String)
+				if !ok {
+					return NewError("second argument to `writefile` must be STRING, got %s", args[1].Type())
+				}
+
+				if err := ctx.Capabilities.CheckPath(CapFileWrite, path.Value); err != nil {
+					return err
+				}
+
+				if err := ioutil.WriteFile(path.Value, []byte(content.Value), 0644); err != nil {
+					return NewError("%s", err)
+				}
+
+				return NULL
+			},
+			Needs: CapFileWrite,
+		},
+	},
+	{
+		"getenv",
+		&BuiltIn{
+			Fn: func(ctx *ExecutionContext, args ...Object) Object {
+				if len(args) != 1 {
+					return NewError("wrong number of arguments. wanted 1 got %d", len(args))
+				}
+
+				name, ok := args[0].(*String)
+				if !ok {
+					return NewError("argument to `getenv` must be STRING, got %s", args[0].Type())
+				}
+
+				value, ok := os.LookupEnv(name.Value)
+				if !ok {
+					return NULL
+				}
+
+				return &String{Value: value}
+			},
+			Needs: CapEnv,
+		},
+	},
+	{
+		"now",
+		&BuiltIn{
+			Fn: func(ctx *ExecutionContext, args ...Object) Object {
+				if len(args) != 0 {
+					return NewError("wrong number of arguments. wanted 0 got %d", len(args))
+				}
+
+				return &Integer{Value: time.Now().UnixNano() / int64(time.Millisecond)}
+			},
+			Needs: CapClock,
+		},
+	},
+	{
+		"random",
+		&BuiltIn{
+			Fn: func(ctx *ExecutionContext, args ...Object) Object {
+				if len(args) != 1 {
+					return NewError("wrong number of arguments. wanted 1 got %d", len(args))
+				}
+
+				if big, ok := args[0].(*BigInteger); ok && big.Value.Sign() > 0 {
+					return NewError("argument to `random` is too large, got %s", big.Inspect())
+				}
+				n, ok := args[0].(*Integer)
+				if !ok || n.Value <= 0 {
+					return NewError("argument to `random` must be a positive INTEGER")
+				}
+
+				return &Integer{Value: rand.Int63n(n.Value)}
+			},
+			Needs: CapRandom,
+		},
+	},
+	{
+		"eputs",
+		&BuiltIn{
+			Fn: func(ctx *ExecutionContext, args ...Object) Object {
+				return printLines(ctx.Stderr, args)
+			},
+			Needs: CapStderr,
+		},
+	},
+	{"gets", gets},
+	{"readline", gets},
+	{
+		"int",
+		&BuiltIn{
+			Fn: func(ctx *ExecutionContext, args ...Object) Object {
+				if len(args) != 1 {
+					return NewError("wrong number of arguments. wanted 1 got %d", len(args))
+				}
+
+				var value Object
+				switch arg := args[0].(type) {
+				case *Integer, *BigInteger:
+					return arg
+				case *Float:
+					if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+						return NewError("%s doesn't fit in an integer", arg.Inspect())
+					}
+					whole, _ := big.NewFloat(arg.Value).Int(nil)
+					value = NewInteger(whole)
+				case *String:
+					whole, ok := new(big.Int).SetString(strings.TrimSpace(arg.Value), 0)
+					if !ok {
+						return NewError("can't convert %q to an integer", arg.Value)
+					}
+					value = NewInteger(whole)
+				default:
+					return NewError("argument to `int` not supported, got %s", arg.Type())
+				}
+
+				if _, isBig := value.(*BigInteger); isBig && ctx.StrictIntegers {
+					err := NewError("%s doesn't fit in an integer", args[0].Inspect())
+					err.Kind = OverflowError
+					return err
+				}
+
+				return value
+			},
+		},
+	},
+	{
+		"float",
+		&BuiltIn{
+			Fn: func(ctx *ExecutionContext, args ...Object) Object {
+				if len(args) != 1 {
+					return NewError("wrong number of arguments. wanted 1 got %d", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Integer, *BigInteger:
+					value, _ := FloatValue(arg)
+					return &Float{Value: value}
+				case *Float:
+					return arg
+				case *String:
+					value, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+					if err != nil {
+						return NewError("can't convert %q to a float", arg.Value)
+					}
+					return &Float{Value: value}
+				default:
+					return NewError("argument to `float` not supported, got %s", arg.Type())
+				}
+			},
+		},
+	},
+	{"range", rangeOf},
+}
+
+//rangeOf range(end), range(start, end) or range(start, end, step), the
+//integers from start, or 0, up to end counting by step, or 1
+var rangeOf = &BuiltIn{
+	Fn: func(ctx *ExecutionContext, args ...Object) Object {
+		if len(args) < 1 || len(args) > 3 {
+			return NewError("wrong number of arguments. wanted 1 to 3 got %d", len(args))
+		}
+
+		bounds := make([]int64, len(args))
+		for i, arg := range args {
+			if big, ok := arg.(*BigInteger); ok {
+				return NewError("argument to `range` is too large, got %s", big.Inspect())
+			}
+			integer, ok := arg.(*Integer)
+			if !ok {
+				return NewError("argument to `range` must be INTEGER, got %s", arg.Type())
+			}
+			bounds[i] = integer.Value
+		}
+
+		r := &Range{Step: 1}
+		switch len(bounds) {
+		case 1:
+			r.End = bounds[0]
+		case 2:
+			r.Start, r.End = bounds[0], bounds[1]
+		case 3:
+			r.Start, r.End, r.Step = bounds[0], bounds[1], bounds[2]
+		}
+
+		if r.Step == 0 {
+			return NewError("range step can't be 0")
+		}
+
+		return r
+	},
+}
+
+//gets the next line of input, NULL at the end of it
+var gets = &BuiltIn{
+	Fn: func(ctx *ExecutionContext, args ...Object) Object {
+		if len(args) != 0 {
+			return NewError("wrong number of arguments. wanted 0 got %d", len(args))
+		}
+
+		line, err := ctx.ReadLine()
+		if err == io.EOF {
+			return NULL
+		}
+		if err != nil {
+			return NewError("%s", err)
+		}
+
+		return &String{Value: line}
+	},
+	Needs: CapStdin,
+}
+
+//printLines write each of args to out on a line of its own
+func printLines(out io.Writer, args []Object) Object {
+	for _, arg := range args {
+		if _, err := fmt.Fprintln(out, arg.Inspect()); err != nil {
+			return NewError("%s", err)
+		}
+	}
+
+	return NULL
+}
+
+//GetBuiltinByName the default builtin called name, nil when there
+//isn't one
+func GetBuiltinByName(name string) *BuiltIn {
+	return Builtins.Lookup(name)
+}
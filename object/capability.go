@@ -0,0 +1,160 @@
+package object
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//Capability something outside the script a builtin may touch
+type Capability uint
+
+const (
+	//CapStdout print to standard output
+	CapStdout Capability = 1 << iota
+	//CapFileRead read files under the allowed roots
+	CapFileRead
+	//CapFileWrite write files under the allowed roots
+	CapFileWrite
+	//CapEnv read environment variables
+	CapEnv
+	//CapClock read the time
+	CapClock
+	//CapRandom draw random numbers
+	CapRandom
+	//CapStderr print to standard error
+	CapStderr
+	//CapStdin read standard input
+	CapStdin
+)
+
+var capabilityNames = []struct {
+	Capability Capability
+	Name       string
+}{
+	{CapStdout, "stdout"},
+	{CapFileRead, "read"},
+	{CapFileWrite, "write"},
+	{CapEnv, "env"},
+	{CapClock, "clock"},
+	{CapRandom, "random"},
+	{CapStderr, "stderr"},
+	{CapStdin, "stdin"},
+}
+
+//String the names of the capabilities in c, comma separated
+func (c Capability) String() string {
+	names := []string{}
+	for _, cn := range capabilityNames {
+		if c&cn.Capability != 0 {
+			names = append(names, cn.Name)
+		}
+	}
+
+	return strings.Join(names, ",")
+}
+
+//ParseCapabilities capabilities from a comma separated list of names:
+//stdout, stderr, stdin, read, write, env, clock, random or all
+func ParseCapabilities(list string) (Capability, error) {
+	var c Capability
+
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		found := false
+		for _, cn := range capabilityNames {
+			if cn.Name == name || name == "all" {
+				c |= cn.Capability
+				found = true
+			}
+		}
+
+		if !found {
+			return 0, fmt.Errorf("unknown capability %q", name)
+		}
+	}
+
+	return c, nil
+}
+
+//Capabilities what a run is allowed to touch.  Files may only be read
+//under ReadRoots and written under WriteRoots, no roots means anywhere
+type Capabilities struct {
+	Granted    Capability
+	ReadRoots  []string
+	WriteRoots []string
+}
+
+//DefaultCapabilities what a run may do unless told otherwise: use the
+//standard streams
+func DefaultCapabilities() *Capabilities {
+	return &Capabilities{Granted: CapStdout | CapStderr | CapStdin}
+}
+
+//Check a permission error unless everything in need was granted
+func (c *Capabilities) Check(need Capability) *Error {
+	if missing := need &^ c.Granted; missing != 0 {
+		err := NewError("permission denied: %s capability not granted", missing)
+		err.Kind = PermissionError
+		return err
+	}
+
+	return nil
+}
+
+//CheckPath a permission error unless need was granted and path is
+//under one of the roots for it
+func (c *Capabilities) CheckPath(need Capability, path string) *Error {
+	if err := c.Check(need); err != nil {
+		return err
+	}
+
+	roots := c.ReadRoots
+	if need == CapFileWrite {
+		roots = c.WriteRoots
+	}
+	if len(roots) == 0 {
+		return nil
+	}
+
+	resolved := resolvePath(path)
+	for _, root := range roots {
+		rel, err := filepath.Rel(resolvePath(root), resolved)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+	}
+
+	err := NewError("permission denied: %s is outside the allowed directories", path)
+	err.Kind = PermissionError
+	return err
+}
+
+//resolvePath absolute path with symlinks followed as far as the path
+//exists, so links can't lead out of a root
+func resolvePath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+
+	rest := ""
+	for dir := abs; ; dir = filepath.Dir(dir) {
+		if _, err := os.Lstat(dir); err == nil {
+			if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+				return filepath.Join(resolved, rest)
+			}
+			return abs
+		}
+
+		if dir == filepath.Dir(dir) {
+			return abs
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+	}
+}
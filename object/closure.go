@@ -0,0 +1,70 @@
+package object
+
+import (
+	"monkey/code"
+	"strings"
+)
+
+//CompiledFunction a function lowered to bytecode.  SourceMap and
+//LocalNames are debug information for errors and disassembly
+type CompiledFunction struct {
+	Name          string
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+	SourceMap     code.SourceMap
+	LocalNames    []string
+}
+
+//Type type
+func (cf *CompiledFunction) Type() ObjectType {
+	return CompiledFunctionObj
+}
+
+//Inspect the parameter list; the body is bytecode by now so it's elided
+func (cf *CompiledFunction) Inspect() string {
+	return "fn(" + strings.Join(cf.Parameters(), ", ") + ") { ... }"
+}
+
+//Parameters the parameter names, which the compiler defines as the
+//function's first locals
+func (cf *CompiledFunction) Parameters() []string {
+	if len(cf.LocalNames) < cf.NumParameters {
+		return cf.LocalNames
+	}
+
+	return cf.LocalNames[:cf.NumParameters]
+}
+
+//Cell a local variable a closure has captured, shared by the function
+//it belongs to and every closure that captured it so an assignment on
+//either side is seen by the other.  Never a value in its own right
+type Cell struct {
+	Value Object
+}
+
+//Type type
+func (c *Cell) Type() ObjectType {
+	return CellObj
+}
+
+//Inspect the value inside
+func (c *Cell) Inspect() string {
+	return c.Value.Inspect()
+}
+
+//Closure a compiled function along with the free variables it captured
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+//Type type
+func (c *Closure) Type() ObjectType {
+	return FunctionObj
+}
+
+//Inspect inspect
+func (c *Closure) Inspect() string {
+	return c.Fn.Inspect()
+}
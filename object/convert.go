@@ -0,0 +1,475 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+//maxConvertDepth how deeply nested converted values may be, deeper
+//is taken to be a cycle
+const maxConvertDepth = 100
+
+var (
+	objectType = reflect.TypeOf((*Object)(nil)).Elem()
+	emptyType  = reflect.TypeOf((*interface{})(nil)).Elem()
+	bigIntType = reflect.TypeOf((*big.Int)(nil))
+)
+
+//tooDeepError a value nested past maxConvertDepth.  It only keeps the
+//innermost context, a cycle would repeat the same field a hundred times
+type tooDeepError struct {
+	context string
+}
+
+func (e *tooDeepError) Error() string {
+	return fmt.Sprintf("%svalue nested more than %d deep, is it cyclic?", e.context, maxConvertDepth)
+}
+
+//within err with context, e.g. "field Name: ", in front
+func within(context string, err error) error {
+	if deep, ok := err.(*tooDeepError); ok {
+		if deep.context == "" {
+			deep.context = context
+		}
+		return deep
+	}
+
+	return errors.New(context + err.Error())
+}
+
+//FromGo the monkey value for v.  Ints, *big.Ints, floats, strings and
+//bools become integers, floats, strings and booleans, slices and
+//arrays become arrays, maps become hashes and structs become hashes
+//keyed by field name or by the name in a `monkey:"name"` tag.
+//Pointers and interfaces are followed, nil is null and Objects are
+//kept as they are
+func FromGo(v interface{}) (Object, error) {
+	if v == nil {
+		return NULL, nil
+	}
+
+	return FromGoValue(reflect.ValueOf(v))
+}
+
+//FromGoValue FromGo for a reflected value
+func FromGoValue(v reflect.Value) (Object, error) {
+	return fromGo(v, 0)
+}
+
+//ToGo store o in what target points to, converting it the reverse of
+//FromGo, integers are also accepted for floats.  Into an interface{}
+//integers become int64, or *big.Int when they don't fit, floats
+//float64, arrays []interface{} and hashes map[string]interface{}, or
+//map[interface{}]interface{} when not all their keys are strings
+func ToGo(o Object, target interface{}) error {
+	ptr := reflect.ValueOf(target)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() {
+		return fmt.Errorf("can't convert to %T, want a non-nil pointer", target)
+	}
+
+	value, err := ToGoValue(o, ptr.Type().Elem())
+	if err != nil {
+		return err
+	}
+
+	ptr.Elem().Set(value)
+
+	return nil
+}
+
+//ToGoValue convert o to a value of type t
+func ToGoValue(o Object, t reflect.Type) (reflect.Value, error) {
+	return toGo(o, t, 0)
+}
+
+//Convertible nil if values of type t can go through FromGo and ToGo,
+//otherwise why not
+func Convertible(t reflect.Type) error {
+	return convertible(t, map[reflect.Type]bool{})
+}
+
+func convertible(t reflect.Type, seen map[reflect.Type]bool) error {
+	if t == objectType || t.Implements(objectType) || t == emptyType || t == bigIntType {
+		return nil
+	}
+	if seen[t] {
+		return nil
+	}
+	seen[t] = true
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.String, reflect.Bool:
+		return nil
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return convertible(t.Elem(), seen)
+	case reflect.Map:
+		if err := convertible(t.Key(), seen); err != nil {
+			return err
+		}
+		return convertible(t.Elem(), seen)
+	case reflect.Struct:
+		for _, field := range fields(t) {
+			if err := convertible(field.Type, seen); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported Go type %s", t)
+	}
+}
+
+func fromGo(v reflect.Value, depth int) (Object, error) {
+	if depth > maxConvertDepth {
+		return nil, &tooDeepError{}
+	}
+
+	if !v.IsValid() {
+		return NULL, nil
+	}
+
+	if v.Type().Implements(objectType) {
+		if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+			return NULL, nil
+		}
+		return v.Interface().(Object), nil
+	}
+
+	if v.Type() == bigIntType {
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return NewInteger(new(big.Int).Set(v.Interface().(*big.Int))), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return NewInteger(new(big.Int).SetUint64(v.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return &Float{Value: v.Float()}, nil
+	case reflect.String:
+		return &String{Value: v.String()}, nil
+	case reflect.Bool:
+		if v.Bool() {
+			return TRUE, nil
+		}
+		return FALSE, nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return fromGo(v.Elem(), depth+1)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return NULL, nil
+		}
+
+		elements := make([]Object, v.Len())
+		for i := range elements {
+			element, err := fromGo(v.Index(i), depth+1)
+			if err != nil {
+				return nil, within(fmt.Sprintf("element %d: ", i), err)
+			}
+			elements[i] = element
+		}
+
+		return &Array{Elements: elements}, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return NULL, nil
+		}
+
+		pairs := make(map[HashKey]HashPair, v.Len())
+		for _, k := range v.MapKeys() {
+			key, err := fromGo(k, depth+1)
+			if err != nil {
+				return nil, within(fmt.Sprintf("key %v: ", k), err)
+			}
+
+			hashable, ok := key.(Hashable)
+			if !ok {
+				return nil, fmt.Errorf("unusable as a hash key: %s", key.Type())
+			}
+
+			value, err := fromGo(v.MapIndex(k), depth+1)
+			if err != nil {
+				return nil, within(fmt.Sprintf("value for %v: ", k), err)
+			}
+
+			pairs[hashable.HashKey()] = HashPair{Key: key, Value: value}
+		}
+
+		return &Hash{Pairs: pairs}, nil
+	case reflect.Struct:
+		pairs := map[HashKey]HashPair{}
+		for _, field := range fields(v.Type()) {
+			value, err := fromGo(v.FieldByIndex(field.Index), depth+1)
+			if err != nil {
+				return nil, within("field "+field.Name+": ", err)
+			}
+
+			key := &String{Value: field.key}
+			pairs[key.HashKey()] = HashPair{Key: key, Value: value}
+		}
+
+		return &Hash{Pairs: pairs}, nil
+	default:
+		return nil, fmt.Errorf("unsupported Go type %s", v.Type())
+	}
+}
+
+func toGo(o Object, t reflect.Type, depth int) (reflect.Value, error) {
+	value := reflect.New(t).Elem()
+
+	if depth > maxConvertDepth {
+		return value, &tooDeepError{}
+	}
+
+	if t == emptyType {
+		natural, err := natural(o, depth)
+		if err != nil {
+			return value, err
+		}
+		if natural != nil {
+			value.Set(reflect.ValueOf(natural))
+		}
+		return value, nil
+	}
+
+	if t == objectType || t.Implements(objectType) {
+		if !reflect.TypeOf(o).AssignableTo(t) {
+			return value, fmt.Errorf("must be %s, got %s", t, o.Type())
+		}
+		value.Set(reflect.ValueOf(o))
+		return value, nil
+	}
+
+	if o == NULL {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map:
+			return value, nil
+		}
+	}
+
+	if t == bigIntType {
+		integer, ok := BigValue(o)
+		if !ok {
+			return value, fmt.Errorf("must be %s, got %s", IntegerObj, o.Type())
+		}
+		value.Set(reflect.ValueOf(new(big.Int).Set(integer)))
+		return value, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		integer, ok := BigValue(o)
+		if !ok {
+			return value, fmt.Errorf("must be %s, got %s", IntegerObj, o.Type())
+		}
+		if !integer.IsInt64() || value.OverflowInt(integer.Int64()) {
+			return value, fmt.Errorf("%s doesn't fit in %s", integer, t)
+		}
+		value.SetInt(integer.Int64())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		integer, ok := BigValue(o)
+		if !ok {
+			return value, fmt.Errorf("must be %s, got %s", IntegerObj, o.Type())
+		}
+		if !integer.IsUint64() || value.OverflowUint(integer.Uint64()) {
+			return value, fmt.Errorf("%s doesn't fit in %s", integer, t)
+		}
+		value.SetUint(integer.Uint64())
+	case reflect.Float32, reflect.Float64:
+		float, ok := FloatValue(o)
+		if !ok {
+			return value, fmt.Errorf("must be %s, got %s", FloatObj, o.Type())
+		}
+		if value.OverflowFloat(float) {
+			return value, fmt.Errorf("%g doesn't fit in %s", float, t)
+		}
+		value.SetFloat(float)
+	case reflect.String:
+		str, ok := o.(*String)
+		if !ok {
+			return value, fmt.Errorf("must be %s, got %s", StringObj, o.Type())
+		}
+		value.SetString(str.Value)
+	case reflect.Bool:
+		boolean, ok := o.(*Boolean)
+		if !ok {
+			return value, fmt.Errorf("must be %s, got %s", BooleanObj, o.Type())
+		}
+		value.SetBool(boolean.Value)
+	case reflect.Ptr:
+		elem, err := toGo(o, t.Elem(), depth+1)
+		if err != nil {
+			return value, err
+		}
+		value.Set(reflect.New(t.Elem()))
+		value.Elem().Set(elem)
+	case reflect.Slice, reflect.Array:
+		array, ok := o.(*Array)
+		if !ok {
+			return value, fmt.Errorf("must be %s, got %s", ArrayObj, o.Type())
+		}
+
+		if t.Kind() == reflect.Slice {
+			value.Set(reflect.MakeSlice(t, len(array.Elements), len(array.Elements)))
+		} else if t.Len() != len(array.Elements) {
+			return value, fmt.Errorf("must have %d elements, got %d", t.Len(), len(array.Elements))
+		}
+
+		for i, el := range array.Elements {
+			element, err := toGo(el, t.Elem(), depth+1)
+			if err != nil {
+				return value, within(fmt.Sprintf("element %d ", i), err)
+			}
+			value.Index(i).Set(element)
+		}
+	case reflect.Map:
+		hash, ok := o.(*Hash)
+		if !ok {
+			return value, fmt.Errorf("must be %s, got %s", HashObj, o.Type())
+		}
+
+		value.Set(reflect.MakeMapWithSize(t, len(hash.Pairs)))
+		for _, pair := range hash.Pairs {
+			key, err := toGo(pair.Key, t.Key(), depth+1)
+			if err != nil {
+				return value, within("key "+pair.Key.Inspect()+" ", err)
+			}
+
+			v, err := toGo(pair.Value, t.Elem(), depth+1)
+			if err != nil {
+				return value, within("value for "+pair.Key.Inspect()+" ", err)
+			}
+
+			value.SetMapIndex(key, v)
+		}
+	case reflect.Struct:
+		hash, ok := o.(*Hash)
+		if !ok {
+			return value, fmt.Errorf("must be %s, got %s", HashObj, o.Type())
+		}
+
+		for _, field := range fields(t) {
+			key := &String{Value: field.key}
+			pair, ok := hash.Pairs[key.HashKey()]
+			if !ok {
+				continue
+			}
+
+			v, err := toGo(pair.Value, field.Type, depth+1)
+			if err != nil {
+				return value, within("field "+field.key+" ", err)
+			}
+			value.FieldByIndex(field.Index).Set(v)
+		}
+	default:
+		return value, fmt.Errorf("unsupported Go type %s", t)
+	}
+
+	return value, nil
+}
+
+//natural the plain Go value for o
+func natural(o Object, depth int) (interface{}, error) {
+	if depth > maxConvertDepth {
+		return nil, &tooDeepError{}
+	}
+
+	switch o := o.(type) {
+	case *Null:
+		return nil, nil
+	case *Integer:
+		return o.Value, nil
+	case *BigInteger:
+		return new(big.Int).Set(o.Value), nil
+	case *Float:
+		return o.Value, nil
+	case *String:
+		return o.Value, nil
+	case *Boolean:
+		return o.Value, nil
+	case *Array:
+		elements := make([]interface{}, len(o.Elements))
+		for i, el := range o.Elements {
+			element, err := natural(el, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = element
+		}
+		return elements, nil
+	case *Hash:
+		byString := map[string]interface{}{}
+		byAny := map[interface{}]interface{}{}
+		for _, pair := range o.Pairs {
+			key, err := natural(pair.Key, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			value, err := natural(pair.Value, depth+1)
+			if err != nil {
+				return nil, err
+			}
+
+			if s, ok := key.(string); ok && byString != nil {
+				byString[s] = value
+			} else {
+				byString = nil
+			}
+			byAny[key] = value
+		}
+
+		if byString != nil {
+			return byString, nil
+		}
+		return byAny, nil
+	default:
+		return o, nil
+	}
+}
+
+type field struct {
+	reflect.StructField
+	key string
+}
+
+//fields the exported fields of struct type t and the hash keys they
+//go by, sorted by key
+func fields(t reflect.Type) []field {
+	result := []field{}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		key := f.Name
+		if tag, ok := f.Tag.Lookup("monkey"); ok {
+			name := strings.Split(tag, ",")[0]
+			if name == "-" {
+				continue
+			}
+			if name != "" {
+				key = name
+			}
+		}
+
+		result = append(result, field{StructField: f, key: key})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].key < result[j].key })
+
+	return result
+}
@@ -37,3 +37,29 @@ func (e *Environment) Set(name string, val Object) Object {
 
 	return val
 }
+
+//Outer the environment this one is enclosed in, nil for the outermost
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
+
+//Each call f with every value bound in this environment, not in the
+//ones it's enclosed in
+func (e *Environment) Each(f func(name string, val Object)) {
+	for name, val := range e.store {
+		f(name, val)
+	}
+}
+
+//Assign rebind name in the nearest environment that defines it, this
+//one or an enclosing one.  False when none does
+func (e *Environment) Assign(name string, val Object) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			env.store[name] = val
+			return true
+		}
+	}
+
+	return false
+}
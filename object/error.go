@@ -1,8 +1,92 @@
 package object
 
-//Error error
+import (
+	"bytes"
+	"fmt"
+	"monkey/token"
+)
+
+//maxTracebackFrames longer tracebacks only show their ends
+const maxTracebackFrames = 20
+
+//Frame a function call an error unwound through.  Function is a
+//*Function or a *Closure depending on the engine
+type Frame struct {
+	Function Object
+	Call     token.Position
+}
+
+//Name the function's name or <anonymous>
+func (f Frame) Name() string {
+	name := ""
+
+	switch fn := f.Function.(type) {
+	case *Function:
+		name = fn.Name
+	case *Closure:
+		name = fn.Fn.Name
+	}
+
+	if name == "" {
+		return "<anonymous>"
+	}
+
+	return name
+}
+
+//ErrorKind sorts errors a host may want to tell apart
+type ErrorKind int
+
+const (
+	//RuntimeError a mistake in the script
+	RuntimeError ErrorKind = iota
+	//StepLimitError the run took more steps than it was allowed
+	StepLimitError
+	//DepthLimitError calls nested deeper than allowed
+	DepthLimitError
+	//TimeoutError the run went past its deadline
+	TimeoutError
+	//InterruptedError the run was cancelled, say by Ctrl-C
+	InterruptedError
+	//MemoryLimitError the run held more memory than allowed
+	MemoryLimitError
+	//PermissionError a builtin was called without a capability it needs
+	PermissionError
+	//OverflowError integer arithmetic overflowed with strict integers on
+	OverflowError
+	//InternalError the interpreter itself failed, a bug rather than a
+	//mistake in the script
+	InternalError
+)
+
+//Error error.  Pos is where it happened, Stack the calls it unwound
+//through with the innermost first
 type Error struct {
 	Message string
+	Kind    ErrorKind
+	Pos     token.Position
+	Stack   []Frame
+}
+
+//NewError error with a printf style message
+func NewError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
+
+//Error so runtime errors can travel as Go errors too
+func (e *Error) Error() string {
+	return e.Message
+}
+
+//Aborted whether the error stopped the run from outside the script,
+//rather than being a mistake in it
+func (e *Error) Aborted() bool {
+	switch e.Kind {
+	case StepLimitError, DepthLimitError, TimeoutError, InterruptedError, MemoryLimitError:
+		return true
+	default:
+		return false
+	}
 }
 
 //Type type
@@ -10,7 +94,33 @@ func (e *Error) Type() ObjectType {
 	return ErrorObj
 }
 
-//Inspect inspect
+//Inspect message followed by a traceback, innermost call first
 func (e *Error) Inspect() string {
-	return "ERROR: " + e.Message
+	var out bytes.Buffer
+
+	out.WriteString("ERROR: " + e.Message)
+
+	if !e.Pos.IsValid() {
+		return out.String()
+	}
+
+	lines := []string{}
+	pos := e.Pos
+	for _, frame := range e.Stack {
+		lines = append(lines, fmt.Sprintf("    at %s (%s)", frame.Name(), pos))
+		pos = frame.Call
+	}
+	lines = append(lines, fmt.Sprintf("    at <main> (%s)", pos))
+
+	if len(lines) > maxTracebackFrames {
+		half := maxTracebackFrames / 2
+		skipped := len(lines) - maxTracebackFrames
+		lines = append(append(lines[:half:half], fmt.Sprintf("    ... %d more frames", skipped)), lines[len(lines)-half:]...)
+	}
+
+	for _, line := range lines {
+		out.WriteString("\n" + line)
+	}
+
+	return out.String()
 }
@@ -0,0 +1,51 @@
+package object
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+//ExecutionContext what the builtins of a run can reach outside the
+//script.  Everything they print goes to Stdout or Stderr and what they
+//read comes from Stdin.  StrictIntegers makes integer overflow an
+//OverflowError instead of going on in a BigInteger
+type ExecutionContext struct {
+	Capabilities   *Capabilities
+	Stdout         io.Writer
+	Stderr         io.Writer
+	Stdin          io.Reader
+	StrictIntegers bool
+
+	input     *bufio.Reader
+	inputFrom io.Reader
+}
+
+//NewExecutionContext context with the default capabilities on the
+//process's standard streams
+func NewExecutionContext() *ExecutionContext {
+	return &ExecutionContext{
+		Capabilities: DefaultCapabilities(),
+		Stdout:       os.Stdout,
+		Stderr:       os.Stderr,
+		Stdin:        os.Stdin,
+	}
+}
+
+//ReadLine the next line of Stdin without its line ending.  io.EOF once
+//there is nothing left to read.  Input read ahead is kept for the next
+//call, so a *bufio.Reader the host also reads from can be shared
+func (c *ExecutionContext) ReadLine() (string, error) {
+	if c.input == nil || c.inputFrom != c.Stdin {
+		c.input = bufio.NewReader(c.Stdin)
+		c.inputFrom = c.Stdin
+	}
+
+	line, err := c.input.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+
+	return strings.TrimRight(line, "\r\n"), err
+}
@@ -0,0 +1,87 @@
+package object
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+//Float Float Object
+type Float struct {
+	Value float64
+}
+
+//Inspect Inspection, always with a decimal point or exponent so it
+//can't be mistaken for an integer
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+
+	return s
+}
+
+//Type type
+func (f *Float) Type() ObjectType {
+	return FloatObj
+}
+
+//FloatValue the value of an INTEGER or FLOAT as a float64, integers are
+//promoted, to the nearest float when they're big
+func FloatValue(o Object) (float64, bool) {
+	switch o := o.(type) {
+	case *Integer:
+		return float64(o.Value), true
+	case *BigInteger:
+		value, _ := new(big.Float).SetInt(o.Value).Float64()
+		return value, true
+	case *Float:
+		return o.Value, true
+	default:
+		return 0, false
+	}
+}
+
+//FloatOperation apply an arithmetic or comparison operator to two
+//numbers, at least one of them a float and the other promoted to one
+func FloatOperation(operator string, left, right Object) Object {
+	leftFloat, _ := FloatValue(left)
+	rightFloat, _ := FloatValue(right)
+
+	switch operator {
+	case "+":
+		return &Float{Value: leftFloat + rightFloat}
+	case "-":
+		return &Float{Value: leftFloat - rightFloat}
+	case "*":
+		return &Float{Value: leftFloat * rightFloat}
+	case "/":
+		if rightFloat == 0 {
+			return divisionByZero(left, operator, right)
+		}
+		return &Float{Value: leftFloat / rightFloat}
+	case "%":
+		if rightFloat == 0 {
+			return divisionByZero(left, operator, right)
+		}
+		return &Float{Value: math.Mod(leftFloat, rightFloat)}
+	case "**":
+		return &Float{Value: math.Pow(leftFloat, rightFloat)}
+	case "<":
+		return nativeBool(leftFloat < rightFloat)
+	case ">":
+		return nativeBool(leftFloat > rightFloat)
+	case "<=":
+		return nativeBool(leftFloat <= rightFloat)
+	case ">=":
+		return nativeBool(leftFloat >= rightFloat)
+	case "==":
+		return nativeBool(leftFloat == rightFloat)
+	case "!=":
+		return nativeBool(leftFloat != rightFloat)
+	default:
+		return NewError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
@@ -4,8 +4,9 @@ import "monkey/ast"
 import "bytes"
 import "strings"
 
-//Function function
+//Function function.  Name is the name it was first bound to with let
 type Function struct {
+	Name       string
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
@@ -29,7 +30,7 @@ func (f *Function) Inspect() string {
 	out.WriteString("fn")
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
-	out.WriteString("} {\n")
+	out.WriteString(") {\n")
 	out.WriteString(f.Body.String())
 	out.WriteString("\n}")
 
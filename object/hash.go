@@ -20,13 +20,54 @@ type Hash struct {
 //Type type
 func (h *Hash) Type() ObjectType { return HashObj }
 
+//SetIndex left[index] = value for an array, whose index has to be in
+//range, or a hash.  Either is changed in place.  value, or an error
+func SetIndex(left, index, value Object) Object {
+	switch left := left.(type) {
+	case *Array:
+		if big, ok := index.(*BigInteger); ok {
+			return NewError("index out of range: %s", big.Inspect())
+		}
+		i, ok := index.(*Integer)
+		if !ok {
+			return NewError("array index must be INTEGER, got %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return NewError("index out of range: %d", i.Value)
+		}
+
+		left.Elements[i.Value] = value
+	case *Hash:
+		key, ok := index.(Hashable)
+		if !ok {
+			return NewError("unusable as a hash key: %s", index.Type())
+		}
+
+		left.Pairs[key.HashKey()] = HashPair{Key: index, Value: value}
+	default:
+		return NewError("index assignment not supported: %s", left.Type())
+	}
+
+	return value
+}
+
 //Inspect inspect
 func (h *Hash) Inspect() string {
+	return h.inspect(map[Object]bool{})
+}
+
+func (h *Hash) inspect(printing map[Object]bool) string {
+	if printing[h] {
+		return "{...}"
+	}
+	printing[h] = true
+	defer delete(printing, h)
+
 	var out bytes.Buffer
 
 	pairs := []string{}
 	for _, pair := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
+		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), inspectWithin(pair.Value, printing)))
 	}
 
 	out.WriteString("{")
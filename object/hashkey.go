@@ -2,6 +2,8 @@ package object
 
 import (
 	"hash/fnv"
+	"math"
+	"math/big"
 )
 
 type Hashable interface {
@@ -31,6 +33,40 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+//HashKey big integers, hashed on their digits as strings are
+func (b *BigInteger) HashKey() HashKey {
+	if b.Value.IsInt64() {
+		return (&Integer{Value: b.Value.Int64()}).HashKey()
+	}
+
+	h := fnv.New64a()
+	h.Write(b.Value.Bytes())
+	if b.Value.Sign() < 0 {
+		h.Write([]byte{'-'})
+	}
+
+	return HashKey{Type: bigIntegerKey, Value: h.Sum64()}
+}
+
+//bigIntegerKey keeps the keys of big integers apart from those of
+//integers whose value happens to equal the hash
+const bigIntegerKey ObjectType = "BIG_INTEGER"
+
+//HashKey floats, a whole number has the key of the equal integer so
+//1.0 and 1 find the same entry
+func (f *Float) HashKey() HashKey {
+	if f.Value == math.Trunc(f.Value) && f.Value >= math.MinInt64 && f.Value < math.MaxInt64 {
+		return HashKey{Type: IntegerObj, Value: uint64(int64(f.Value))}
+	}
+
+	if f.Value == math.Trunc(f.Value) && !math.IsInf(f.Value, 0) {
+		whole, _ := big.NewFloat(f.Value).Int(nil)
+		return (&BigInteger{Value: whole}).HashKey()
+	}
+
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 //HashKey strings
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
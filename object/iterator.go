@@ -0,0 +1,177 @@
+package object
+
+import (
+	"fmt"
+	"sort"
+)
+
+//Iterable an object a for loop can step through.  Future collections
+//and iterators made by builtins implement it to be looped over
+type Iterable interface {
+	Iterate() Iterator
+}
+
+//Iterator where a for loop is in stepping through an Iterable.  Next
+//the next key and value, ok is false once there are none left.  A loop
+//with one name binds only the value
+type Iterator interface {
+	Object
+	Next() (key, value Object, ok bool)
+}
+
+//IteratorFunc an Iterator whose Next is the function
+type IteratorFunc func() (key, value Object, ok bool)
+
+//Type type
+func (f IteratorFunc) Type() ObjectType {
+	return IteratorObj
+}
+
+//Inspect inspect
+func (f IteratorFunc) Inspect() string {
+	return "iterator"
+}
+
+//Next call f
+func (f IteratorFunc) Next() (key, value Object, ok bool) {
+	return f()
+}
+
+//Iterate an iterator is already under way, so it iterates over itself
+func (f IteratorFunc) Iterate() Iterator {
+	return f
+}
+
+//Iterate an iterator over o, or an error when o isn't Iterable
+func Iterate(o Object) Object {
+	if iterable, ok := o.(Iterable); ok {
+		return iterable.Iterate()
+	}
+
+	return NewError("cannot iterate over %s", o.Type())
+}
+
+//Iterate the elements with their indexes.  Elements set while the loop
+//runs are seen if it hasn't got to them yet
+func (ao *Array) Iterate() Iterator {
+	i := 0
+
+	return IteratorFunc(func() (Object, Object, bool) {
+		if i >= len(ao.Elements) {
+			return nil, nil, false
+		}
+
+		i++
+		return &Integer{Value: int64(i - 1)}, ao.Elements[i-1], true
+	})
+}
+
+//Iterate the characters as strings of their own, with their indexes
+//counted in characters
+func (s *String) Iterate() Iterator {
+	chars := []rune(s.Value)
+	i := 0
+
+	return IteratorFunc(func() (Object, Object, bool) {
+		if i >= len(chars) {
+			return nil, nil, false
+		}
+
+		i++
+		return &Integer{Value: int64(i - 1)}, &String{Value: string(chars[i-1])}, true
+	})
+}
+
+//Iterate the pairs as they were when the loop started, in the order of
+//their keys so every run goes through them the same way
+func (h *Hash) Iterate() Iterator {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair)
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return keyLess(pairs[i].Key, pairs[j].Key)
+	})
+
+	i := 0
+
+	return IteratorFunc(func() (Object, Object, bool) {
+		if i >= len(pairs) {
+			return nil, nil, false
+		}
+
+		i++
+		return pairs[i-1].Key, pairs[i-1].Value, true
+	})
+}
+
+//keyLess orders hash keys, those of the same type by value and the
+//rest by type
+func keyLess(a, b Object) bool {
+	switch a := a.(type) {
+	case *Integer:
+		if b, ok := b.(*Integer); ok {
+			return a.Value < b.Value
+		}
+	case *Float:
+		if b, ok := b.(*Float); ok {
+			return a.Value < b.Value
+		}
+	case *String:
+		if b, ok := b.(*String); ok {
+			return a.Value < b.Value
+		}
+	case *Boolean:
+		if b, ok := b.(*Boolean); ok {
+			return !a.Value && b.Value
+		}
+	}
+
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+
+	return a.Inspect() < b.Inspect()
+}
+
+//Range the integers from Start up to End, not including it, counting
+//by Step, which counts down when it's negative.  They're made as the
+//loop gets to them rather than stored
+type Range struct {
+	Start int64
+	End   int64
+	Step  int64
+}
+
+//Type type
+func (r *Range) Type() ObjectType {
+	return RangeObj
+}
+
+//Inspect inspect
+func (r *Range) Inspect() string {
+	return fmt.Sprintf("range(%d, %d, %d)", r.Start, r.End, r.Step)
+}
+
+//Iterate the integers with how many came before each
+func (r *Range) Iterate() Iterator {
+	next := r.Start
+	done := r.Step == 0
+	i := 0
+
+	return IteratorFunc(func() (Object, Object, bool) {
+		if done || (r.Step > 0 && next >= r.End) || (r.Step < 0 && next <= r.End) {
+			return nil, nil, false
+		}
+
+		value := next
+		next += r.Step
+		// Stop rather than wrap round past the largest or smallest
+		// integer
+		done = (r.Step > 0) != (next > value)
+
+		i++
+		return &Integer{Value: int64(i - 1)}, &Integer{Value: value}, true
+	})
+}
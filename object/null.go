@@ -1,5 +1,8 @@
 package object
 
+//NULL the one and only null
+var NULL = &Null{}
+
 //Null null
 type Null struct {
 }
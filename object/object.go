@@ -9,10 +9,16 @@ const (
 	BooleanObj = "BOOLEAN"
 	//IntegerObj int
 	IntegerObj = "INTEGER"
+	//FloatObj float
+	FloatObj = "FLOAT"
 	//NullObj null
 	NullObj = "NULL"
 	//ReturnObj return
 	ReturnObj = "RETURN"
+	//BreakObj break
+	BreakObj = "BREAK"
+	//ContinueObj continue
+	ContinueObj = "CONTINUE"
 	//ErrorObj error
 	ErrorObj = "ERROR"
 	//FunctionObj function
@@ -25,6 +31,14 @@ const (
 	ArrayObj = "ARRAY"
 	//HashObj hash
 	HashObj = "HASH"
+	//CompiledFunctionObj bytecode function
+	CompiledFunctionObj = "COMPILED_FUNCTION"
+	//CellObj captured variable
+	CellObj = "CELL"
+	//IteratorObj iterator
+	IteratorObj = "ITERATOR"
+	//RangeObj range
+	RangeObj = "RANGE"
 )
 
 //Object object
@@ -32,3 +46,18 @@ type Object interface {
 	Type() ObjectType
 	Inspect() string
 }
+
+//inspectWithin o's Inspect, except that arrays and hashes already being
+//printed further out show as [...] and {...}.  Index assignment can make
+//a value contain itself, which would otherwise recurse until the stack
+//runs out
+func inspectWithin(o Object, printing map[Object]bool) string {
+	switch o := o.(type) {
+	case *Array:
+		return o.inspect(printing)
+	case *Hash:
+		return o.inspect(printing)
+	default:
+		return o.Inspect()
+	}
+}
@@ -1,6 +1,15 @@
 package object
 
-import "testing"
+import (
+	"io/ioutil"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello"}
@@ -21,3 +30,397 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("string with different content have same has key")
 	}
 }
+
+func TestEnvironmentAssign(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("x", &Integer{Value: 1})
+	inner := NewEnclosedEnvironment(outer)
+
+	if !inner.Assign("x", &Integer{Value: 2}) {
+		t.Fatalf("couldn't assign to x from an enclosed environment")
+	}
+
+	if x, _ := outer.Get("x"); x.(*Integer).Value != 2 {
+		t.Errorf("x wasn't updated where it was defined, got %s", x.Inspect())
+	}
+
+	if _, ok := inner.store["x"]; ok {
+		t.Errorf("assigning defined x in the enclosed environment")
+	}
+
+	if inner.Assign("y", &Integer{Value: 1}) {
+		t.Errorf("assigned to y, which isn't defined")
+	}
+}
+
+func TestIterate(t *testing.T) {
+	tests := []struct {
+		iterable Object
+		expected string
+	}{
+		{&Array{Elements: []Object{&Integer{Value: 7}, &String{Value: "x"}}}, "0:7 1:x"},
+		{&String{Value: "añb"}, "0:a 1:ñ 2:b"},
+		{&String{Value: ""}, ""},
+		{hashOf(&String{Value: "b"}, &Integer{Value: 2}, &String{Value: "a"}, &Integer{Value: 1}), "a:1 b:2"},
+		{hashOf(&Integer{Value: 10}, TRUE, &Integer{Value: -1}, FALSE, &String{Value: "s"}, NULL), "-1:false 10:true s:null"},
+		{&Range{Start: 0, End: 3, Step: 1}, "0:0 1:1 2:2"},
+		{&Range{Start: 5, End: 0, Step: -2}, "0:5 1:3 2:1"},
+		{&Range{Start: 0, End: -3, Step: 1}, ""},
+		{&Range{Start: math.MaxInt64 - 1, End: math.MaxInt64, Step: 5}, "0:9223372036854775806"},
+		{&Range{Start: math.MinInt64 + 2, End: math.MinInt64, Step: -3}, "0:-9223372036854775806"},
+	}
+
+	for _, tt := range tests {
+		iterator, ok := Iterate(tt.iterable).(Iterator)
+		if !ok {
+			t.Errorf("%s: not iterable", tt.iterable.Inspect())
+			continue
+		}
+
+		got := []string{}
+		for {
+			key, value, ok := iterator.Next()
+			if !ok {
+				break
+			}
+			got = append(got, key.Inspect()+":"+value.Inspect())
+		}
+
+		if strings.Join(got, " ") != tt.expected {
+			t.Errorf("%s: iterated over %q, wanted %q", tt.iterable.Inspect(), strings.Join(got, " "), tt.expected)
+		}
+	}
+
+	if err, ok := Iterate(&Integer{Value: 1}).(*Error); !ok || err.Message != "cannot iterate over INTEGER" {
+		t.Errorf("iterating over an integer should be an error, got %v", Iterate(&Integer{Value: 1}))
+	}
+}
+
+func hashOf(pairs ...Object) *Hash {
+	h := &Hash{Pairs: map[HashKey]HashPair{}}
+	for i := 0; i < len(pairs); i += 2 {
+		SetIndex(h, pairs[i], pairs[i+1])
+	}
+
+	return h
+}
+
+type address struct {
+	Street string `monkey:"street"`
+	Number int
+}
+
+type person struct {
+	Name    string           `monkey:"name"`
+	Age     int              `monkey:"age"`
+	Admin   bool             `monkey:"admin"`
+	Tags    []string         `monkey:"tags"`
+	Home    *address         `monkey:"home"`
+	Scores  map[string]int64 `monkey:"scores"`
+	Secret  string           `monkey:"-"`
+	private int
+}
+
+func TestGoConversionRoundTrip(t *testing.T) {
+	original := person{
+		Name:   "Ada",
+		Age:    36,
+		Admin:  true,
+		Tags:   []string{"math", "engines"},
+		Home:   &address{Street: "St James's Square", Number: 12},
+		Scores: map[string]int64{"chess": 3},
+		Secret: "hidden",
+	}
+
+	obj, err := FromGo(original)
+	if err != nil {
+		t.Fatalf("FromGo failed: %s", err)
+	}
+
+	hash, ok := obj.(*Hash)
+	if !ok {
+		t.Fatalf("expected a hash. got=%T", obj)
+	}
+
+	name := hash.Pairs[(&String{Value: "name"}).HashKey()].Value
+	if name.Inspect() != "Ada" {
+		t.Errorf("wrong name. got=%s", name.Inspect())
+	}
+	if _, ok := hash.Pairs[(&String{Value: "Secret"}).HashKey()]; ok {
+		t.Errorf("field tagged - was converted")
+	}
+	if len(hash.Pairs) != 6 {
+		t.Errorf("wrong number of pairs. want=6, got=%d", len(hash.Pairs))
+	}
+
+	var back person
+	if err := ToGo(obj, &back); err != nil {
+		t.Fatalf("ToGo failed: %s", err)
+	}
+
+	original.Secret = ""
+	if !reflect.DeepEqual(back, original) {
+		t.Errorf("round trip changed the value.\nwant=%+v\ngot=%+v", original, back)
+	}
+}
+
+func TestFromGo(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{nil, "null"},
+		{42, "42"},
+		{uint8(7), "7"},
+		{3.5, "3.5"},
+		{float32(2), "2.0"},
+		{uint64(1 << 63), "9223372036854775808"},
+		{big.NewInt(12), "12"},
+		{"monkey", "monkey"},
+		{false, "false"},
+		{[]int{1, 2}, "[1, 2]"},
+		{[2]bool{true, false}, "[true, false]"},
+		{map[int]string{1: "one"}, "{1: one}"},
+		{(*address)(nil), "null"},
+		{[]interface{}{1, "a", nil}, "[1, a, null]"},
+		{&Integer{Value: 5}, "5"},
+	}
+
+	for _, tt := range tests {
+		obj, err := FromGo(tt.input)
+		if err != nil {
+			t.Errorf("FromGo(%#v) failed: %s", tt.input, err)
+			continue
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("FromGo(%#v) wrong. want=%q, got=%q", tt.input, tt.expected, obj.Inspect())
+		}
+	}
+}
+
+func TestToGoNatural(t *testing.T) {
+	obj, _ := FromGo(map[string]interface{}{"n": 1, "f": 0.5, "list": []string{"a"}})
+
+	var v interface{}
+	if err := ToGo(obj, &v); err != nil {
+		t.Fatalf("ToGo failed: %s", err)
+	}
+
+	expected := map[string]interface{}{"n": int64(1), "f": 0.5, "list": []interface{}{"a"}}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("wrong value. want=%#v, got=%#v", expected, v)
+	}
+
+	mixed, _ := FromGo(map[interface{}]int{1: 1, "a": 2})
+	if err := ToGo(mixed, &v); err != nil {
+		t.Fatalf("ToGo failed: %s", err)
+	}
+	if _, ok := v.(map[interface{}]interface{}); !ok {
+		t.Errorf("hash with mixed keys should be map[interface{}]interface{}. got=%T", v)
+	}
+}
+
+func TestConversionErrors(t *testing.T) {
+	fromTests := []interface{}{
+		complex(1, 2),
+		make(chan int),
+		map[[1]int]int{{1}: 1},
+	}
+
+	for _, input := range fromTests {
+		if _, err := FromGo(input); err == nil {
+			t.Errorf("FromGo(%T) should fail", input)
+		}
+	}
+
+	var n int8
+	if err := ToGo(&Integer{Value: 300}, &n); err == nil {
+		t.Errorf("ToGo should fail for an integer that doesn't fit")
+	}
+
+	var s string
+	err := ToGo(&Integer{Value: 1}, &s)
+	if err == nil || err.Error() != "must be STRING, got INTEGER" {
+		t.Errorf("wrong error for a mismatched type. got=%v", err)
+	}
+
+	var p person
+	hash, _ := FromGo(map[string]interface{}{"age": "old"})
+	err = ToGo(hash, &p)
+	if err == nil || err.Error() != "field age must be INTEGER, got STRING" {
+		t.Errorf("wrong error for a mismatched field. got=%v", err)
+	}
+
+	if err := ToGo(hash, p); err == nil {
+		t.Errorf("ToGo should need a pointer")
+	}
+
+	type cyclic struct{ Next *cyclic }
+	c := &cyclic{}
+	c.Next = c
+	_, err = FromGo(c)
+	if err == nil || err.Error() != "field Next: value nested more than 100 deep, is it cyclic?" {
+		t.Errorf("wrong error for a cycle. got=%v", err)
+	}
+
+	self := &Hash{Pairs: map[HashKey]HashPair{}}
+	next := &String{Value: "Next"}
+	self.Pairs[next.HashKey()] = HashPair{Key: next, Value: self}
+	err = ToGo(self, &cyclic{})
+	if err == nil || err.Error() != "field Next value nested more than 100 deep, is it cyclic?" {
+		t.Errorf("wrong error for a cyclic hash. got=%v", err)
+	}
+}
+
+func TestFloat(t *testing.T) {
+	inspects := []struct {
+		value    float64
+		expected string
+	}{
+		{3.14, "3.14"},
+		{2, "2.0"},
+		{-0.5, "-0.5"},
+		{1e-9, "1e-09"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+		{math.NaN(), "NaN"},
+	}
+
+	for _, tt := range inspects {
+		if got := (&Float{Value: tt.value}).Inspect(); got != tt.expected {
+			t.Errorf("wrong Inspect for %v. want=%q, got=%q", tt.value, tt.expected, got)
+		}
+	}
+
+	if (&Float{Value: 1}).HashKey() != (&Integer{Value: 1}).HashKey() {
+		t.Errorf("a whole float should have the key of the equal integer")
+	}
+	if (&Float{Value: 1.5}).HashKey() == (&Integer{Value: 1}).HashKey() {
+		t.Errorf("1.5 and 1 have the same hash key")
+	}
+	huge, _ := new(big.Int).SetString("100000000000000000000", 10)
+	if (&Float{Value: 1e20}).HashKey() != (&BigInteger{Value: huge}).HashKey() {
+		t.Errorf("a whole float out of the int64 range should have the key of the equal big integer")
+	}
+
+	var f32 float32
+	if err := ToGo(&Integer{Value: 3}, &f32); err != nil || f32 != 3 {
+		t.Errorf("ToGo should promote integers to floats. got=%v, %v", f32, err)
+	}
+	if err := ToGo(&Float{Value: 1e300}, &f32); err == nil {
+		t.Errorf("ToGo should fail for a float that doesn't fit")
+	}
+}
+
+func TestIntegerOperation(t *testing.T) {
+	big63 := new(big.Int).Lsh(big.NewInt(1), 63)
+
+	tests := []struct {
+		operator string
+		left     Object
+		right    Object
+		expected string
+	}{
+		{"+", &Integer{Value: math.MaxInt64}, &Integer{Value: 1}, "9223372036854775808"},
+		{"-", &Integer{Value: math.MinInt64}, &Integer{Value: 1}, "-9223372036854775809"},
+		{"*", &Integer{Value: math.MaxInt64}, &Integer{Value: 2}, "18446744073709551614"},
+		{"*", &Integer{Value: math.MinInt64}, &Integer{Value: -1}, "9223372036854775808"},
+		{"/", &Integer{Value: math.MinInt64}, &Integer{Value: -1}, "9223372036854775808"},
+		{"-", &BigInteger{Value: big63}, &Integer{Value: 1}, "9223372036854775807"},
+		{"<", &Integer{Value: 5}, &BigInteger{Value: big63}, "true"},
+		{"==", &BigInteger{Value: big63}, &BigInteger{Value: new(big.Int).Set(big63)}, "true"},
+		{"+", &Integer{Value: 2}, &Integer{Value: 3}, "5"},
+	}
+
+	for _, tt := range tests {
+		result := IntegerOperation(tt.operator, tt.left, tt.right, false)
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s %s %s wrong. want=%s, got=%s", tt.left.Inspect(), tt.operator, tt.right.Inspect(), tt.expected, result.Inspect())
+		}
+	}
+
+	if demoted := IntegerOperation("-", &BigInteger{Value: big63}, &Integer{Value: 1}, false); reflect.TypeOf(demoted) != reflect.TypeOf(&Integer{}) {
+		t.Errorf("result that fits should be an *Integer. got=%T", demoted)
+	}
+
+	err, ok := IntegerOperation("+", &Integer{Value: math.MaxInt64}, &Integer{Value: 1}, true).(*Error)
+	if !ok || err.Kind != OverflowError {
+		t.Errorf("strict overflow should be an OverflowError. got=%+v", err)
+	}
+
+	if (&BigInteger{Value: big.NewInt(7)}).HashKey() != (&Integer{Value: 7}).HashKey() {
+		t.Errorf("big and small integers of the same value have different keys")
+	}
+}
+
+func TestParseCapabilities(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Capability
+	}{
+		{"", 0},
+		{"read", CapFileRead},
+		{"env, clock", CapEnv | CapClock},
+		{"stdin,stderr", CapStdin | CapStderr},
+		{"all", CapStdout | CapFileRead | CapFileWrite | CapEnv | CapClock | CapRandom | CapStderr | CapStdin},
+	}
+
+	for _, tt := range tests {
+		c, err := ParseCapabilities(tt.input)
+		if err != nil {
+			t.Errorf("ParseCapabilities(%q) failed: %s", tt.input, err)
+			continue
+		}
+		if c != tt.expected {
+			t.Errorf("ParseCapabilities(%q) wrong. want=%s, got=%s", tt.input, tt.expected, c)
+		}
+	}
+
+	if _, err := ParseCapabilities("read,network"); err == nil {
+		t.Errorf("ParseCapabilities should fail on an unknown name")
+	}
+}
+
+func TestCheckPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "roots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "root")
+	outside := filepath.Join(dir, "outside")
+	for _, d := range []string{root, outside} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Capabilities{Granted: CapFileRead | CapFileWrite, ReadRoots: []string{root}}
+
+	tests := []struct {
+		need    Capability
+		path    string
+		allowed bool
+	}{
+		{CapFileRead, filepath.Join(root, "a.txt"), true},
+		{CapFileRead, filepath.Join(root, "new", "b.txt"), true},
+		{CapFileRead, filepath.Join(root, "..", "outside", "a.txt"), false},
+		{CapFileRead, filepath.Join(root, "link", "a.txt"), false},
+		{CapFileRead, root + "-sibling", false},
+		{CapFileWrite, filepath.Join(outside, "a.txt"), true},
+	}
+
+	for _, tt := range tests {
+		err := c.CheckPath(tt.need, tt.path)
+		if (err == nil) != tt.allowed {
+			t.Errorf("CheckPath(%s, %q) wrong. allowed=%t, got=%v", tt.need, tt.path, tt.allowed, err)
+		}
+		if err != nil && err.Kind != PermissionError {
+			t.Errorf("CheckPath(%s, %q) wrong kind. got=%d", tt.need, tt.path, err.Kind)
+		}
+	}
+}
@@ -14,3 +14,35 @@ func (rv *ReturnValue) Type() ObjectType {
 func (rv *ReturnValue) Inspect() string {
 	return rv.Value.Inspect()
 }
+
+//Break a break statement on its way out to the loop it ends, the
+//innermost one when Label is empty
+type Break struct {
+	Label string
+}
+
+//Type type
+func (b *Break) Type() ObjectType {
+	return BreakObj
+}
+
+//Inspect inspect
+func (b *Break) Inspect() string {
+	return "break"
+}
+
+//Continue a continue statement on its way out to the loop it goes on
+//with, the innermost one when Label is empty
+type Continue struct {
+	Label string
+}
+
+//Type type
+func (c *Continue) Type() ObjectType {
+	return ContinueObj
+}
+
+//Inspect inspect
+func (c *Continue) Inspect() string {
+	return "continue"
+}
@@ -14,3 +14,50 @@ func (s *String) Inspect() string {
 func (s *String) Type() ObjectType {
 	return StringObj
 }
+
+//ToString the string itself
+func (s *String) ToString() string {
+	return s.Value
+}
+
+//Stringer an object with a string conversion of its own, which
+//interpolation uses in place of Inspect
+type Stringer interface {
+	ToString() string
+}
+
+//ToString o converted for interpolating into a string, by its ToString
+//when it's a Stringer, otherwise by its Inspect
+func ToString(o Object) string {
+	if s, ok := o.(Stringer); ok {
+		return s.ToString()
+	}
+
+	return o.Inspect()
+}
+
+//StringOperation apply + or a comparison to two strings, which compare
+//byte by byte
+func StringOperation(operator string, left, right Object) Object {
+	leftValue := left.(*String).Value
+	rightValue := right.(*String).Value
+
+	switch operator {
+	case "+":
+		return &String{Value: leftValue + rightValue}
+	case "==":
+		return nativeBool(leftValue == rightValue)
+	case "!=":
+		return nativeBool(leftValue != rightValue)
+	case "<":
+		return nativeBool(leftValue < rightValue)
+	case ">":
+		return nativeBool(leftValue > rightValue)
+	case "<=":
+		return nativeBool(leftValue <= rightValue)
+	case ">=":
+		return nativeBool(leftValue >= rightValue)
+	default:
+		return NewError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
@@ -2,45 +2,122 @@ package parser
 
 import (
 	"monkey/ast"
+	"monkey/diagnostic"
 	"monkey/lexer"
 	"monkey/token"
+	"errors"
 	"fmt"
+	"math/big"
 	"strconv"
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.OR:              OR,
+	token.AND:             AND,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.LT_EQ:           LESSGREATER,
+	token.GT_EQ:           LESSGREATER,
+	token.PIPE:            BITOR,
+	token.CARET:           BITXOR,
+	token.AMPERSAND:       BITAND,
+	token.SHIFT_LEFT:      SHIFT,
+	token.SHIFT_RIGHT:     SHIFT,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.PERCENT:         PRODUCT,
+	token.POWER:           POWER,
+	token.LPAREN:          CALL,
+	token.LBRACKET:        INDEX,
 }
 
 const (
 	_ int = iota
 	//LOWEST none
 	LOWEST
+	//ASSIGN = OR += -= *= /=
+	ASSIGN
+	//OR ||
+	OR
+	//AND &&
+	AND
 	//EQUALS ==
 	EQUALS
-	//LESSGREATER > OR <
+	//LESSGREATER > OR < OR >= OR <=
 	LESSGREATER
+	//BITOR |
+	BITOR
+	//BITXOR ^
+	BITXOR
+	//BITAND &
+	BITAND
+	//SHIFT << OR >>
+	SHIFT
 	//SUM +
 	SUM
-	//PRODUCT *
+	//PRODUCT * OR / OR %
 	PRODUCT
-	//PREFIX -X OR !X
+	//PREFIX -X OR !X OR ~X
 	PREFIX
+	//POWER **, tighter than PREFIX so -2 ** 2 is -(2 ** 2)
+	POWER
 	//CALL myFunc(x)
 	CALL
 	//INDEX array[index]
 	INDEX
 )
 
+const (
+	//CodeUnexpectedToken the next token wasn't the one the grammar needs
+	CodeUnexpectedToken = "P0001"
+	//CodeNoPrefixParseFn the token can't start an expression
+	CodeNoPrefixParseFn = "P0002"
+	//CodeInvalidInteger the integer literal isn't a number, like 09 read
+	//as octal
+	CodeInvalidInteger = "P0003"
+	//CodeInvalidFloat the float literal is out of a float64's range
+	CodeInvalidFloat = "P0004"
+	//CodeInvalidAssignment the left of an assignment isn't a name or an
+	//index expression
+	CodeInvalidAssignment = "P0005"
+	//CodeMisplacedLoopControl a break or continue that isn't in a loop
+	CodeMisplacedLoopControl = "P0006"
+	//CodeUnknownLabel a break or continue names a loop it isn't in
+	CodeUnknownLabel = "P0007"
+	//CodeInvalidPattern something that can't be matched against, like
+	//an expression, where a pattern should be
+	CodeInvalidPattern = "P0008"
+)
+
+var closingHints = map[token.TokenType]string{
+	token.RPAREN:      "insert a closing \")\"",
+	token.RBRACE:      "insert a closing \"}\"",
+	token.RBRACKET:    "insert a closing \"]\"",
+	token.STRING_TAIL: "close the ${ with a \"}\"",
+}
+
+//statementStarts tokens that begin a statement, recovery stops in
+//front of them
+var statementStarts = map[token.TokenType]bool{
+	token.LET:      true,
+	token.RETURN:   true,
+	token.WHILE:    true,
+	token.FOR:      true,
+	token.MATCH:    true,
+	token.FUNCTION: true,
+	token.BREAK:    true,
+	token.CONTINUE: true,
+}
+
 type (
 	prefixParseFn func() ast.Expression
 	infixParseFn  func(ast.Expression) ast.Expression
@@ -48,19 +125,35 @@ type (
 
 //Parser Make me my AST
 type Parser struct {
-	lexer  *lexer.Lexer
-	errors []string
+	lexer       *lexer.Lexer
+	diagnostics []diagnostic.Diagnostic
+
+	// lexerDiagnostics how many of the lexer's diagnostics have been
+	// copied into diagnostics
+	lexerDiagnostics int
 
 	currentToken token.Token
 	peekedToken  token.Token
 
+	// Error recovery.  panicking is set by the first error in a statement
+	// and silences the rest until the parser has resynchronised.  depth
+	// counts open braces up to currentToken and blocks holds the depth
+	// of each block being parsed
+	panicking bool
+	depth     int
+	blocks    []int
+
+	// loops the labels of the loops being parsed in the current
+	// function, innermost last and "" for a loop without one
+	loops []string
+
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 }
 
 //New Get me a new Parser
 func New(l *lexer.Lexer) *Parser {
-	p := &Parser{lexer: l, errors: []string{}}
+	p := &Parser{lexer: l, diagnostics: []diagnostic.Diagnostic{}}
 
 	// Clever idea: Prime to parser so I don't need
 	// a "current" integer.  Works because lexer in this
@@ -71,17 +164,22 @@ func New(l *lexer.Lexer) *Parser {
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.TILDE, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.STRING_HEAD, p.parseInterpolatedString)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 	p.registerPrefix(token.WHILE, p.parseWhileExpression)
+	p.registerPrefix(token.FOR, p.parseForExpression)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -92,6 +190,22 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.POWER, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.AMPERSAND, p.parseInfixExpression)
+	p.registerInfix(token.PIPE, p.parseInfixExpression)
+	p.registerInfix(token.CARET, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_LEFT, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_RIGHT, p.parseInfixExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 
@@ -104,19 +218,33 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program.Statements = []ast.Statement{}
 
 	for !p.currentTokenIs(token.EOF) {
-		stmt := p.parseStatement()
-		if stmt != nil {
-			program.Statements = append(program.Statements, stmt)
+		statements, _ := p.parseStatementWithRecovery()
+		program.Statements = append(program.Statements, statements...)
+
+		// A stray } at the top level, forget about it
+		if p.depth < 0 {
+			p.depth = 0
 		}
+
 		p.nextToken()
 	}
 
 	return program
 }
 
-//Errors Get all errors
+//Errors Get all errors as file:line:col: messages
 func (p *Parser) Errors() []string {
-	return p.errors
+	errors := []string{}
+	for _, d := range p.diagnostics {
+		errors = append(errors, d.Error())
+	}
+
+	return errors
+}
+
+//Diagnostics Get all errors with their source ranges
+func (p *Parser) Diagnostics() []diagnostic.Diagnostic {
+	return p.diagnostics
 }
 
 func (p *Parser) currentTokenIs(t token.TokenType) bool {
@@ -143,22 +271,139 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 func (p *Parser) nextToken() {
 	p.currentToken = p.peekedToken
 	p.peekedToken = p.lexer.NextToken()
+
+	// Lexer errors are always reported, even while panicking
+	if lexed := p.lexer.Diagnostics(); len(lexed) > p.lexerDiagnostics {
+		p.diagnostics = append(p.diagnostics, lexed[p.lexerDiagnostics:]...)
+		p.lexerDiagnostics = len(lexed)
+	}
+
+	switch p.currentToken.Type {
+	case token.LBRACE:
+		p.depth++
+	case token.RBRACE:
+		p.depth--
+	}
+}
+
+func (p *Parser) blockDepth() int {
+	if len(p.blocks) == 0 {
+		return 0
+	}
+
+	return p.blocks[len(p.blocks)-1]
+}
+
+//parseStatementWithRecovery parses a statement and, if that went wrong,
+//skips ahead to where the next statement should begin.  A statement
+//that couldn't be built at all becomes an ast.BadStatement, as do any
+//tokens skipped after a partial one.  atBrace is true when recovery
+//ran into the } that closes the enclosing block
+func (p *Parser) parseStatementWithRecovery() (statements []ast.Statement, atBrace bool) {
+	start := p.currentToken
+	stmt := p.parseStatement()
+
+	if !p.panicking {
+		if stmt != nil {
+			statements = append(statements, stmt)
+		}
+
+		return statements, false
+	}
+
+	first, last, atBrace := p.synchronize()
+	p.panicking = false
+
+	if stmt == nil {
+		to := p.currentToken.End
+		if last.Type != "" {
+			to = last.End
+		}
+
+		return []ast.Statement{&ast.BadStatement{Token: start, To: to}}, atBrace
+	}
+
+	statements = append(statements, stmt)
+	if first.Type != "" {
+		statements = append(statements, &ast.BadStatement{Token: first, To: last.End})
+	}
+
+	return statements, atBrace
+}
+
+//synchronize skips tokens until the current one is a ; ending the
+//statement, the next one starts a statement or closes the block, or the
+//block's } has been passed.  Braces opened along the way are skipped
+//over whole.  Returns the first and last tokens it threw away
+func (p *Parser) synchronize() (first token.Token, last token.Token, atBrace bool) {
+	depth := p.blockDepth()
+
+	for {
+		switch {
+		case p.currentTokenIs(token.EOF):
+			return first, last, false
+		case p.depth < depth:
+			// The enclosing block's } is behind us already
+			return first, last, true
+		case p.currentTokenIs(token.SEMICOLON) && p.depth == depth:
+			return first, last, false
+		case p.depth == depth && (statementStarts[p.peekedToken.Type] || p.peekedTokenIs(token.RBRACE)):
+			return first, last, false
+		}
+
+		p.nextToken()
+
+		if p.currentTokenIs(token.EOF) || p.depth < depth {
+			continue
+		}
+
+		if first.Type == "" {
+			first = p.currentToken
+		}
+		last = p.currentToken
+	}
+}
+
+func (p *Parser) addError(code string, tok token.Token, msg string) *diagnostic.Diagnostic {
+	if p.panicking {
+		return &diagnostic.Diagnostic{}
+	}
+	p.panicking = true
+
+	p.diagnostics = append(p.diagnostics, diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     code,
+		Message:  msg,
+		Pos:      tok.Pos,
+		End:      tok.End,
+	})
+
+	return &p.diagnostics[len(p.diagnostics)-1]
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	d := p.addError(CodeNoPrefixParseFn, p.currentToken, msg)
+
+	if t == token.ILLEGAL {
+		d.Hint = fmt.Sprintf("%q isn't part of the language", p.currentToken.Literal)
+	}
 }
 
 func (p *Parser) peekError(t token.TokenType) {
 	msg := fmt.Sprintf("Expected next token to be %s, but was %s instead", t, p.peekedToken.Type)
-	p.errors = append(p.errors, msg)
+	d := p.addError(CodeUnexpectedToken, p.peekedToken, msg)
+	d.Expected = []token.TokenType{t}
+	d.Hint = closingHints[t]
 }
 
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.currentToken}
 
 	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if p.currentTokenIs(token.RBRACKET) {
+		array.Rbrack = p.currentToken.End
+	}
 
 	return array
 }
@@ -167,17 +412,26 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.currentToken}
 	block.Statements = []ast.Statement{}
 
+	p.blocks = append(p.blocks, p.depth)
+	defer func() { p.blocks = p.blocks[:len(p.blocks)-1] }()
+
 	p.nextToken()
 
 	for !p.currentTokenIs(token.RBRACE) && !p.currentTokenIs(token.EOF) {
-		stmt := p.parseStatement()
-		if stmt != nil {
-			block.Statements = append(block.Statements, stmt)
+		statements, atBrace := p.parseStatementWithRecovery()
+		block.Statements = append(block.Statements, statements...)
+
+		if atBrace {
+			break
 		}
 
 		p.nextToken()
 	}
 
+	if p.currentTokenIs(token.RBRACE) {
+		block.Rbrace = p.currentToken.End
+	}
+
 	return block
 }
 
@@ -188,6 +442,9 @@ func (p *Parser) parseBoolean() ast.Expression {
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	expression := &ast.CallExpression{Token: p.currentToken, Function: function}
 	expression.Arguments = p.parseExpressionList(token.RPAREN)
+	if p.currentTokenIs(token.RPAREN) {
+		expression.Rparen = p.currentToken.End
+	}
 
 	return expression
 }
@@ -251,7 +508,11 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
+	// A break in the body can't reach a loop the function is in
+	loops := p.loops
+	p.loops = nil
 	literal.Body = p.parseBlockStatement()
+	p.loops = loops
 
 	return literal
 }
@@ -310,6 +571,8 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		return nil
 	}
 
+	hash.Rbrace = p.currentToken.End
+
 	return hash
 }
 
@@ -324,6 +587,8 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 		return nil
 	}
 
+	expression.Rbrack = p.currentToken.End
+
 	return expression
 }
 
@@ -350,6 +615,21 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	if p.peekedTokenIs(token.ELSE) {
 		p.nextToken()
 
+		if p.peekedTokenIs(token.IF) {
+			p.nextToken()
+
+			alternative := &ast.BlockStatement{Token: p.currentToken}
+			nested := p.parseIfExpression()
+			if nested == nil {
+				return nil
+			}
+
+			alternative.Statements = []ast.Statement{&ast.ExpressionStatement{Token: alternative.Token, Expression: nested}}
+			expression.Alternative = alternative
+
+			return expression
+		}
+
 		if !p.expectPeek(token.LBRACE) {
 			return nil
 		}
@@ -360,14 +640,269 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
-func (p *Parser) parseLetStatement() *ast.LetStatement {
-	letStmt := &ast.LetStatement{Token: p.currentToken}
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{Token: p.currentToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	expression.Value = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekedTokenIs(token.RBRACE) {
+		p.nextToken()
+
+		arm := &ast.MatchArm{Pattern: p.parsePattern()}
+		if arm.Pattern == nil {
+			return nil
+		}
+
+		if p.peekedTokenIs(token.IF) {
+			p.nextToken()
+			p.nextToken()
+			arm.Guard = p.parseExpression(LOWEST)
+		}
+
+		if !p.expectPeek(token.FAT_ARROW) {
+			return nil
+		}
+
+		p.nextToken()
+		arm.Body = p.parseExpression(LOWEST)
+		expression.Arms = append(expression.Arms, arm)
+
+		if !p.peekedTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	expression.Rbrace = p.currentToken.End
+
+	return expression
+}
+
+//parsePattern the pattern starting at the current token, nil after
+//reporting why there isn't one
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.currentToken.Type {
+	case token.IDENT:
+		if p.currentToken.Literal == "_" {
+			return &ast.WildcardPattern{Token: p.currentToken}
+		}
+		return &ast.BindingPattern{Name: &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}}
+	case token.INT, token.FLOAT, token.STRING, token.TRUE, token.FALSE, token.MINUS:
+		return p.parseLiteralPattern()
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.LBRACE:
+		return p.parseHashPattern()
+	default:
+		msg := fmt.Sprintf("%s can't start a pattern", p.currentToken.Type)
+		d := p.addError(CodeInvalidPattern, p.currentToken, msg)
+		d.Hint = "a pattern is a literal, a name, _, [...] or {...}"
+		return nil
+	}
+}
+
+func (p *Parser) parseLiteralPattern() ast.Pattern {
+	start := p.currentToken
+
+	value := p.prefixParseFns[p.currentToken.Type]()
+	if value == nil {
+		return nil
+	}
+
+	if prefix, ok := value.(*ast.PrefixExpression); ok {
+		switch prefix.Right.(type) {
+		case *ast.IntegerLiteral, *ast.BigIntegerLiteral, *ast.FloatLiteral:
+		default:
+			d := p.addError(CodeInvalidPattern, start, "only a number can be negated in a pattern")
+			d.End = prefix.End()
+			return nil
+		}
+	}
+
+	return &ast.LiteralPattern{Value: value}
+}
+
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	pattern := &ast.ArrayPattern{Token: p.currentToken}
+
+	for !p.peekedTokenIs(token.RBRACKET) {
+		p.nextToken()
+
+		if n := len(pattern.Elements); n > 0 {
+			if rest, ok := pattern.Elements[n-1].(*ast.RestPattern); ok {
+				d := p.addError(CodeInvalidPattern, rest.Token, "a rest element has to be the last in an array pattern")
+				d.End = rest.End()
+				return nil
+			}
+		}
+
+		var element ast.Pattern
+		if p.currentTokenIs(token.ELLIPSIS) {
+			element = p.parseRestPattern()
+		} else {
+			element = p.parseDefaultPattern(p.parsePattern())
+		}
+		if element == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, element)
+
+		if !p.peekedTokenIs(token.RBRACKET) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	pattern.Rbrack = p.currentToken.End
+
+	return pattern
+}
+
+//parseHashPattern a key is a literal or a name, which stands for the
+//string of the name.  A name on its own also binds it
+func (p *Parser) parseHashPattern() ast.Pattern {
+	pattern := &ast.HashPattern{Token: p.currentToken}
+
+	for !p.peekedTokenIs(token.RBRACE) {
+		p.nextToken()
+
+		var pair ast.HashPatternPair
+		switch p.currentToken.Type {
+		case token.IDENT:
+			pair.Key = &ast.StringLiteral{Token: p.currentToken, Value: p.currentToken.Literal}
+			if !p.peekedTokenIs(token.COLON) {
+				pair.Value = p.parsePattern()
+			}
+		case token.STRING, token.INT, token.TRUE, token.FALSE:
+			pair.Key = p.prefixParseFns[p.currentToken.Type]()
+			if pair.Key == nil {
+				return nil
+			}
+		default:
+			msg := fmt.Sprintf("%s can't be a key in a hash pattern", p.currentToken.Type)
+			p.addError(CodeInvalidPattern, p.currentToken, msg)
+			return nil
+		}
+
+		if pair.Value == nil {
+			if !p.expectPeek(token.COLON) {
+				return nil
+			}
+
+			p.nextToken()
+			pair.Value = p.parsePattern()
+		}
+
+		pair.Value = p.parseDefaultPattern(pair.Value)
+		if pair.Value == nil {
+			return nil
+		}
+		pattern.Pairs = append(pattern.Pairs, pair)
+
+		if !p.peekedTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	pattern.Rbrace = p.currentToken.End
+
+	return pattern
+}
+
+//parseRestPattern ...name or ..._
+func (p *Parser) parseRestPattern() ast.Pattern {
+	rest := &ast.RestPattern{Token: p.currentToken}
 
 	if !p.expectPeek(token.IDENT) {
 		return nil
 	}
 
-	letStmt.Name = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	rest.Pattern = p.parsePattern()
+
+	return rest
+}
+
+//parseDefaultPattern pattern = <expression> if there's a default after
+//pattern, otherwise just pattern
+func (p *Parser) parseDefaultPattern(pattern ast.Pattern) ast.Pattern {
+	if pattern == nil || !p.peekedTokenIs(token.ASSIGN) {
+		return pattern
+	}
+
+	p.nextToken()
+	p.nextToken()
+
+	return &ast.DefaultPattern{Pattern: pattern, Default: p.parseExpression(LOWEST)}
+}
+
+//checkLetPattern a let can't fall back on another arm the way a match
+//can, so its pattern can't test the value against literals
+func (p *Parser) checkLetPattern(pattern ast.Pattern) bool {
+	switch pattern := pattern.(type) {
+	case *ast.LiteralPattern:
+		d := p.addError(CodeInvalidPattern, p.currentToken, "a let pattern can't have a literal in it")
+		d.Pos, d.End = pattern.Pos(), pattern.End()
+		d.Hint = "use match to test a value against a literal"
+		return false
+	case *ast.DefaultPattern:
+		return p.checkLetPattern(pattern.Pattern)
+	case *ast.ArrayPattern:
+		for _, element := range pattern.Elements {
+			if !p.checkLetPattern(element) {
+				return false
+			}
+		}
+	case *ast.HashPattern:
+		for _, pair := range pattern.Pairs {
+			if !p.checkLetPattern(pair.Value) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (p *Parser) parseLetStatement() *ast.LetStatement {
+	letStmt := &ast.LetStatement{Token: p.currentToken}
+
+	if p.peekedTokenIs(token.LBRACKET) || p.peekedTokenIs(token.LBRACE) {
+		p.nextToken()
+
+		letStmt.Pattern = p.parsePattern()
+		if letStmt.Pattern == nil || !p.checkLetPattern(letStmt.Pattern) {
+			return nil
+		}
+	} else {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		letStmt.Name = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	}
 
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
@@ -385,14 +920,18 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
+	start := p.currentToken
 	prefix := p.prefixParseFns[p.currentToken.Type]
 
 	if prefix == nil {
 		p.noPrefixParseFnError(p.currentToken.Type)
-		return nil
+		return &ast.BadExpression{Token: start, To: start.End}
 	}
 
 	leftExpression := prefix()
+	if leftExpression == nil {
+		return &ast.BadExpression{Token: start, To: p.currentToken.End}
+	}
 
 	for !p.peekedTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekedToken.Type]
@@ -403,6 +942,9 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 		p.nextToken()
 
 		leftExpression = infix(leftExpression)
+		if leftExpression == nil {
+			return &ast.BadExpression{Token: start, To: p.currentToken.End}
+		}
 	}
 
 	return leftExpression
@@ -443,19 +985,66 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	}
 
 	precedence := p.currentPrecedence()
+	if expression.Operator == token.POWER {
+		// Right associative, 2 ** 3 ** 2 is 2 ** (3 ** 2)
+		precedence--
+	}
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
 
 	return expression
 }
 
+//parseAssignExpression name = value or a[i] = value, or one of the
+//compound forms.  Right associative, a = b = 1 assigns 1 to both
+func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
+	tok := p.currentToken
+
+	p.nextToken()
+	value := p.parseExpression(ASSIGN - 1)
+
+	switch target := left.(type) {
+	case *ast.Identifier:
+		return &ast.AssignExpression{Token: tok, Name: target, Operator: tok.Literal, Value: value}
+	case *ast.IndexExpression:
+		return &ast.IndexAssignExpression{Token: tok, Target: target, Operator: tok.Literal, Value: value}
+	default:
+		msg := fmt.Sprintf("cannot assign to %s", left.String())
+		d := p.addError(CodeInvalidAssignment, token.Token{Pos: left.Pos(), End: left.End()}, msg)
+		d.Hint = "only a variable or an index expression like a[i] can be assigned to"
+		return nil
+	}
+}
+
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.currentToken}
 
 	value, err := strconv.ParseInt(p.currentToken.Literal, 0, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		if large, ok := new(big.Int).SetString(p.currentToken.Literal, 0); ok {
+			return &ast.BigIntegerLiteral{Token: p.currentToken, Value: large}
+		}
+	}
 	if err != nil {
-		msg := fmt.Sprintf("coundn't parse %q as an integer", p.currentToken.Literal)
-		p.errors = append(p.errors, msg)
+		msg := fmt.Sprintf("couldn't parse %q as an integer", p.currentToken.Literal)
+		d := p.addError(CodeInvalidInteger, p.currentToken, msg)
+		d.Hint = "a leading 0 makes an integer octal, so only the digits 0 to 7 can follow it"
+		return nil
+	}
+
+	lit.Value = value
+
+	return lit
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.currentToken}
+
+	value, err := strconv.ParseFloat(p.currentToken.Literal, 64)
+	if err != nil {
+		msg := fmt.Sprintf("couldn't parse %q as a float", p.currentToken.Literal)
+		d := p.addError(CodeInvalidFloat, p.currentToken, msg)
+		d.Hint = "floats must be within the range of 64 bit floating point"
 		return nil
 	}
 
@@ -494,24 +1083,141 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.currentToken.Type {
 	case token.LET:
-		return p.parseLetStatement()
+		// Careful not to hand back a nil *ast.LetStatement wrapped
+		// in a non-nil ast.Statement
+		if stmt := p.parseLetStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.BREAK:
+		stmt := &ast.BreakStatement{Token: p.currentToken}
+		stmt.Label = p.parseLoopControl()
+		return stmt
+	case token.CONTINUE:
+		stmt := &ast.ContinueStatement{Token: p.currentToken}
+		stmt.Label = p.parseLoopControl()
+		return stmt
+	case token.IDENT:
+		if p.peekedTokenIs(token.COLON) {
+			return p.parseLabelledStatement()
+		}
+		return p.parseExpressionStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
+//parseLoopControl the label after a break or continue, if there is one,
+//checking there's a loop for it to break out of or continue
+func (p *Parser) parseLoopControl() *ast.Identifier {
+	keyword := p.currentToken
+
+	var label *ast.Identifier
+	if p.peekedTokenIs(token.IDENT) {
+		p.nextToken()
+		label = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	}
+
+	switch {
+	case len(p.loops) == 0:
+		msg := fmt.Sprintf("%s outside a loop", keyword.Literal)
+		p.addError(CodeMisplacedLoopControl, keyword, msg)
+	case label != nil && !p.inLoop(label.Value):
+		msg := fmt.Sprintf("%s to %s, which isn't a loop it's in", keyword.Literal, label.Value)
+		d := p.addError(CodeUnknownLabel, label.Token, msg)
+		d.Hint = "label the loop as " + label.Value + ": while (...) { ... }"
+	}
+
+	if p.peekedTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return label
+}
+
+func (p *Parser) inLoop(label string) bool {
+	for _, l := range p.loops {
+		if l == label {
+			return true
+		}
+	}
+
+	return false
+}
+
+//parseLabelledStatement label: while ... or label: for ...
+func (p *Parser) parseLabelledStatement() ast.Statement {
+	stmt := &ast.ExpressionStatement{Token: p.currentToken}
+	label := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+
+	p.nextToken()
+	if p.peekedTokenIs(token.FOR) {
+		p.nextToken()
+		if loop := p.parseFor(label); loop != nil {
+			stmt.Expression = loop
+		}
+	} else if p.expectPeek(token.WHILE) {
+		if loop := p.parseWhile(label); loop != nil {
+			stmt.Expression = loop
+		}
+	}
+
+	if stmt.Expression == nil {
+		return nil
+	}
+
+	if p.peekedTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.currentToken, Value: p.currentToken.Literal}
 }
 
+//parseInterpolatedString the STRING_HEAD, each embedded expression
+//followed by the STRING_MIDDLE or STRING_TAIL after it
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	str := &ast.InterpolatedString{Token: p.currentToken}
+	str.Parts = []ast.Expression{p.parseStringLiteral()}
+
+	for !p.currentTokenIs(token.STRING_TAIL) {
+		p.nextToken()
+		str.Parts = append(str.Parts, p.parseExpression(LOWEST))
+
+		if p.peekedTokenIs(token.STRING_MIDDLE) {
+			p.nextToken()
+		} else if !p.expectPeek(token.STRING_TAIL) {
+			return nil
+		}
+
+		str.Parts = append(str.Parts, p.parseStringLiteral())
+	}
+
+	str.Close = p.currentToken.End
+
+	return str
+}
+
 func (p *Parser) peekedTokenIs(t token.TokenType) bool {
 	return p.peekedToken.Type == t
 }
 
 func (p *Parser) parseWhileExpression() ast.Expression {
-	expression := &ast.WhileExpression{Token: p.currentToken}
+	// Careful not to hand back a nil *ast.WhileExpression wrapped in a
+	// non-nil ast.Expression
+	if loop := p.parseWhile(nil); loop != nil {
+		return loop
+	}
+	return nil
+}
+
+func (p *Parser) parseWhile(label *ast.Identifier) *ast.WhileExpression {
+	expression := &ast.WhileExpression{Token: p.currentToken, Label: label}
 
 	if !p.expectPeek(token.LPAREN) {
 		return nil
@@ -528,11 +1234,76 @@ func (p *Parser) parseWhileExpression() ast.Expression {
 		return nil
 	}
 
-	expression.Body = p.parseBlockStatement()
+	expression.Body = p.parseLoopBody(label)
 
 	return expression
 }
 
+func (p *Parser) parseForExpression() ast.Expression {
+	// Careful not to hand back a nil *ast.ForExpression wrapped in a
+	// non-nil ast.Expression
+	if loop := p.parseFor(nil); loop != nil {
+		return loop
+	}
+	return nil
+}
+
+func (p *Parser) parseFor(label *ast.Identifier) *ast.ForExpression {
+	expression := &ast.ForExpression{Token: p.currentToken, Label: label}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	expression.Value = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+
+	if p.peekedTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		expression.Key = expression.Value
+		expression.Value = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	expression.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Body = p.parseLoopBody(label)
+
+	return expression
+}
+
+//parseLoopBody the block of a loop, inside which break and continue
+//are allowed
+func (p *Parser) parseLoopBody(label *ast.Identifier) *ast.BlockStatement {
+	name := ""
+	if label != nil {
+		name = label.Value
+	}
+
+	p.loops = append(p.loops, name)
+	defer func() { p.loops = p.loops[:len(p.loops)-1] }()
+
+	return p.parseBlockStatement()
+}
+
 func (p *Parser) peekPrecedence() int {
 	if p, ok := precedences[p.peekedToken.Type]; ok {
 		return p
@@ -2,7 +2,9 @@ package parser
 
 import (
 	"monkey/ast"
+	"monkey/diagnostic"
 	"monkey/lexer"
+	"monkey/token"
 	"fmt"
 	"testing"
 )
@@ -112,6 +114,117 @@ func TestWhileExpressionParsing(t *testing.T) {
 
 }
 
+func TestLoopControlParsing(t *testing.T) {
+	input := `outer: while (x) { while (y) { break outer; continue } }`
+	program := parseProgram(input, t)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not have 1 statement but %d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement but %T", program.Statements[0])
+	}
+
+	outer, ok := stmt.Expression.(*ast.WhileExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.WhileExpression but %T", stmt.Expression)
+	}
+
+	if outer.Label == nil || outer.Label.Value != "outer" {
+		t.Fatalf("outer loop label wrong. got=%v", outer.Label)
+	}
+
+	inner, ok := outer.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.WhileExpression)
+	if !ok {
+		t.Fatalf("outer body is not a while loop but %T", outer.Body.Statements[0])
+	}
+
+	if inner.Label != nil {
+		t.Errorf("inner loop should have no label. got=%v", inner.Label)
+	}
+
+	if len(inner.Body.Statements) != 2 {
+		t.Fatalf("inner body is not 2 statements but %d", len(inner.Body.Statements))
+	}
+
+	brk, ok := inner.Body.Statements[0].(*ast.BreakStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.BreakStatement but %T", inner.Body.Statements[0])
+	}
+
+	if brk.Label == nil || brk.Label.Value != "outer" {
+		t.Errorf("break label wrong. got=%v", brk.Label)
+	}
+
+	cont, ok := inner.Body.Statements[1].(*ast.ContinueStatement)
+	if !ok {
+		t.Fatalf("Statements[1] is not ast.ContinueStatement but %T", inner.Body.Statements[1])
+	}
+
+	if cont.Label != nil {
+		t.Errorf("continue should have no label. got=%v", cont.Label)
+	}
+
+	if program.String() != "outer: while (x ){ while (y ){ break outer;continue; } }" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
+func TestForExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		label    string
+		key      string
+		value    string
+		iterable string
+		output   string
+	}{
+		{"for (x in xs) { x }", "", "", "x", "xs", "for (x in xs) { x }"},
+		{"for (k, v in range(3)) { k + v; }", "", "k", "v", "range(3)", "for (k, v in range(3)) { (k + v) }"},
+		{"rows: for (row in grid) { break rows }", "rows", "", "row", "grid", "rows: for (row in grid) { break rows; }"},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(tt.input, t)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: program.Statements does not have 1 statement but %d", tt.input, len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("%q: program.Statements[0] is not ast.ExpressionStatement but %T", tt.input, program.Statements[0])
+		}
+
+		loop, ok := stmt.Expression.(*ast.ForExpression)
+		if !ok {
+			t.Fatalf("%q: stmt.Expression is not ast.ForExpression but %T", tt.input, stmt.Expression)
+		}
+
+		if (loop.Label == nil) != (tt.label == "") || (loop.Label != nil && loop.Label.Value != tt.label) {
+			t.Errorf("%q: label wrong. got=%v", tt.input, loop.Label)
+		}
+
+		if (loop.Key == nil) != (tt.key == "") || (loop.Key != nil && loop.Key.Value != tt.key) {
+			t.Errorf("%q: key wrong. got=%v", tt.input, loop.Key)
+		}
+
+		if loop.Value.Value != tt.value {
+			t.Errorf("%q: value wrong. got=%s", tt.input, loop.Value.Value)
+		}
+
+		if loop.Iterable.String() != tt.iterable {
+			t.Errorf("%q: iterable wrong. got=%s", tt.input, loop.Iterable.String())
+		}
+
+		if program.String() != tt.output {
+			t.Errorf("%q: program.String() wrong. got=%q", tt.input, program.String())
+		}
+	}
+}
+
 func TestParsingEmptyHashLiteralString(t *testing.T) {
 	input := "{}"
 	program := parseProgram(input, t)
@@ -185,7 +298,7 @@ func TestIdentifierExpression(t *testing.T) {
 		t.Fatalf("expected value 'foobar' but got %s", ident.Value)
 	}
 	if ident.TokenLiteral() != "foobar" {
-		t.Errorf("expected TokenLiteral 'foobar' but got %d", ident.TokenLiteral())
+		t.Errorf("expected TokenLiteral 'foobar' but got %s", ident.TokenLiteral())
 	}
 }
 
@@ -379,6 +492,139 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
+func TestElseIfExpression(t *testing.T) {
+	input := `if (x < y) { x } else if (x > y) { y } else { 0 }`
+	program := parseProgram(input, t)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement but %T", program.Statements[0])
+	}
+
+	expression, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression but %T", stmt.Expression)
+	}
+
+	if len(expression.Alternative.Statements) != 1 {
+		t.Fatalf("alternative is not 1 statement but %d", len(expression.Alternative.Statements))
+	}
+
+	nested, ok := expression.Alternative.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("alternative is not an if expression but %T", expression.Alternative.Statements[0])
+	}
+
+	if !testInfixExpression(t, nested.Condition, "x", ">", "y") {
+		return
+	}
+
+	if nested.Alternative == nil || len(nested.Alternative.Statements) != 1 {
+		t.Errorf("the else if should have the final else as its alternative")
+	}
+
+	if expression.End().Offset != len(input) {
+		t.Errorf("if should end at %d but ends at %d", len(input), expression.End().Offset)
+	}
+}
+
+func TestMatchExpressionParsing(t *testing.T) {
+	input := `match (v) { 0 => "zero", -1.5 => "neg", [a, _, [b]] if a > b => a, {"k": k, name, 2: true} => k, n => n }`
+	program := parseProgram(input, t)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement but %T", program.Statements[0])
+	}
+
+	match, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MatchExpression but %T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, match.Value, "v") {
+		return
+	}
+
+	expected := []struct {
+		pattern string
+		kind    ast.Pattern
+		guard   string
+	}{
+		{"0", &ast.LiteralPattern{}, ""},
+		{"(-1.5)", &ast.LiteralPattern{}, ""},
+		{"[a, _, [b]]", &ast.ArrayPattern{}, "(a > b)"},
+		{"{k:k, name:name, 2:true}", &ast.HashPattern{}, ""},
+		{"n", &ast.BindingPattern{}, ""},
+	}
+
+	if len(match.Arms) != len(expected) {
+		t.Fatalf("match has %d arms, wanted %d", len(match.Arms), len(expected))
+	}
+
+	for i, tt := range expected {
+		arm := match.Arms[i]
+
+		if fmt.Sprintf("%T", arm.Pattern) != fmt.Sprintf("%T", tt.kind) {
+			t.Errorf("arm %d: pattern is %T, wanted %T", i, arm.Pattern, tt.kind)
+		}
+
+		if arm.Pattern.String() != tt.pattern {
+			t.Errorf("arm %d: pattern is %q, wanted %q", i, arm.Pattern.String(), tt.pattern)
+		}
+
+		guard := ""
+		if arm.Guard != nil {
+			guard = arm.Guard.String()
+		}
+		if guard != tt.guard {
+			t.Errorf("arm %d: guard is %q, wanted %q", i, guard, tt.guard)
+		}
+	}
+
+	if _, ok := match.Arms[2].Pattern.(*ast.ArrayPattern).Elements[1].(*ast.WildcardPattern); !ok {
+		t.Errorf("_ should be a wildcard")
+	}
+
+	if match.End().Offset != len(input) {
+		t.Errorf("match should end at %d but ends at %d", len(input), match.End().Offset)
+	}
+}
+
+func TestDestructuringLetParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b, ...rest] = f();", "let [a, b, ...rest] = f();"},
+		{"let {name, age: years} = person;", "let {name:name, age:years} = person;"},
+		{"let [a, [b, _], {c: [d]}] = x;", "let [a, [b, _], {c:[d]}] = x;"},
+		{"let [a = 1, b = a + 1, ..._] = x;", "let [a = 1, b = (a + 1), ..._] = x;"},
+		{"let {a = [], \"b\": {c} = {}} = x;", "let {a:a = [], b:{c:c} = {}} = x;"},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(tt.input, t)
+
+		stmt, ok := program.Statements[0].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("%s: program.Statements[0] is not ast.LetStatement but %T", tt.input, program.Statements[0])
+		}
+
+		if stmt.Name != nil || stmt.Pattern == nil {
+			t.Errorf("%s: should have a pattern instead of a name", tt.input)
+		}
+
+		if stmt.String() != tt.expected {
+			t.Errorf("%s: got %q, wanted %q", tt.input, stmt.String(), tt.expected)
+		}
+
+		if stmt.End().Offset != len(tt.input)-1 {
+			t.Errorf("%s: should end at %d but ends at %d", tt.input, len(tt.input)-1, stmt.End().Offset)
+		}
+	}
+}
+
 func TestIntegerLiteralExpression(t *testing.T) {
 	input := "5;"
 
@@ -411,6 +657,58 @@ func TestIntegerLiteralExpression(t *testing.T) {
 
 }
 
+func TestBigIntegerLiteralExpression(t *testing.T) {
+	input := "9223372036854775808;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserError(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. was %T", program.Statements[0])
+	}
+
+	literal, ok := stmt.Expression.(*ast.BigIntegerLiteral)
+	if !ok {
+		t.Fatalf("expression not *ast.BigIntegerLiteral. was %T", stmt.Expression)
+	}
+	if literal.Value.String() != "9223372036854775808" {
+		t.Errorf("literal.Value was not 9223372036854775808, but %s", literal.Value)
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{"1e-9", 1e-9},
+		{"2.5E3", 2500},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserError(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program has unexpected number of statements. was %d", len(program.Statements))
+		}
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("expression not *ast.FloatLiteral. was %T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value was not %g, but %g", tt.expected, literal.Value)
+		}
+	}
+}
+
 func TestLetStatement(t *testing.T) {
 	tests := []struct {
 		input              string
@@ -480,6 +778,62 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"3 < 5 == true",
 			"((3 < 5) == true)",
 		},
+		{
+			"a <= b == b >= c",
+			"((a <= b) == (b >= c))",
+		},
+		{
+			"a || b && c == d",
+			"(a || (b && (c == d)))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"a | b ^ c & d == e",
+			"((a | (b ^ (c & d))) == e)",
+		},
+		{
+			"a << 1 + b & c",
+			"((a << (1 + b)) & c)",
+		},
+		{
+			"a * b % c",
+			"((a * b) % c)",
+		},
+		{
+			"2 ** 3 ** 2",
+			"(2 ** (3 ** 2))",
+		},
+		{
+			"-2 ** 2",
+			"(-(2 ** 2))",
+		},
+		{
+			"a * b ** -c",
+			"(a * (b ** (-c)))",
+		},
+		{
+			"~a & b",
+			"((~a) & b)",
+		},
+		{
+			"a /* b */ + // c\n d",
+			"(a + d)",
+		},
+		{
+			"x = y = 1 + 2",
+			"(x = (y = (1 + 2)))",
+		},
+		{
+			"a[i + 1] += b || c",
+			"((a[(i + 1)]) += (b || c))",
+		},
+		{
+			"x *= -y",
+			"(x *= (-y))",
+		},
 		{
 			"-a * b",
 			"((-a) * b)",
@@ -783,6 +1137,218 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestInterpolatedString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		parts    int
+	}{
+		{`"total: ${a + b}"`, `"total: ${(a + b)}"`, 3},
+		{`"${x}${y}"`, `"${x}${y}"`, 5},
+		{`"call ${f("inner", {"k": 1}["k"])} done"`, `"call ${f(inner, ({k:1}[k]))} done"`, 3},
+		{`"outer ${"inner ${x}"}"`, `"outer ${"inner ${x}"}"`, 3},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserError(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		str, ok := stmt.Expression.(*ast.InterpolatedString)
+		if !ok {
+			t.Fatalf("wasn't a *ast.InterpolatedString but %T", stmt.Expression)
+		}
+
+		if len(str.Parts) != tt.parts {
+			t.Errorf("%s has %d parts, wanted %d", tt.input, len(str.Parts), tt.parts)
+		}
+
+		if str.String() != tt.expected {
+			t.Errorf("wanted %s but got %s", tt.expected, str.String())
+		}
+
+		if str.End().Offset != len(tt.input) {
+			t.Errorf("%s ends at %d, wanted %d", tt.input, str.End().Offset, len(tt.input))
+		}
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	input := `let add = fn(x, y) {
+	x + y;
+};
+add(1, [2, 3][0]);`
+
+	program := parseProgram(input, t)
+
+	tests := []struct {
+		node     ast.Node
+		startPos string
+		endPos   string
+	}{
+		{program, "1:1", "4:18"},
+		{program.Statements[0], "1:1", "3:2"},
+		{program.Statements[0].(*ast.LetStatement).Value, "1:11", "3:2"},
+		{program.Statements[1], "4:1", "4:18"},
+		{program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.CallExpression).Arguments[1], "4:8", "4:17"},
+	}
+
+	for i, tt := range tests {
+		if tt.node.Pos().String() != tt.startPos {
+			t.Errorf("tests[%d] - %q starts at %s, wanted %s", i, tt.node.String(), tt.node.Pos(), tt.startPos)
+		}
+
+		if tt.node.End().String() != tt.endPos {
+			t.Errorf("tests[%d] - %q ends at %s, wanted %s", i, tt.node.String(), tt.node.End(), tt.endPos)
+		}
+	}
+}
+
+func TestParserDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		code     string
+		position string
+		expected []token.TokenType
+	}{
+		{"let x = (5;", CodeUnexpectedToken, "1:11", []token.TokenType{token.RPAREN}},
+		{"let = 5;", CodeUnexpectedToken, "1:5", []token.TokenType{token.IDENT}},
+		{"1 + );", CodeNoPrefixParseFn, "1:5", nil},
+		{"09", CodeInvalidInteger, "1:1", nil},
+		{"1 + 1e999", CodeInvalidFloat, "1:5", nil},
+		{"let x = 5; /* never closed", lexer.CodeUnterminatedComment, "1:12", nil},
+		{"1 + x = 2;", CodeInvalidAssignment, "1:1", nil},
+		{"f() += 1;", CodeInvalidAssignment, "1:1", nil},
+		{"let s = \"open;", lexer.CodeUnterminatedString, "1:9", nil},
+		{"let s = `open;", lexer.CodeUnterminatedString, "1:9", nil},
+		{`let s = "a\qb";`, lexer.CodeInvalidEscape, "1:11", nil},
+		{`let s = "\u{110000}";`, lexer.CodeInvalidEscape, "1:10", nil},
+		{`let s = "a ${x y}";`, CodeUnexpectedToken, "1:16", []token.TokenType{token.STRING_TAIL}},
+		{`let s = "a ${x`, lexer.CodeUnterminatedString, "1:9", nil},
+		{"break;", CodeMisplacedLoopControl, "1:1", nil},
+		{"while (x) { fn() { continue } }", CodeMisplacedLoopControl, "1:20", nil},
+		{"a: while (x) { break b }", CodeUnknownLabel, "1:22", nil},
+		{"a: while (x) { fn() { while (y) { continue a } } }", CodeUnknownLabel, "1:44", nil},
+		{"for (x y) { x }", CodeUnexpectedToken, "1:8", []token.TokenType{token.IN}},
+		{"for (1 in y) { 1 }", CodeUnexpectedToken, "1:6", []token.TokenType{token.IDENT}},
+		{"a: let x = 1;", CodeUnexpectedToken, "1:4", []token.TokenType{token.WHILE}},
+		{"match (x) { 1 + 2 => 3 }", CodeUnexpectedToken, "1:15", []token.TokenType{token.FAT_ARROW}},
+		{"match (x) { (a) => 1 }", CodeInvalidPattern, "1:13", nil},
+		{"match (x) { -y => 1 }", CodeInvalidPattern, "1:13", nil},
+		{"match (x) { {1.5: a} => 1 }", CodeInvalidPattern, "1:14", nil},
+		{"match (x) { {a, b: } => 1 }", CodeInvalidPattern, "1:20", nil},
+		{"match (x) { 1 => 2 3 => 4 }", CodeUnexpectedToken, "1:20", []token.TokenType{token.COMMA}},
+		{"match (x) { {...a} => 1 }", CodeInvalidPattern, "1:14", nil},
+		{"let [1, a] = x;", CodeInvalidPattern, "1:6", nil},
+		{"let {a: [b, -2]} = x;", CodeInvalidPattern, "1:13", nil},
+		{"let [...a, b] = x;", CodeInvalidPattern, "1:6", nil},
+		{"let [...[a]] = x;", CodeUnexpectedToken, "1:9", []token.TokenType{token.IDENT}},
+		{"if (x) { 1 } else if { 2 }", CodeUnexpectedToken, "1:22", []token.TokenType{token.LPAREN}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		diagnostics := p.Diagnostics()
+		if len(diagnostics) == 0 {
+			t.Errorf("%q should have failed to parse", tt.input)
+			continue
+		}
+
+		d := diagnostics[0]
+		if d.Severity != diagnostic.Error {
+			t.Errorf("%q: severity was %s", tt.input, d.Severity)
+		}
+
+		if d.Code != tt.code {
+			t.Errorf("%q: code was %s but wanted %s", tt.input, d.Code, tt.code)
+		}
+
+		if d.Pos.String() != tt.position {
+			t.Errorf("%q: error at %s but wanted %s", tt.input, d.Pos, tt.position)
+		}
+
+		if len(d.Expected) != len(tt.expected) {
+			t.Errorf("%q: expected %v but wanted %v", tt.input, d.Expected, tt.expected)
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	input := `
+let = 5;
+let y = (1;
+let ok = 1;
+let f = fn(x) {
+	let z = x +;
+	z
+};
+let last = 3;`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+
+	diagnostics := p.Diagnostics()
+	if len(diagnostics) != 3 {
+		for _, d := range diagnostics {
+			t.Errorf("Parser error: %s", d)
+		}
+		t.Fatalf("wanted 3 errors but got %d", len(diagnostics))
+	}
+
+	expectedLines := []int{2, 3, 6}
+	for i, line := range expectedLines {
+		if diagnostics[i].Pos.Line != line {
+			t.Errorf("error %d on line %d, wanted %d", i, diagnostics[i].Pos.Line, line)
+		}
+	}
+
+	if len(program.Statements) != 5 {
+		t.Fatalf("wanted 5 statements but got %d: %s", len(program.Statements), program)
+	}
+
+	if _, ok := program.Statements[0].(*ast.BadStatement); !ok {
+		t.Errorf("program.Statements[0] should be *ast.BadStatement but was %T", program.Statements[0])
+	}
+
+	let, ok := program.Statements[1].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[1] should be *ast.LetStatement but was %T", program.Statements[1])
+	}
+
+	if _, ok := let.Value.(*ast.BadExpression); !ok {
+		t.Errorf("let y value should be *ast.BadExpression but was %T", let.Value)
+	}
+
+	testLetStatement(t, program.Statements[2], "ok")
+	testLetStatement(t, program.Statements[3], "f")
+	testLetStatement(t, program.Statements[4], "last")
+
+	fn := program.Statements[3].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if len(fn.Body.Statements) != 2 {
+		t.Errorf("function body should have kept 2 statements but has %d", len(fn.Body.Statements))
+	}
+}
+
+func TestErrorRecoveryStopsAtEnclosingBrace(t *testing.T) {
+	input := `let f = fn() { 1 + }; let g = 2;`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+
+	if len(p.Diagnostics()) != 1 {
+		t.Fatalf("wanted 1 error but got %v", p.Errors())
+	}
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("wanted 2 statements but got %d: %s", len(program.Statements), program)
+	}
+
+	testLetStatement(t, program.Statements[1], "g")
+}
+
 func checkParserError(t *testing.T, p *Parser) {
 	errors := p.Errors()
 	errorCount := len(errors)
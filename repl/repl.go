@@ -4,28 +4,59 @@ package repl
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"monkey/executor"
 	"monkey/object"
+	"os"
+	"os/signal"
+	"strings"
 )
 
 const prompt = ">>"
 
 //Start It begins here
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+	StartEngine(in, out, executor.NewTreeWalker(object.NewEnvironment()))
+}
+
+//StartEngine REPL that runs each line on engine.  Ctrl-C while a line
+//is running interrupts it and goes back to the prompt.  gets reads the
+//lines after the one being run from in
+func StartEngine(in io.Reader, out io.Writer, engine executor.Engine) {
+	reader := bufio.NewReader(in)
+	engine.ExecutionContext().Stdin = reader
 
 	for {
-		fmt.Printf(prompt)
-		scanned := scanner.Scan()
+		fmt.Fprint(out, prompt)
+		line, err := reader.ReadString('\n')
 
-		if !scanned {
-			return
+		if line = strings.TrimRight(line, "\r\n"); line != "" || err == nil {
+			runInterruptibly(engine, line, out)
 		}
 
-		line := scanner.Text()
-		executor.Execute([]string{line}, env, out)
+		if err != nil {
+			return
+		}
 	}
 }
+
+func runInterruptibly(engine executor.Engine, line string, out io.Writer) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	go func() {
+		select {
+		case <-interrupts:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	executor.RunContext(ctx, engine, []executor.Source{{Text: line}}, out)
+}
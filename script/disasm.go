@@ -0,0 +1,45 @@
+package script
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"monkey/compiler"
+	"monkey/diagnostic"
+	"monkey/disasm"
+	"monkey/lexer"
+	"monkey/parser"
+)
+
+//Disassemble compiles each file and prints the bytecode it turns into
+func Disassemble(output io.Writer, files []string) error {
+	for i, file := range files {
+		srcBytes, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		src := string(srcBytes)
+
+		p := parser.New(lexer.NewFile(file, src))
+		program := p.ParseProgram()
+
+		if len(p.Diagnostics()) != 0 {
+			diagnostic.RenderAll(output, src, p.Diagnostics())
+			return fmt.Errorf("%s has parser errors", file)
+		}
+
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			return fmt.Errorf("%s: %s", file, err)
+		}
+
+		if i > 0 {
+			io.WriteString(output, "\n")
+		}
+		fmt.Fprintf(output, "; %s\n", file)
+
+		disasm.Disassemble(comp.Bytecode()).Write(output, src)
+	}
+
+	return nil
+}
@@ -10,15 +10,29 @@ import (
 
 //Run runs all the files
 func Run(output io.Writer, files []string) {
-	env := object.NewEnvironment()
-	sources := []string{}
+	RunEngine(executor.NewTreeWalker(object.NewEnvironment()), output, files)
+}
+
+//RunEngine runs all the files on engine
+func RunEngine(engine executor.Engine, output io.Writer, files []string) {
+	executor.Run(engine, readSources(output, files), output)
+}
+
+//RunCached runs all the files on the bytecode engine, reusing the .mkc
+//file compiled from each one when the file hasn't changed
+func RunCached(engine *executor.VM, output io.Writer, files []string) {
+	executor.RunCached(engine, readSources(output, files), output)
+}
+
+func readSources(output io.Writer, files []string) []executor.Source {
+	sources := []executor.Source{}
 	for _, file := range files {
 		srcBytes, _ := ioutil.ReadFile(file)
-		fmt.Printf("Evaluating file %s\n", file)
+		fmt.Fprintf(output, "Evaluating file %s\n", file)
 
 		src := string(srcBytes[:])
-		sources = append(sources, src)
+		sources = append(sources, executor.Source{Name: file, Text: src})
 	}
 
-	executor.Execute(sources, env, output)
+	return sources
 }
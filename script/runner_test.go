@@ -1,6 +1,7 @@
 package script
 
 import (
+	"bytes"
 	"os"
 	"testing"
 )
@@ -9,3 +10,13 @@ func TestRunner(t *testing.T) {
 	var fileName = "./test_script.monkey"
 	Run(os.Stdout, []string{fileName})
 }
+
+func TestRunnerOutput(t *testing.T) {
+	var out bytes.Buffer
+	Run(&out, []string{"./test_script.monkey"})
+
+	expected := "Evaluating file ./test_script.monkey\n3\nnull\n"
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
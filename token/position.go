@@ -0,0 +1,35 @@
+package token
+
+import "fmt"
+
+//Position a location in source: file name, byte offset, line and column.
+//Lines and columns start at 1, a zero Position means "unknown".  Columns
+//count bytes, so a caret has to be measured in runes before it's drawn
+type Position struct {
+	Filename string `json:"filename,omitempty"`
+	Offset   int    `json:"offset"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+}
+
+//IsValid reports whether the position points somewhere real
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+//String file:line:column, or line:column when there's no file name
+func (p Position) String() string {
+	if !p.IsValid() {
+		if p.Filename != "" {
+			return p.Filename
+		}
+
+		return "-"
+	}
+
+	if p.Filename == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+
+	return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+}
@@ -2,9 +2,24 @@ package token
 
 type TokenType string
 
+//Token a lexeme along with the source range it was read from.
+//End is exclusive, it points just past the last character.
+//Comments are the comments between the previous token and this one,
+//comments at the end of the input go on the EOF token
 type Token struct {
-	Type    TokenType
-	Literal string
+	Type     TokenType
+	Literal  string
+	Pos      Position
+	End      Position
+	Comments []Comment
+}
+
+//Comment a // line comment or a /* */ block comment, Text includes the
+//delimiters but not a line comment's newline
+type Comment struct {
+	Text string
+	Pos  Position
+	End  Position
 }
 
 const (
@@ -14,8 +29,14 @@ const (
 	// Identifiers and literals
 	IDENT  = "IDENT"
 	INT    = "INT"
+	FLOAT  = "FLOAT"
 	STRING = "STRING"
 
+	// Pieces of an interpolated string, "head ${x} middle ${y} tail"
+	STRING_HEAD   = "STRING_HEAD"
+	STRING_MIDDLE = "STRING_MIDDLE"
+	STRING_TAIL   = "STRING_TAIL"
+
 	// Operators
 	ASSIGN   = "="
 	PLUS     = "+"
@@ -23,13 +44,33 @@ const (
 	BANG     = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
+	POWER    = "**"
+
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+
+	LT    = "<"
+	GT    = ">"
+	LT_EQ = "<="
+	GT_EQ = ">="
+
+	AND = "&&"
+	OR  = "||"
 
-	LT = "<"
-	GT = ">"
+	AMPERSAND   = "&"
+	PIPE        = "|"
+	CARET       = "^"
+	TILDE       = "~"
+	SHIFT_LEFT  = "<<"
+	SHIFT_RIGHT = ">>"
 
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
+	ELLIPSIS  = "..."
 
 	LPAREN   = "("
 	RPAREN   = ")"
@@ -50,9 +91,15 @@ const (
 	EQ     = "=="
 	NOT_EQ = "!="
 
-	COLON = ":"
+	COLON     = ":"
+	FAT_ARROW = "=>"
 
-	WHILE = "while"
+	WHILE    = "while"
+	BREAK    = "break"
+	CONTINUE = "continue"
+	FOR      = "for"
+	IN       = "in"
+	MATCH    = "match"
 )
 
 //LookupIdent lookup
@@ -65,12 +112,17 @@ func LookupIdent(ident string) TokenType {
 }
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
-	"true":   TRUE,
-	"false":  FALSE,
-	"while":  WHILE,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"true":     TRUE,
+	"false":    FALSE,
+	"while":    WHILE,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"for":      FOR,
+	"in":       IN,
+	"match":    MATCH,
 }
@@ -0,0 +1,35 @@
+package vm
+
+import (
+	"monkey/object"
+	"monkey/token"
+)
+
+//newError runtime error at the instruction being run
+func (vm *VM) newError(format string, a ...interface{}) error {
+	return vm.locate(object.NewError(format, a...))
+}
+
+//locate fills in where err happened and the calls it happened in,
+//using the source maps of the functions on the frame stack
+func (vm *VM) locate(err *object.Error) error {
+	if err.Pos.IsValid() {
+		return err
+	}
+
+	err.Pos = vm.framePosition(vm.framesIndex - 1)
+
+	for i := vm.framesIndex - 1; i > 0; i-- {
+		err.Stack = append(err.Stack, object.Frame{
+			Function: vm.frames[i].cl,
+			Call:     vm.framePosition(i - 1),
+		})
+	}
+
+	return err
+}
+
+func (vm *VM) framePosition(index int) token.Position {
+	frame := vm.frames[index]
+	return frame.cl.Fn.SourceMap.Lookup(frame.ip)
+}
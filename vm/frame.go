@@ -0,0 +1,26 @@
+package vm
+
+import (
+	"monkey/code"
+	"monkey/object"
+)
+
+//Frame a function call in progress
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+
+	// loops the stack height in each loop being run, innermost last
+	loops []int
+}
+
+//NewFrame frame running cl with its locals starting at basePointer
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+//Instructions the code being run
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
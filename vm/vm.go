@@ -0,0 +1,1069 @@
+package vm
+
+import (
+	"context"
+	"monkey/budget"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/object"
+	"strings"
+)
+
+//StackSize values the stack holds to begin with, it grows as calls
+//nest deeper
+const StackSize = 2048
+
+//FrameStackSize values each level of calls the budget allows can add
+//to the stack
+const FrameStackSize = 256
+
+//GlobalsSize globals a program can define
+const GlobalsSize = 65536
+
+var (
+	//NULL shared with the evaluator so results compare equal
+	NULL = object.NULL
+	//TRUE true
+	TRUE = object.TRUE
+	//FALSE false
+	FALSE = object.FALSE
+)
+
+var operatorSymbols = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpMod:          "%",
+	code.OpPow:          "**",
+	code.OpBitAnd:       "&",
+	code.OpBitOr:        "|",
+	code.OpBitXor:       "^",
+	code.OpShiftLeft:    "<<",
+	code.OpShiftRight:   ">>",
+	code.OpGreaterThan:  ">",
+	code.OpLessThan:     "<",
+	code.OpGreaterEqual: ">=",
+	code.OpLessEqual:    "<=",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+}
+
+//VM runs compiled bytecode
+type VM struct {
+	constants   []object.Object
+	globals     []object.Object
+	globalNames []string
+	builtins    object.BuiltinTable
+	exec        *object.ExecutionContext
+
+	stack    []object.Object
+	sp       int // Always points to the next free slot.  Top of stack is stack[sp-1]
+	maxStack int // What the stack can grow to, from the budget's call depth
+
+	frames      []*Frame
+	framesIndex int
+
+	producesValue bool
+	returned      bool
+	returnValue   object.Object
+
+	meter *budget.Meter
+}
+
+//New virtual machine ready to run bytecode
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobalsStore(bytecode, make([]object.Object, GlobalsSize))
+}
+
+//NewWithGlobalsStore virtual machine that keeps its globals in s, so
+//they survive between REPL lines
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		SourceMap:    bytecode.SourceMap,
+		NumLocals:    len(bytecode.LocalNames),
+		LocalNames:   bytecode.LocalNames,
+	}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	return &VM{
+		constants:   bytecode.Constants,
+		globals:     s,
+		globalNames: bytecode.GlobalNames,
+		builtins:    object.Builtins,
+		exec:        object.NewExecutionContext(),
+
+		stack: make([]object.Object, StackSize),
+		sp:    mainFn.NumLocals,
+
+		frames:      []*Frame{mainFrame},
+		framesIndex: 1,
+
+		producesValue: bytecode.ProducesValue,
+	}
+}
+
+//SetBuiltins run with the builtins of table instead of the defaults.
+//It has to be the table the bytecode was compiled against
+func (vm *VM) SetBuiltins(table object.BuiltinTable) {
+	vm.builtins = table
+}
+
+//SetExecutionContext what builtins called by the bytecode can reach
+func (vm *VM) SetExecutionContext(ctx *object.ExecutionContext) {
+	vm.exec = ctx
+}
+
+//Summary what the last run used
+func (vm *VM) Summary() budget.Summary {
+	if vm.meter == nil {
+		return budget.Summary{}
+	}
+
+	return vm.meter.Summary()
+}
+
+//LastPoppedStackElem the value most recently popped off the stack
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.stack[vm.sp]
+}
+
+//Result what the program evaluated to, the same thing evaluator.Eval
+//gives back: the value of a top level return, otherwise of the last
+//statement, or nil when that isn't an expression
+func (vm *VM) Result() object.Object {
+	if vm.returned {
+		return vm.returnValue
+	}
+
+	if !vm.producesValue {
+		return nil
+	}
+
+	return vm.LastPoppedStackElem()
+}
+
+//Run execute the bytecode.  Runtime errors come back as *object.Error
+//carrying the position and call stack where they happened
+func (vm *VM) Run() error {
+	return vm.RunContext(context.Background(), budget.Budget{})
+}
+
+//RunContext execute the bytecode within b.  It stops with an aborted
+//*object.Error once the budget is used up or ctx is done
+func (vm *VM) RunContext(ctx context.Context, b budget.Budget) error {
+	meter, cancel := budget.NewMeter(ctx, b)
+	defer cancel()
+	vm.meter = meter
+	vm.maxStack = (meter.MaxDepth() + 1) * FrameStackSize
+
+	meter.SetRoots(vm.roots)
+	defer meter.Measure()
+
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		if err := vm.meter.Step(); err != nil {
+			return vm.locate(err)
+		}
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			constant := vm.constants[constIndex]
+			if large, ok := constant.(*object.BigInteger); ok {
+				constant = object.BigIntegerLiteral(large.Value, vm.exec.StrictIntegers)
+				if err, ok := constant.(*object.Error); ok {
+					return vm.locate(err)
+				}
+			}
+
+			err := vm.push(constant)
+			if err != nil {
+				return err
+			}
+		case code.OpPop:
+			vm.pop()
+		case code.OpDup:
+			count := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip++
+
+			start := vm.sp - count
+			for i := 0; i < count; i++ {
+				err := vm.push(vm.stack[start+i])
+				if err != nil {
+					return err
+				}
+			}
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod, code.OpPow,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+			code.OpGreaterEqual, code.OpLessEqual:
+			err := vm.executeBinaryOperation(op)
+			if err != nil {
+				return err
+			}
+		case code.OpTrue:
+			err := vm.push(TRUE)
+			if err != nil {
+				return err
+			}
+		case code.OpFalse:
+			err := vm.push(FALSE)
+			if err != nil {
+				return err
+			}
+		case code.OpNull:
+			err := vm.push(NULL)
+			if err != nil {
+				return err
+			}
+		case code.OpBang:
+			err := vm.executeBangOperator()
+			if err != nil {
+				return err
+			}
+		case code.OpMinus:
+			err := vm.executeMinusOperator()
+			if err != nil {
+				return err
+			}
+		case code.OpBitNot:
+			err := vm.executeBitNotOperator()
+			if err != nil {
+				return err
+			}
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			condition := vm.pop()
+			if !isTruthy(condition) {
+				vm.currentFrame().ip = pos - 1
+			}
+		case code.OpWhileTest:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			condition := vm.pop()
+			runs := vm.stack[vm.sp-1].(*object.Integer)
+			vm.stack[vm.sp-1] = &object.Integer{Value: runs.Value + 1}
+
+			if !isTruthy(condition) {
+				vm.currentFrame().ip = pos - 1
+			}
+		case code.OpIterate:
+			iterator := object.Iterate(vm.pop())
+			if err, ok := iterator.(*object.Error); ok {
+				return vm.locate(err)
+			}
+
+			err := vm.push(iterator)
+			if err != nil {
+				return err
+			}
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			count := int(code.ReadUint8(ins[ip+3:]))
+			vm.currentFrame().ip += 3
+
+			key, value, ok := vm.stack[vm.sp-1].(object.Iterator).Next()
+			if !ok {
+				vm.currentFrame().ip = pos - 1
+				break
+			}
+
+			if count == 2 {
+				err := vm.push(key)
+				if err != nil {
+					return err
+				}
+			}
+
+			err := vm.push(value)
+			if err != nil {
+				return err
+			}
+		case code.OpFreshLocals:
+			first := int(code.ReadUint8(ins[ip+1:]))
+			count := int(code.ReadUint8(ins[ip+2:]))
+			vm.currentFrame().ip += 2
+
+			base := vm.currentFrame().basePointer
+			for i := first; i < first+count; i++ {
+				vm.stack[base+i] = nil
+			}
+		case code.OpLoopEnter:
+			frame := vm.currentFrame()
+			frame.loops = append(frame.loops, vm.sp)
+		case code.OpLoopExit:
+			frame := vm.currentFrame()
+			frame.loops = frame.loops[:len(frame.loops)-1]
+		case code.OpUnwind:
+			count := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip++
+
+			frame := vm.currentFrame()
+			frame.loops = frame.loops[:len(frame.loops)-count]
+			vm.sp = frame.loops[len(frame.loops)-1]
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.globals[globalIndex] = vm.pop()
+		case code.OpAssignGlobal:
+			globalIndex := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if vm.globals[globalIndex] == nil {
+				return vm.newError("identifier not found: %s", nameAt(vm.globalNames, globalIndex))
+			}
+
+			vm.globals[globalIndex] = vm.stack[vm.sp-1]
+		case code.OpGetGlobal:
+			globalIndex := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			value := vm.globals[globalIndex]
+			if value == nil {
+				return vm.newError("identifier not found: %s", nameAt(vm.globalNames, globalIndex))
+			}
+
+			err := vm.push(value)
+			if err != nil {
+				return err
+			}
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			vm.setLocal(int(localIndex), vm.pop())
+		case code.OpAssignLocal:
+			localIndex := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip++
+
+			frame := vm.currentFrame()
+			if vm.stack[frame.basePointer+localIndex] == nil {
+				return vm.newError("identifier not found: %s", nameAt(frame.cl.Fn.LocalNames, localIndex))
+			}
+
+			vm.setLocal(localIndex, vm.stack[vm.sp-1])
+		case code.OpGetLocal:
+			localIndex := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip++
+
+			frame := vm.currentFrame()
+			value := vm.stack[frame.basePointer+localIndex]
+			if cell, ok := value.(*object.Cell); ok {
+				value = cell.Value
+			}
+			if value == nil {
+				return vm.newError("identifier not found: %s", nameAt(frame.cl.Fn.LocalNames, localIndex))
+			}
+
+			err := vm.push(value)
+			if err != nil {
+				return err
+			}
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			if int(builtinIndex) >= len(vm.builtins) {
+				return vm.newError("builtin %d not available", builtinIndex)
+			}
+			definition := vm.builtins[builtinIndex]
+
+			err := vm.push(definition.Builtin)
+			if err != nil {
+				return err
+			}
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			value := vm.currentFrame().cl.Free[freeIndex]
+			if cell, ok := value.(*object.Cell); ok {
+				value = cell.Value
+			}
+
+			err := vm.push(value)
+			if err != nil {
+				return err
+			}
+		case code.OpAssignFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			cell, ok := vm.currentFrame().cl.Free[freeIndex].(*object.Cell)
+			if !ok {
+				return vm.newError("cannot assign to a function inside itself")
+			}
+
+			cell.Value = vm.stack[vm.sp-1]
+		case code.OpCaptureLocal:
+			localIndex := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip++
+
+			err := vm.captureLocal(localIndex)
+			if err != nil {
+				return err
+			}
+		case code.OpCaptureFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			err := vm.push(vm.currentFrame().cl.Free[freeIndex])
+			if err != nil {
+				return err
+			}
+		case code.OpCurrentClosure:
+			currentClosure := vm.currentFrame().cl
+			err := vm.push(currentClosure)
+			if err != nil {
+				return err
+			}
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+
+			err := vm.pushAllocated(array)
+			if err != nil {
+				return err
+			}
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numElements
+
+			err = vm.pushAllocated(hash)
+			if err != nil {
+				return err
+			}
+		case code.OpInterpolate:
+			numParts := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			str := vm.buildString(vm.sp-numParts, vm.sp)
+			vm.sp = vm.sp - numParts
+
+			err := vm.pushAllocated(str)
+			if err != nil {
+				return err
+			}
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			err := vm.executeIndexExpression(left, index)
+			if err != nil {
+				return err
+			}
+		case code.OpMatchArray:
+			length := int(code.ReadUint16(ins[ip+1:]))
+			rest := code.ReadUint8(ins[ip+3:]) == 1
+			vm.currentFrame().ip += 3
+
+			array, ok := vm.stack[vm.sp-1].(*object.Array)
+
+			err := vm.push(nativeBoolToBooleanObject(ok && (rest || len(array.Elements) <= length)))
+			if err != nil {
+				return err
+			}
+		case code.OpDestructureArray:
+			length := int(code.ReadUint16(ins[ip+1:]))
+			rest := code.ReadUint8(ins[ip+3:]) == 1
+			vm.currentFrame().ip += 3
+
+			value := vm.stack[vm.sp-1]
+			array, ok := value.(*object.Array)
+			if !ok {
+				return vm.newError("cannot destructure %s %s as an array", value.Type(), value.Inspect())
+			}
+			if !rest && len(array.Elements) > length {
+				return vm.newError("array of length %d is too long to destructure, the pattern has length %d", len(array.Elements), length)
+			}
+		case code.OpDestructureHash:
+			value := vm.stack[vm.sp-1]
+			if _, ok := value.(*object.Hash); !ok {
+				return vm.newError("cannot destructure %s %s as a hash", value.Type(), value.Inspect())
+			}
+		case code.OpMatchHash:
+			_, ok := vm.stack[vm.sp-1].(*object.Hash)
+
+			err := vm.push(nativeBoolToBooleanObject(ok))
+			if err != nil {
+				return err
+			}
+		case code.OpMatchKey:
+			key := vm.pop()
+			value, ok := patternKey(vm.pop(), key)
+
+			err := vm.push(value)
+			if err == nil {
+				err = vm.push(nativeBoolToBooleanObject(ok))
+			}
+			if err != nil {
+				return err
+			}
+		case code.OpDestructureKey:
+			key := vm.pop()
+			container := vm.pop()
+
+			value, ok := patternKey(container, key)
+			if !ok {
+				if array, isArray := container.(*object.Array); isArray {
+					return vm.newError("array of length %d is too short to destructure, the pattern needs length %d", len(array.Elements), key.(*object.Integer).Value+1)
+				}
+				return vm.newError("hash has no key %s to destructure", key.Inspect())
+			}
+
+			err := vm.push(value)
+			if err != nil {
+				return err
+			}
+		case code.OpRest:
+			start := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			array := vm.pop().(*object.Array)
+
+			rest := []object.Object{}
+			if len(array.Elements) > start {
+				rest = append(rest, array.Elements[start:]...)
+			}
+
+			err := vm.pushAllocated(&object.Array{Elements: rest})
+			if err != nil {
+				return err
+			}
+		case code.OpNoMatch:
+			value := vm.pop()
+			return vm.newError("no match arm matches %s %s", value.Type(), value.Inspect())
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+
+			before := budget.SizeOf(left)
+
+			result := object.SetIndex(left, index, value)
+			if err, ok := result.(*object.Error); ok {
+				return vm.locate(err)
+			}
+
+			if err := vm.meter.Grow(left, before); err != nil {
+				return vm.locate(err)
+			}
+
+			err := vm.push(result)
+			if err != nil {
+				return err
+			}
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			err := vm.executeCall(int(numArgs))
+			if err != nil {
+				return err
+			}
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			if vm.framesIndex == 1 {
+				// return at the top level ends the program
+				vm.returned = true
+				vm.returnValue = returnValue
+				return nil
+			}
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			err := vm.push(returnValue)
+			if err != nil {
+				return err
+			}
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			err := vm.push(NULL)
+			if err != nil {
+				return err
+			}
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			err := vm.pushClosure(int(constIndex), int(numFree))
+			if err != nil {
+				return err
+			}
+		default:
+			def, err := code.Lookup(byte(op))
+			if err != nil {
+				return vm.newError("%s", err)
+			}
+
+			return vm.newError("unhandled opcode %s", def.Name)
+		}
+	}
+
+	return nil
+}
+
+func (vm *VM) push(o object.Object) error {
+	if vm.sp >= len(vm.stack) {
+		if err := vm.growStack(vm.sp + 1); err != nil {
+			return err
+		}
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+//roots what the running program can reach directly: its stack, its
+//globals and the free variables of the closures it's in
+func (vm *VM) roots(visit func(object.Object), visitEnv func(*object.Environment)) {
+	for _, o := range vm.stack[:vm.sp] {
+		visit(o)
+	}
+
+	for _, o := range vm.globals {
+		if o != nil {
+			visit(o)
+		}
+	}
+
+	for _, frame := range vm.frames[:vm.framesIndex] {
+		visit(frame.cl)
+	}
+}
+
+//pushAllocated push a value just created, counting its memory
+func (vm *VM) pushAllocated(o object.Object) error {
+	if err := vm.meter.Alloc(o); err != nil {
+		return vm.locate(err)
+	}
+
+	return vm.push(o)
+}
+
+//growStack make room for size values on the stack, as long as that's
+//within what the budget's call depth allows
+func (vm *VM) growStack(size int) error {
+	if size > vm.maxStack {
+		return vm.newError("stack overflow")
+	}
+
+	grown := 2 * len(vm.stack)
+	if grown < size {
+		grown = size
+	}
+	if grown > vm.maxStack {
+		grown = vm.maxStack
+	}
+
+	stack := make([]object.Object, grown)
+	copy(stack, vm.stack)
+	vm.stack = stack
+
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+
+	return o
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	if vm.framesIndex == len(vm.frames) {
+		vm.frames = append(vm.frames, f)
+	} else {
+		vm.frames[vm.framesIndex] = f
+	}
+	vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.meter.Leave()
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.BuiltIn:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return vm.newError("not a function %s", callee.Type())
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if numArgs != cl.Fn.NumParameters {
+		return vm.newError("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
+	}
+
+	if err := vm.meter.Enter(); err != nil {
+		return vm.locate(err)
+	}
+
+	basePointer := vm.sp - numArgs
+	if basePointer+cl.Fn.NumLocals >= len(vm.stack) {
+		if err := vm.growStack(basePointer + cl.Fn.NumLocals + 1); err != nil {
+			vm.meter.Leave()
+			return err
+		}
+	}
+
+	// Clear out whatever the last call left in the local slots, an
+	// unset local has to read as not found
+	for i := vm.sp; i < basePointer+cl.Fn.NumLocals; i++ {
+		vm.stack[i] = nil
+	}
+
+	frame := NewFrame(cl, basePointer)
+	vm.pushFrame(frame)
+
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+
+	return nil
+}
+
+func (vm *VM) callBuiltin(builtin *object.BuiltIn, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	if err := vm.exec.Capabilities.Check(builtin.Needs); err != nil {
+		return vm.locate(err)
+	}
+
+	result := builtin.Fn(vm.exec, args...)
+
+	if err, ok := result.(*object.Error); ok {
+		return vm.locate(err)
+	}
+
+	if err := vm.meter.AllocResult(result, args); err != nil {
+		return vm.locate(err)
+	}
+
+	vm.sp = vm.sp - numArgs - 1
+
+	if result == nil {
+		result = NULL
+	}
+
+	return vm.push(result)
+}
+
+//setLocal store value in the current frame's local, through its cell
+//when a closure has captured it
+func (vm *VM) setLocal(index int, value object.Object) {
+	slot := &vm.stack[vm.currentFrame().basePointer+index]
+
+	if cell, ok := (*slot).(*object.Cell); ok {
+		cell.Value = value
+		return
+	}
+
+	*slot = value
+}
+
+//captureLocal push the cell for the current frame's local, moving the
+//local into one the first time it's captured
+func (vm *VM) captureLocal(index int) error {
+	frame := vm.currentFrame()
+	slot := &vm.stack[frame.basePointer+index]
+
+	if *slot == nil {
+		return vm.newError("identifier not found: %s", nameAt(frame.cl.Fn.LocalNames, index))
+	}
+
+	cell, ok := (*slot).(*object.Cell)
+	if !ok {
+		cell = &object.Cell{Value: *slot}
+		*slot = cell
+	}
+
+	return vm.push(cell)
+}
+
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return vm.newError("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i]
+	}
+	vm.sp = vm.sp - numFree
+
+	closure := &object.Closure{Fn: function, Free: free}
+	return vm.push(closure)
+}
+
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+
+	for i := startIndex; i < endIndex; i++ {
+		elements[i-startIndex] = vm.stack[i]
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+func (vm *VM) buildString(startIndex, endIndex int) object.Object {
+	var out strings.Builder
+
+	for i := startIndex; i < endIndex; i++ {
+		out.WriteString(object.ToString(vm.stack[i]))
+	}
+
+	return &object.String{Value: out.String()}
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	hashedPairs := make(map[object.HashKey]object.HashPair)
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, vm.newError("unusable as a hash key: %s", key.Type())
+		}
+
+		hashedPairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: hashedPairs}, nil
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch {
+	case left.Type() == object.ArrayObj && index.Type() == object.IntegerObj:
+		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.HashObj:
+		return vm.executeHashIndex(left, index)
+	default:
+		return vm.newError("index operator not supported: %s", left.Type())
+	}
+}
+
+func (vm *VM) executeArrayIndex(array, index object.Object) error {
+	arrayObject := array.(*object.Array)
+	integer, ok := index.(*object.Integer)
+	if !ok {
+		// Promoted, so too large for any array
+		return vm.newError("index out of range: %s", index.Inspect())
+	}
+	i := integer.Value
+	max := int64(len(arrayObject.Elements) - 1)
+
+	if i < 0 || i > max {
+		return vm.push(NULL)
+	}
+
+	return vm.push(arrayObject.Elements[i])
+}
+
+func (vm *VM) executeHashIndex(hash, index object.Object) error {
+	hashObject := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return vm.newError("unusable as a hash key: %s", index.Type())
+	}
+
+	pair, ok := hashObject.Pairs[key.HashKey()]
+	if !ok {
+		return vm.push(NULL)
+	}
+
+	return vm.push(pair.Value)
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+	operator := operatorSymbols[op]
+
+	switch {
+	case left.Type() == object.IntegerObj && right.Type() == object.IntegerObj:
+		return vm.executeBinaryIntegerOperation(op, left, right)
+	case isNumber(left) && isNumber(right):
+		return vm.executeBinaryFloatOperation(op, left, right)
+	case left.Type() == object.StringObj && right.Type() == object.StringObj:
+		return vm.executeBinaryStringOperation(op, left, right)
+	case op == code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(left == right))
+	case op == code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(left != right))
+	case left.Type() != right.Type():
+		return vm.newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	default:
+		return vm.newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.Object) error {
+	result := object.IntegerOperation(operatorSymbols[op], left, right, vm.exec.StrictIntegers)
+	if err, ok := result.(*object.Error); ok {
+		return vm.locate(err)
+	}
+
+	return vm.pushAllocated(result)
+}
+
+func (vm *VM) executeBinaryFloatOperation(op code.Opcode, left, right object.Object) error {
+	result := object.FloatOperation(operatorSymbols[op], left, right)
+	if err, ok := result.(*object.Error); ok {
+		return vm.locate(err)
+	}
+
+	return vm.push(result)
+}
+
+func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
+	result := object.StringOperation(operatorSymbols[op], left, right)
+	if err, ok := result.(*object.Error); ok {
+		return vm.locate(err)
+	}
+
+	return vm.pushAllocated(result)
+}
+
+func (vm *VM) executeBangOperator() error {
+	operand := vm.pop()
+
+	switch operand {
+	case TRUE:
+		return vm.push(FALSE)
+	case FALSE:
+		return vm.push(TRUE)
+	case NULL:
+		return vm.push(TRUE)
+	default:
+		return vm.push(FALSE)
+	}
+}
+
+func (vm *VM) executeMinusOperator() error {
+	operand := vm.pop()
+
+	switch operand := operand.(type) {
+	case *object.Integer, *object.BigInteger:
+		result := object.Negate(operand, vm.exec.StrictIntegers)
+		if err, ok := result.(*object.Error); ok {
+			return vm.locate(err)
+		}
+		return vm.pushAllocated(result)
+	case *object.Float:
+		return vm.push(&object.Float{Value: -operand.Value})
+	default:
+		return vm.newError("unknown operator: -%s", operand.Type())
+	}
+}
+
+func (vm *VM) executeBitNotOperator() error {
+	operand := vm.pop()
+
+	if operand.Type() != object.IntegerObj {
+		return vm.newError("unknown operator: ~%s", operand.Type())
+	}
+
+	return vm.pushAllocated(object.BitNot(operand))
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.IntegerObj || obj.Type() == object.FloatObj
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}
+
+func nameAt(names []string, index int) string {
+	if index < len(names) {
+		return names[index]
+	}
+
+	return "?"
+}
+
+//patternKey the element of an array or the value of a hash that a
+//pattern's key picks out, NULL and false if there isn't one
+func patternKey(container, key object.Object) (object.Object, bool) {
+	switch container := container.(type) {
+	case *object.Array:
+		i := key.(*object.Integer).Value
+		if i < int64(len(container.Elements)) {
+			return container.Elements[i], true
+		}
+	case *object.Hash:
+		if pair, ok := container.Pairs[key.(object.Hashable).HashKey()]; ok {
+			return pair.Value, true
+		}
+	}
+
+	return NULL, false
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return TRUE
+	}
+
+	return FALSE
+}
@@ -0,0 +1,169 @@
+package vm
+
+import (
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"testing"
+)
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`let fibonacci = fn(x) {
+				if (x == 0) { return 0; }
+				if (x == 1) { return 1; }
+				fibonacci(x - 1) + fibonacci(x - 2);
+			};
+			fibonacci(15);`,
+			610,
+		},
+		{
+			`let wrapper = fn() {
+				let countDown = fn(x) {
+					if (x == 0) { return 0; } else { countDown(x - 1); }
+				};
+				countDown(1);
+			};
+			wrapper();`,
+			0,
+		},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`let newAdderOuter = fn(a, b) {
+				let c = a + b;
+				fn(d) {
+					let e = d + c;
+					fn(f) { e + f; };
+				};
+			};
+			let newAdderInner = newAdderOuter(1, 2)
+			let adder = newAdderInner(3);
+			adder(8);`,
+			14,
+		},
+		{
+			`let later = fn() { defined + 1 }; let defined = 2; later();`,
+			3,
+		},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestWhileLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = 0; while (x < 5) { let x = x + 1; }", 6},
+		{"let f = fn() { let i = 0; while (i < 3) { let i = i + 1; }; i }; f()", 3},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{`fn() { 1; }(1);`, "wrong number of arguments: want=0, got=1"},
+		{`1(2)`, "not a function INTEGER"},
+		{`let f = fn() { if (false) { let a = 1; }; a }; f()`, "identifier not found: a"},
+		{`let loop = fn(x) { loop(x) }; loop(1)`, "call depth limit of 10000 exceeded"},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestGlobalsStore(t *testing.T) {
+	globals := make([]object.Object, GlobalsSize)
+	symbolTable := compiler.NewSymbolTable()
+	constants := []object.Object{}
+
+	var result object.Object
+	for _, input := range []string{"let a = 40;", "let b = a + 1;", "b + 1"} {
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := comp.Bytecode()
+		constants = bytecode.Constants
+
+		machine := NewWithGlobalsStore(bytecode, globals)
+		if err := machine.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		result = machine.Result()
+	}
+
+	testIntegerObject(t, 42, result)
+}
+
+func runVMTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+
+		switch expected := tt.expected.(type) {
+		case int:
+			if err != nil {
+				t.Fatalf("%s: vm error: %s", tt.input, err)
+			}
+
+			testIntegerObject(t, int64(expected), vm.Result())
+		case string:
+			errorObj, ok := err.(*object.Error)
+			if !ok {
+				t.Errorf("%s: wanted an *object.Error but got %T (%v)", tt.input, err, err)
+				continue
+			}
+
+			if errorObj.Message != expected {
+				t.Errorf("wrong error message. want=%q, got=%q", expected, errorObj.Message)
+			}
+
+			if !errorObj.Pos.IsValid() {
+				t.Errorf("%s: error has no position", tt.input)
+			}
+		}
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func testIntegerObject(t *testing.T, expected int64, actual object.Object) {
+	t.Helper()
+
+	result, ok := actual.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", actual, actual)
+		return
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+	}
+}